@@ -0,0 +1,98 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"unicode/utf8"
+)
+
+// RedactedArg is what redacted arguments are replaced with.
+const RedactedArg = "<redacted>"
+
+// ArgOptions controls how the arguments given to a Task are captured. By
+// default, a Span keeps references to its arguments and only formats them
+// when Span.Args is called. If the first argument given to a Task is an
+// ArgOptions, the remaining arguments are instead formatted right away,
+// redacted, and truncated as configured, and the Span only keeps the
+// resulting strings. For example:
+//
+//   func Login(ctx context.Context, user, password string) (err error) {
+//     defer mon.Task()(&ctx, monkit.ArgOptions{Redact: []int{1}},
+//       user, password)(&err)
+//     ...
+//   }
+//
+type ArgOptions struct {
+	// MaxLength, if positive, is the maximum length in bytes of each
+	// formatted argument. Longer arguments are cut short and end in "...".
+	MaxLength int
+
+	// Redact lists the positions of arguments, starting at 0 after the
+	// ArgOptions, that are replaced with RedactedArg.
+	Redact []int
+}
+
+// formattedArg is an argument that has already been formatted by ArgOptions.
+type formattedArg string
+
+func (opts ArgOptions) redacted(pos int) bool {
+	for _, redact := range opts.Redact {
+		if redact == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot formats, redacts, and truncates args.
+func (opts ArgOptions) snapshot(args []interface{}) []interface{} {
+	rv := make([]interface{}, 0, len(args))
+	for i, arg := range args {
+		if opts.redacted(i) {
+			rv = append(rv, formattedArg(RedactedArg))
+			continue
+		}
+		rv = append(rv, formattedArg(truncateArg(formatArg(arg), opts.MaxLength)))
+	}
+	return rv
+}
+
+// truncateArg cuts s down to at most max bytes, without splitting a UTF-8
+// sequence, if max is positive.
+func truncateArg(s string, max int) string {
+	const ellipsis = "..."
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	if max <= len(ellipsis) {
+		return ellipsis[:max]
+	}
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
+
+// splitArgOptions removes leading ArgOptions from args and applies them.
+func splitArgOptions(args []interface{}) []interface{} {
+	if len(args) == 0 {
+		return args
+	}
+	if opts, ok := args[0].(ArgOptions); ok {
+		return opts.snapshot(args[1:])
+	}
+	return args
+}
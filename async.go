@@ -0,0 +1,96 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import "sync"
+
+// ObserveTracesAsync is like ObserveFinishedTraces, but cb is only given the
+// trace, once all of its spans have finished. Instead of calling cb on the
+// goroutine that finished the trace, finished traces are queued and handed to
+// cb by a pool of worker goroutines, so a slow exporter doesn't add latency
+// to the traced code. Up to queueSize traces can be
+// waiting for a worker; traces that finish while the queue is full are
+// dropped and counted in the async_dropped_traces Counter of the monkit
+// package Scope. Panics in cb are handled like those of any trace watcher.
+// See SetWatcherPanicHandler.
+//
+// The returned cancel method stops observing new traces, waits for the
+// workers to hand the traces still in the queue to cb, and stops the
+// workers.
+func (r *Registry) ObserveTracesAsync(workers, queueSize int,
+	cb func(*Trace)) (cancel func()) {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	q := &asyncTraceQueue{
+		traces:  make(chan *Trace, queueSize),
+		dropped: r.ScopeNamed(selfScope).Counter("async_dropped_traces"),
+	}
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer q.wg.Done()
+			for t := range q.traces {
+				r.callWatcher(cb, t)
+			}
+		}()
+	}
+	stop := r.ObserveFinishedTraces(func(t *Trace, spans []*FinishedSpan) {
+		q.enqueue(t)
+	})
+	return func() {
+		// traces that are still running are reported when stopping, so
+		// close the queue first to ignore them.
+		q.close()
+		stop()
+	}
+}
+
+type asyncTraceQueue struct {
+	traces  chan *Trace
+	dropped *Counter
+	wg      sync.WaitGroup
+
+	mtx    sync.Mutex
+	closed bool
+}
+
+func (q *asyncTraceQueue) enqueue(t *Trace) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return
+	}
+	select {
+	case q.traces <- t:
+	default:
+		q.dropped.Inc(1)
+	}
+}
+
+// close stops accepting traces and waits for the workers to drain the
+// queue.
+func (q *asyncTraceQueue) close() {
+	q.mtx.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.traces)
+	}
+	q.mtx.Unlock()
+	q.wg.Wait()
+}
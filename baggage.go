@@ -0,0 +1,71 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+)
+
+type baggageKey struct{}
+
+// SetBaggage associates a string value with key as baggage on the Trace.
+// Baggage is like a value set with Set, except that it is meant to describe
+// the whole request (e.g. a tenant id or the request origin), so it is
+// carried along when the trace is propagated to other processes, such as by
+// the http subpackage.
+func (t *Trace) SetBaggage(key, val string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	old, _ := t.vals[baggageKey{}].(map[string]string)
+	// baggage maps are never changed once stored, so AllBaggage can hand
+	// them out without copying under the lock.
+	baggage := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		baggage[k] = v
+	}
+	baggage[key] = val
+	if t.vals == nil {
+		t.vals = map[interface{}]interface{}{}
+	}
+	t.vals[baggageKey{}] = baggage
+}
+
+// Baggage returns the baggage value associated with key on the Trace, if
+// any. See SetBaggage.
+func (t *Trace) Baggage(key string) (val string, ok bool) {
+	baggage, _ := t.Get(baggageKey{}).(map[string]string)
+	val, ok = baggage[key]
+	return val, ok
+}
+
+// AllBaggage returns a copy of all of the baggage on the Trace.
+func (t *Trace) AllBaggage() map[string]string {
+	baggage, _ := t.Get(baggageKey{}).(map[string]string)
+	rv := make(map[string]string, len(baggage))
+	for k, v := range baggage {
+		rv[k] = v
+	}
+	return rv
+}
+
+// BaggageFromCtx returns the baggage value associated with key on the Trace
+// of the Span in ctx, if any.
+func BaggageFromCtx(ctx context.Context, key string) (val string, ok bool) {
+	s := SpanFromCtx(ctx)
+	if s == nil {
+		return "", false
+	}
+	return s.Trace().Baggage(key)
+}
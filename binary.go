@@ -0,0 +1,223 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// traceBinaryVersion is the first byte of the binary trace context format.
+// Decoders reject versions they don't know, so future versions are free to
+// change everything that follows.
+const traceBinaryVersion = 1
+
+// flags of the binary trace context format
+const (
+	traceBinarySampled = 1 << iota // the sampling decision, if decided
+	traceBinaryDecided             // there is a sampling decision
+	traceBinaryParent              // a parent span id follows the trace id
+	traceBinaryId128               // the high 64 bits of the trace id follow
+)
+
+// maxTraceBinaryBaggageSize and maxTraceBinaryBaggageEntries limit how much
+// baggage is encoded or accepted, the same way the http subpackage limits
+// baggage headers. The size of an entry is the length of its key and value.
+const (
+	maxTraceBinaryBaggageSize    = 8192
+	maxTraceBinaryBaggageEntries = 64
+)
+
+var (
+	errTraceBinaryShort   = errors.New("monkit: binary trace context too short")
+	errTraceBinaryBaggage = errors.New(
+		"monkit: binary trace context has too much baggage")
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler. It encodes the Trace's
+// id, sampling decision, and baggage compactly, for propagating a trace
+// through transports that can't carry text headers, such as binary message
+// queues. No parent span id is encoded; see Span.MarshalTraceBinary. Decode
+// with UnmarshalTraceBinary. Baggage is encoded in order of its keys until
+// there are 64 entries or 8192 bytes of keys and values.
+func (t *Trace) MarshalBinary() ([]byte, error) {
+	return marshalTraceBinary(t, nil), nil
+}
+
+// MarshalTraceBinary is like Trace.MarshalBinary for the Span's Trace, but
+// also encodes the Span's id as the parent span id for the receiving side.
+func (s *Span) MarshalTraceBinary() []byte {
+	return marshalTraceBinary(s.trace, &s.id)
+}
+
+func marshalTraceBinary(t *Trace, parentId *int64) []byte {
+	var flags byte
+	if sampled, ok := t.Get(SampledKey).(bool); ok {
+		flags |= traceBinaryDecided
+		if sampled {
+			flags |= traceBinarySampled
+		}
+	}
+	if parentId != nil {
+		flags |= traceBinaryParent
+	}
+	if t.idHigh != 0 {
+		flags |= traceBinaryId128
+	}
+
+	buf := make([]byte, 0, 2+3*8+1)
+	buf = append(buf, traceBinaryVersion, flags)
+	buf = appendUint64(buf, uint64(t.id))
+	if t.idHigh != 0 {
+		buf = appendUint64(buf, uint64(t.idHigh))
+	}
+	if parentId != nil {
+		buf = appendUint64(buf, uint64(*parentId))
+	}
+
+	baggage := t.AllBaggage()
+	keys := make([]string, 0, len(baggage))
+	for key := range baggage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	size := 0
+	for i, key := range keys {
+		size += len(key) + len(baggage[key])
+		if i >= maxTraceBinaryBaggageEntries ||
+			size > maxTraceBinaryBaggageSize {
+			keys = keys[:i]
+			break
+		}
+	}
+	buf = appendUvarint(buf, uint64(len(keys)))
+	for _, key := range keys {
+		buf = appendString(buf, key)
+		buf = appendString(buf, baggage[key])
+	}
+	return buf
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// UnmarshalTraceBinary decodes a trace context encoded by Trace.MarshalBinary
+// or Span.MarshalTraceBinary into a new Trace, along with the parent span id,
+// which is 0 if none was encoded. The Trace and parent id are meant to be
+// passed to Func.RemoteTrace. Data with more baggage than MarshalBinary
+// encodes is rejected.
+func UnmarshalTraceBinary(data []byte) (t *Trace, parentId int64, err error) {
+	if len(data) < 2 {
+		return nil, 0, errTraceBinaryShort
+	}
+	if data[0] != traceBinaryVersion {
+		return nil, 0, fmt.Errorf(
+			"monkit: unsupported binary trace context version %d", data[0])
+	}
+	flags, data := data[1], data[2:]
+
+	var id, idHigh uint64
+	if id, data, err = readUint64(data); err != nil {
+		return nil, 0, err
+	}
+	if flags&traceBinaryId128 != 0 {
+		if idHigh, data, err = readUint64(data); err != nil {
+			return nil, 0, err
+		}
+	}
+	if flags&traceBinaryParent != 0 {
+		var parent uint64
+		if parent, data, err = readUint64(data); err != nil {
+			return nil, 0, err
+		}
+		parentId = int64(parent)
+	}
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, 0, errTraceBinaryShort
+	}
+	if count > maxTraceBinaryBaggageEntries {
+		return nil, 0, errTraceBinaryBaggage
+	}
+	data = data[n:]
+	var baggage map[string]string
+	size := 0
+	for i := uint64(0); i < count; i++ {
+		var key, val string
+		if key, data, err = readString(data,
+			maxTraceBinaryBaggageSize-size); err != nil {
+			return nil, 0, err
+		}
+		size += len(key)
+		if val, data, err = readString(data,
+			maxTraceBinaryBaggageSize-size); err != nil {
+			return nil, 0, err
+		}
+		size += len(val)
+		if baggage == nil {
+			baggage = make(map[string]string, count)
+		}
+		baggage[key] = val
+	}
+
+	var traceId TraceId
+	binary.BigEndian.PutUint64(traceId[:8], idHigh)
+	binary.BigEndian.PutUint64(traceId[8:], id)
+	t = NewTrace128(traceId)
+	if flags&traceBinaryDecided != 0 {
+		t.Set(SampledKey, flags&traceBinarySampled != 0)
+	}
+	if baggage != nil {
+		// the map is new and never changed again, as SetBaggage expects.
+		t.Set(baggageKey{}, baggage)
+	}
+	return t, parentId, nil
+}
+
+func readUint64(data []byte) (v uint64, rest []byte, err error) {
+	if len(data) < 8 {
+		return 0, nil, errTraceBinaryShort
+	}
+	return binary.BigEndian.Uint64(data), data[8:], nil
+}
+
+// readString reads a string of at most max bytes.
+func readString(data []byte, max int) (s string, rest []byte, err error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return "", nil, errTraceBinaryShort
+	}
+	if length > uint64(max) {
+		return "", nil, errTraceBinaryBaggage
+	}
+	data = data[n:]
+	return string(data[:length]), data[length:], nil
+}
@@ -0,0 +1,38 @@
+// Copyright (C) 2016 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+type annotationBudgetRef struct {
+	bytes   int
+	dropped *Counter
+}
+
+// SetAnnotationBudget limits the total size of the annotations on each Span
+// to the given number of bytes, where an annotation's size is the length of
+// its name plus the length of its string value. Annotations that would take a
+// Span over its budget are dropped and counted in the annotations_dropped
+// counter of the monkit Scope, while the annotations the Span already has are
+// kept. This protects memory and presenter output from overly verbose
+// instrumentation. The default of 0 doesn't limit annotations.
+func (r *Registry) SetAnnotationBudget(bytes int) {
+	if bytes <= 0 {
+		storeAnnotationBudgetRef(&r.annotationBudget, nil)
+		return
+	}
+	storeAnnotationBudgetRef(&r.annotationBudget, &annotationBudgetRef{
+		bytes:   bytes,
+		dropped: r.ScopeNamed(selfScope).Counter("annotations_dropped"),
+	})
+}
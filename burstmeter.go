@@ -0,0 +1,155 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3/monotime"
+)
+
+// burstMeterWindow is how many seconds of per-second counts a BurstMeter
+// keeps.
+const burstMeterWindow = 60
+
+// BurstMeter keeps track of how bursty events are: the highest and lowest
+// number of events in any one second of the last minute, which average rates
+// hide. Implements the StatSource interface. You should construct using
+// NewBurstMeter, though expected usage is like:
+//
+//   var (
+//     mon      = monkit.Package()
+//     requests = mon.BurstMeter("requests")
+//   )
+//
+//   func MyFunc() {
+//     ...
+//     requests.Mark(1)
+//     ...
+//   }
+//
+type BurstMeter struct {
+	scopeGate
+	mtx    sync.Mutex
+	slots  [burstMeterWindow]int64 // events per second, as a ring
+	second int64                   // the second of the newest slot
+	first  int64                   // the first second since the last reset
+	total  int64
+	key    SeriesKey
+}
+
+// NewBurstMeter constructs a BurstMeter
+func NewBurstMeter(key SeriesKey) *BurstMeter {
+	now := monotime.Now().Unix()
+	return &BurstMeter{key: key, second: now, first: now}
+}
+
+// Mark marks amount events occurring in the current second.
+func (m *BurstMeter) Mark(amount int) {
+	m.Mark64(int64(amount))
+}
+
+// Mark64 marks amount events occurring in the current second (int64
+// version).
+func (m *BurstMeter) Mark64(amount int64) {
+	if m.off() {
+		return
+	}
+	m.mark(monotime.Now(), amount)
+}
+
+func (m *BurstMeter) mark(now time.Time, amount int64) {
+	m.mtx.Lock()
+	m.advance(now.Unix())
+	m.slots[m.second%burstMeterWindow] += amount
+	m.total += amount
+	m.mtx.Unlock()
+}
+
+// advance moves the ring forward to the given second, clearing the slots of
+// the seconds in between. There is no background timer; the ring is only
+// advanced when the meter is marked or read. m.mtx must be held.
+func (m *BurstMeter) advance(second int64) {
+	gap := second - m.second
+	if gap <= 0 {
+		return
+	}
+	if gap > burstMeterWindow {
+		gap = burstMeterWindow
+	}
+	for i := int64(1); i <= gap; i++ {
+		m.slots[(second-gap+i)%burstMeterWindow] = 0
+	}
+	m.second = second
+}
+
+// Reset resets all internal state.
+func (m *BurstMeter) Reset() {
+	now := monotime.Now().Unix()
+	m.mtx.Lock()
+	m.slots = [burstMeterWindow]int64{}
+	m.second, m.first = now, now
+	m.total = 0
+	m.mtx.Unlock()
+}
+
+// Rates returns the highest and lowest number of events per second within
+// the last minute. The current second counts towards the peak as soon as it
+// exceeds it, but only completed seconds count towards the minimum, which is
+// 0 if no second has completed since the meter was created or reset.
+func (m *BurstMeter) Rates() (min, peak float64) {
+	return m.rates(monotime.Now())
+}
+
+func (m *BurstMeter) rates(now time.Time) (min, peak float64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.advance(now.Unix())
+
+	peak = float64(m.slots[m.second%burstMeterWindow])
+	first := m.second - burstMeterWindow + 1
+	if first < m.first {
+		first = m.first
+	}
+	for second := first; second <= m.second; second++ {
+		count := float64(m.slots[second%burstMeterWindow])
+		if count > peak {
+			peak = count
+		}
+		if second == m.second {
+			break
+		}
+		if second == first || count < min {
+			min = count
+		}
+	}
+	return min, peak
+}
+
+// Total returns the total number of events marked.
+func (m *BurstMeter) Total() int64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.total
+}
+
+// Stats implements the StatSource interface
+func (m *BurstMeter) Stats(cb func(key SeriesKey, field string, val float64)) {
+	min, peak := m.Rates()
+	cb(m.key, "peak_rate", peak)
+	cb(m.key, "min_rate", min)
+	cb(m.key, "total", float64(m.Total()))
+}
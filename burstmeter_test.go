@@ -0,0 +1,52 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBurstMeter(t *testing.T) {
+	m := NewRegistry().ScopeNamed("test").BurstMeter("requests")
+	start := time.Unix(m.second, 0)
+
+	m.mark(start, 5)
+	m.mark(start.Add(time.Second), 50)
+	m.mark(start.Add(2*time.Second), 10)
+	if min, peak := m.rates(start.Add(2 * time.Second)); min != 5 || peak != 50 {
+		t.Fatalf("unexpected rates: min %v, peak %v", min, peak)
+	}
+
+	// the current second counts towards the peak once it exceeds it
+	m.mark(start.Add(2*time.Second), 90)
+	if _, peak := m.rates(start.Add(2 * time.Second)); peak != 100 {
+		t.Fatalf("expected the current second to be the peak, got %v", peak)
+	}
+
+	// quiet seconds count towards the minimum
+	if min, _ := m.rates(start.Add(4 * time.Second)); min != 0 {
+		t.Fatalf("expected a minimum of 0 after a quiet second, got %v", min)
+	}
+
+	// bursts leave the window after a minute
+	m.mark(start.Add(time.Minute+30*time.Second), 7)
+	if min, peak := m.rates(start.Add(time.Minute + 31*time.Second)); min != 0 || peak != 7 {
+		t.Fatalf("unexpected rates after a minute: min %v, peak %v", min, peak)
+	}
+	if m.Total() != 162 {
+		t.Fatalf("expected a total of 162, got %d", m.Total())
+	}
+}
@@ -54,6 +54,86 @@ func storeTraceWatcherRef(addr **traceWatcherRef, val *traceWatcherRef) {
 	bigHonkinMutex.Unlock()
 }
 
+func loadClockRef(addr **clockRef) (val *clockRef) {
+	bigHonkinMutex.Lock()
+	val = *addr
+	bigHonkinMutex.Unlock()
+	return val
+}
+
+func storeClockRef(addr **clockRef, val *clockRef) {
+	bigHonkinMutex.Lock()
+	*addr = val
+	bigHonkinMutex.Unlock()
+}
+
+func loadSamplerRef(addr **samplerRef) (val *samplerRef) {
+	bigHonkinMutex.Lock()
+	val = *addr
+	bigHonkinMutex.Unlock()
+	return val
+}
+
+func storeSamplerRef(addr **samplerRef, val *samplerRef) {
+	bigHonkinMutex.Lock()
+	*addr = val
+	bigHonkinMutex.Unlock()
+}
+
+func loadAnnotationBudgetRef(addr **annotationBudgetRef) (
+	val *annotationBudgetRef) {
+	bigHonkinMutex.Lock()
+	val = *addr
+	bigHonkinMutex.Unlock()
+	return val
+}
+
+func storeAnnotationBudgetRef(addr **annotationBudgetRef,
+	val *annotationBudgetRef) {
+	bigHonkinMutex.Lock()
+	*addr = val
+	bigHonkinMutex.Unlock()
+}
+
+func loadIdGeneratorRef(addr **idGeneratorRef) (val *idGeneratorRef) {
+	bigHonkinMutex.Lock()
+	val = *addr
+	bigHonkinMutex.Unlock()
+	return val
+}
+
+func storeIdGeneratorRef(addr **idGeneratorRef, val *idGeneratorRef) {
+	bigHonkinMutex.Lock()
+	*addr = val
+	bigHonkinMutex.Unlock()
+}
+
+func loadPanicHandlerRef(addr **panicHandlerRef) (val *panicHandlerRef) {
+	bigHonkinMutex.Lock()
+	val = *addr
+	bigHonkinMutex.Unlock()
+	return val
+}
+
+func storePanicHandlerRef(addr **panicHandlerRef, val *panicHandlerRef) {
+	bigHonkinMutex.Lock()
+	*addr = val
+	bigHonkinMutex.Unlock()
+}
+
+func loadNameFormatterRef(addr **nameFormatterRef) (val *nameFormatterRef) {
+	bigHonkinMutex.Lock()
+	val = *addr
+	bigHonkinMutex.Unlock()
+	return val
+}
+
+func storeNameFormatterRef(addr **nameFormatterRef, val *nameFormatterRef) {
+	bigHonkinMutex.Lock()
+	*addr = val
+	bigHonkinMutex.Unlock()
+}
+
 func compareAndSwapSpanObserverTuple(addr **spanObserverTuple,
 	old, new *spanObserverTuple) bool {
 	bigHonkinMutex.Lock()
@@ -52,6 +52,98 @@ func storeTraceWatcherRef(addr **traceWatcherRef, val *traceWatcherRef) {
 		unsafe.Pointer(val))
 }
 
+//
+// *clockRef atomic functions
+//
+
+func loadClockRef(addr **clockRef) (val *clockRef) {
+	return (*clockRef)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr))))
+}
+
+func storeClockRef(addr **clockRef, val *clockRef) {
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr)),
+		unsafe.Pointer(val))
+}
+
+//
+// *samplerRef atomic functions
+//
+
+func loadSamplerRef(addr **samplerRef) (val *samplerRef) {
+	return (*samplerRef)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr))))
+}
+
+func storeSamplerRef(addr **samplerRef, val *samplerRef) {
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr)),
+		unsafe.Pointer(val))
+}
+
+//
+// *annotationBudgetRef atomic functions
+//
+
+func loadAnnotationBudgetRef(addr **annotationBudgetRef) (
+	val *annotationBudgetRef) {
+	return (*annotationBudgetRef)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr))))
+}
+
+func storeAnnotationBudgetRef(addr **annotationBudgetRef,
+	val *annotationBudgetRef) {
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr)),
+		unsafe.Pointer(val))
+}
+
+//
+// *idGeneratorRef atomic functions
+//
+
+func loadIdGeneratorRef(addr **idGeneratorRef) (val *idGeneratorRef) {
+	return (*idGeneratorRef)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr))))
+}
+
+func storeIdGeneratorRef(addr **idGeneratorRef, val *idGeneratorRef) {
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr)),
+		unsafe.Pointer(val))
+}
+
+//
+// *panicHandlerRef atomic functions
+//
+
+func loadPanicHandlerRef(addr **panicHandlerRef) (val *panicHandlerRef) {
+	return (*panicHandlerRef)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr))))
+}
+
+func storePanicHandlerRef(addr **panicHandlerRef, val *panicHandlerRef) {
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr)),
+		unsafe.Pointer(val))
+}
+
+//
+// *nameFormatterRef atomic functions
+//
+
+func loadNameFormatterRef(addr **nameFormatterRef) (val *nameFormatterRef) {
+	return (*nameFormatterRef)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr))))
+}
+
+func storeNameFormatterRef(addr **nameFormatterRef, val *nameFormatterRef) {
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(addr)),
+		unsafe.Pointer(val))
+}
+
 //
 // *spanObserverTuple atomic functons
 //
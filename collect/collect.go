@@ -25,12 +25,7 @@ import (
 
 // FinishedSpan is a Span that has completed and contains information about
 // how it finished.
-type FinishedSpan struct {
-	Span     *monkit.Span
-	Err      error
-	Panicked bool
-	Finish   time.Time
-}
+type FinishedSpan = monkit.FinishedSpan
 
 type spanParent struct {
 	parentId int64
@@ -32,6 +32,7 @@ import (
 //   }
 //
 type Counter struct {
+	scopeGate
 	mtx            sync.Mutex
 	val, low, high int64
 	nonempty       bool
@@ -60,7 +61,9 @@ func (c *Counter) set(val int64) {
 func (c *Counter) Set(val int64) (former int64) {
 	c.mtx.Lock()
 	former = c.val
-	c.set(val)
+	if !c.off() {
+		c.set(val)
+	}
 	c.mtx.Unlock()
 	return former
 }
@@ -68,7 +71,9 @@ func (c *Counter) Set(val int64) (former int64) {
 // Inc will atomically increment the counter by delta and return the new value.
 func (c *Counter) Inc(delta int64) (current int64) {
 	c.mtx.Lock()
-	c.set(c.val + delta)
+	if !c.off() {
+		c.set(c.val + delta)
+	}
 	current = c.val
 	c.mtx.Unlock()
 	return current
@@ -113,6 +118,20 @@ func (c *Counter) Reset() (val, low, high int64) {
 	return val, low, high
 }
 
+// ResetWatermarks resets the high and low values to the current value,
+// leaving the current value alone, and returns what the high and low values
+// were. This is useful for tracking things like peak concurrency per
+// reporting interval.
+func (c *Counter) ResetWatermarks() (low, high int64) {
+	c.mtx.Lock()
+	low, high = c.low, c.high
+	if c.nonempty {
+		c.low, c.high = c.val, c.val
+	}
+	c.mtx.Unlock()
+	return low, high
+}
+
 // Stats implements the StatSource interface
 func (c *Counter) Stats(cb func(key SeriesKey, field string, val float64)) {
 	c.mtx.Lock()
@@ -0,0 +1,51 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounterWatermarks(t *testing.T) {
+	c := NewCounter(NewSeriesKey("concurrency"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Inc(1)
+				c.Dec(1)
+			}
+		}()
+	}
+	wg.Wait()
+	c.Inc(2)
+
+	if c.Current() != 2 || c.Low() != 0 || c.High() < 2 {
+		t.Fatalf("unexpected values: %d %d %d", c.Current(), c.Low(), c.High())
+	}
+
+	low, high := c.ResetWatermarks()
+	if low != 0 || high < 2 {
+		t.Fatalf("unexpected former watermarks: %d %d", low, high)
+	}
+	if c.Current() != 2 || c.Low() != 2 || c.High() != 2 {
+		t.Fatalf("unexpected values after reset: %d %d %d",
+			c.Current(), c.Low(), c.High())
+	}
+}
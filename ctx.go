@@ -16,33 +16,50 @@ package monkit
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
-
-	"github.com/spacemonkeygo/monkit/v3/monotime"
 )
 
 // Span represents a 'span' of execution. A span is analogous to a stack frame.
-// Spans are constructed as a side-effect of Tasks.
+// Spans are constructed as a side-effect of Tasks. A Span stays valid after it
+// finishes, since references to it can be kept from SpanFromCtx, RootSpans,
+// span observers and recent traces, so Spans are never reused.
 type Span struct {
 	// sync/atomic things
 	mtx spinLock
 
 	// immutable things from construction
-	id       int64
-	start    time.Time
-	f        *Func
-	trace    *Trace
-	parent   *Span
-	parentId *int64
-	args     []interface{}
+	id        int64
+	start     time.Time
+	wallStart time.Time // see WallStart
+	f         *Func
+	trace     *Trace
+	parent    *Span
+	parentId  *int64
+	depth     int32 // in the span tree, after flattening
+	nesting   int32 // had the span tree not been flattened
+	args      []interface{}
 	context.Context
 
 	// protected by mtx
-	done        bool
-	orphaned    bool
-	children    spanBag
-	annotations []Annotation
+	done            bool
+	finish          time.Time
+	err             error
+	panicked        bool
+	orphaned        bool
+	children        spanBag
+	links           []Link
+	events          []Event
+	level           Level
+	status          StatusCode
+	statusMessage   string
+	runtime         *runtimeSample // see Func.SetCaptureRuntimeDeltas
+	childCount      int
+	dropped         int64
+	untracked       bool // protected by parent.mtx
+	annotations     []Annotation
+	annotationBytes int // only counted while there is an annotation budget
 }
 
 // SpanFromCtx loads the current Span from the given context. This assumes
@@ -56,8 +73,43 @@ func SpanFromCtx(ctx context.Context) *Span {
 	return nil
 }
 
+// forkCtx is a context that has its own deadline, cancellation, and values,
+// but makes Tasks start child Spans of parent. See Span.Fork.
+type forkCtx struct {
+	context.Context
+	parent *Span
+}
+
+func (ctx *forkCtx) Value(key interface{}) interface{} {
+	if key == spanKey {
+		return ctx.parent
+	}
+	return ctx.Context.Value(key)
+}
+
+// Fork returns a copy of ctx in which Tasks start child Spans of s, no matter
+// what Span, if any, ctx already has. The deadline, cancellation, and other
+// values of ctx are kept. This is useful to link work done in a goroutine to
+// the Span that started it when the goroutine can't use that Span's context,
+// for instance because the goroutine must outlive the Span's cancellation:
+//
+//   func (s *Server) Handle(ctx context.Context) (err error) {
+//     defer mon.Task()(&ctx)(&err)
+//     go s.cleanup(monkit.SpanFromCtx(ctx).Fork(context.Background()))
+//     ...
+//   }
+//
+// Child Spans started from the returned context while s is running are
+// children of s like any other. If s has already finished when a child Span
+// starts, or finishes while the child is still running, the child is
+// orphaned: it keeps s as its parent, but is listed with the root Spans of
+// the Registry until it finishes. s itself is never marked as orphaned.
+func (s *Span) Fork(ctx context.Context) context.Context {
+	return &forkCtx{Context: ctx, parent: s}
+}
+
 func newSpan(ctx context.Context, f *Func, args []interface{}, trace *Trace,
-	parentId *int64) (sctx context.Context, exit func(*error)) {
+	parentId *int64, checkCtx bool) (sctx context.Context, exit func(*error)) {
 
 	var s, parent *Span
 	if s, ok := ctx.(*Span); ok && s != nil {
@@ -72,7 +124,7 @@ func newSpan(ctx context.Context, f *Func, args []interface{}, trace *Trace,
 			trace = parent.trace
 		}
 	} else if trace == nil {
-		trace = NewTrace(NewId())
+		trace = NewTrace(f.scope.r.newId())
 		f.scope.r.observeTrace(trace)
 	}
 
@@ -82,20 +134,53 @@ func newSpan(ctx context.Context, f *Func, args []interface{}, trace *Trace,
 		parent = nil
 	}
 
+	// spans beyond the maximum depth are flattened under the deepest allowed
+	// ancestor.
+	depth, nesting := int32(1), int32(1)
+	flattened := false
+	if parent != nil {
+		depth, nesting = parent.depth+1, parent.nesting+1
+		if max := f.scope.r.maxTraceDepth(); max > 0 && depth > max {
+			flattened = true
+			for parent.depth >= max && parent.parent != nil {
+				parent = parent.parent
+			}
+			depth = parent.depth + 1
+		}
+	}
+
 	observer := trace.getObserver()
 
 	s = &Span{
-		id:       NewId(),
-		start:    monotime.Now(),
-		f:        f,
-		trace:    trace,
-		parent:   parent,
-		parentId: parentId,
-		args:     args,
-		Context:  ctx,
+		id:        f.scope.r.newId(),
+		start:     f.scope.r.now(),
+		wallStart: f.scope.r.wallNow(),
+		f:         f,
+		trace:     trace,
+		parent:    parent,
+		parentId:  parentId,
+		depth:     depth,
+		nesting:   nesting,
+		args:      splitArgOptions(args),
+		Context:   ctx,
 	}
 
-	trace.incrementSpans()
+	if flattened {
+		s.AnnotateValue("depth.overflow", int(nesting))
+	}
+
+	// record how much time the span had left to run, so timeout cascades
+	// can be traced back to where the budget was spent. deadlines are wall
+	// clock times, so this doesn't use the Registry's clock.
+	if deadline, ok := s.Context.Deadline(); ok {
+		s.AnnotateValue("deadline.budget", time.Until(deadline))
+	}
+
+	if f.CaptureRuntimeDeltas() {
+		s.runtime = sampleRuntime()
+	}
+
+	trace.incrementSpans(s.start)
 
 	if parent != nil {
 		f.start(parent.f)
@@ -114,17 +199,40 @@ func newSpan(ctx context.Context, f *Func, args []interface{}, trace *Trace,
 		rec := recover()
 		panicked := rec != nil
 
-		finish := monotime.Now()
+		finish := s.f.scope.r.now()
 
 		var err error
 		if errptr != nil {
 			err = *errptr
 		}
-		s.f.end(err, panicked, finish.Sub(s.start))
+		errClass := s.f.end(err, panicked, finish.Sub(s.start))
+		if err != nil && !panicked {
+			s.Annotate("error", err.Error())
+			s.Annotate("error.class", errClass)
+		}
+		if panicked && s.f.CapturePanics() {
+			s.AnnotateValue("panicked", true)
+			s.Annotate("panic", fmt.Sprint(rec))
+		}
+		if s.runtime != nil {
+			allocBytes, goroutines := s.runtime.deltas()
+			s.f.observeRuntimeDeltas(allocBytes, goroutines)
+			s.AnnotateValue("runtime.alloc_bytes", allocBytes)
+			s.AnnotateValue("runtime.goroutines", goroutines)
+		}
+		if checkCtx {
+			s.checkCtx()
+		}
+		if deadline, ok := s.Context.Deadline(); ok {
+			s.AnnotateValue("deadline.exceeded", !time.Now().Before(deadline))
+		}
 
 		var children []*Span
 		s.mtx.Lock()
 		s.done = true
+		s.finish = finish
+		s.err = err
+		s.panicked = panicked
 		orphaned := s.orphaned
 		s.children.Iterate(func(child *Span) {
 			children = append(children, child)
@@ -143,13 +251,21 @@ func newSpan(ctx context.Context, f *Func, args []interface{}, trace *Trace,
 			s.f.scope.r.rootSpanEnd(s)
 		}
 
-		trace.decrementSpans()
+		r := s.f.scope.r
+		recording := r.recordingTraces()
+		if recording {
+			trace.recordFinished(s)
+		}
+		if trace.decrementSpans(finish) == 0 && recording {
+			r.traceFinished(trace)
+		}
 
 		// Re-fetch the observer, in case the value has changed since newSpan
 		// was called
 		if observer := trace.getObserver(); observer != nil {
 			observer.Finish(sctx, s, err, panicked, finish)
 		}
+		trace.spanObserved()
 
 		if panicked {
 			panic(rec)
@@ -204,6 +320,53 @@ type Task func(ctx *context.Context, args ...interface{}) func(*error)
 // If you want to control Trace creation, see Func.ResetTrace and
 // Func.RemoteTrace
 func (s *Scope) Task(tags ...SeriesTag) Task {
+	return s.newTask(false, false, tags)
+}
+
+// TaskCtx is like Task, but when the returned Task completes it also checks
+// whether the Task's context was cancelled or its deadline was exceeded. If
+// so, the Span is annotated with cancelled=true or deadline_exceeded=true
+// along with the cancellation cause, and the Func's cancelled or
+// deadline_exceeded counter is incremented. This lets cancellations be
+// graphed separately from errors.
+//
+//   func MyFunc(ctx context.Context, arg1, arg2 string) (err error) {
+//     defer mon.TaskCtx()(&ctx)(&err)
+//     ...
+//   }
+//
+func (s *Scope) TaskCtx(tags ...SeriesTag) Task {
+	return s.newTask(true, false, tags)
+}
+
+// TaskIfSampled is like Task, but only starts a Span if ctx already belongs
+// to a sampled trace, that is, one with SampledKey set to true. Otherwise it
+// only times the call for the Func's stats, which is cheap enough for
+// fine-grained instrumentation in tight loops:
+//
+//   for _, item := range items {
+//     func() (err error) {
+//       defer mon.TaskIfSampled()(&ctx)(&err)
+//       ...
+//     }()
+//   }
+//
+// Calls made without a Span don't change ctx, so they show up in the Func's
+// stats and in Func-based presenters such as FuncsDot, but not in live span
+// output such as SpansText, in traces, or to trace and span observers, and
+// Tasks they start are attributed to the enclosing Span instead. The
+// returned func must be called either way.
+func (s *Scope) TaskIfSampled(tags ...SeriesTag) Task {
+	return s.newTask(false, true, tags)
+}
+
+func (s *Scope) newTask(checkCtx, sampledOnly bool, tags []SeriesTag) Task {
+	if s.r.noop {
+		if len(tags) == 0 {
+			return s.noopTask
+		}
+		return s.newNoopTask(tags)
+	}
 	var initOnce sync.Once
 	var f *Func
 	return Task(func(ctx *context.Context,
@@ -212,10 +375,19 @@ func (s *Scope) Task(tags ...SeriesTag) Task {
 		if ctx == &taskSecret && taskArgs(f, args) {
 			return nil
 		}
+		if !s.Enabled() {
+			return disabledExit
+		}
 		initOnce.Do(func() {
 			f = s.FuncNamed(callerFunc(3), tags...)
 		})
-		s, exit := newSpan(*ctx, f, args, nil, nil)
+		if sampledOnly {
+			parent := SpanFromCtx(*ctx)
+			if parent == nil || !parent.trace.sampled() {
+				return observeOnly(f, parent)
+			}
+		}
+		s, exit := newSpan(*ctx, f, args, nil, nil, checkCtx)
 		if ctx != &unparented {
 			*ctx = s
 		}
@@ -241,7 +413,27 @@ func (f *Func) Task(ctx *context.Context, args ...interface{}) func(*error) {
 	if ctx == &taskSecret && taskArgs(f, args) {
 		return nil
 	}
-	s, exit := newSpan(*ctx, f, args, nil, nil)
+	if !f.scope.Enabled() {
+		return disabledExit
+	}
+	s, exit := newSpan(*ctx, f, args, nil, nil, false)
+	if ctx != &unparented {
+		*ctx = s
+	}
+	return exit
+}
+
+// TaskCtx is like Task, but additionally records context cancellation. See
+// Scope.TaskCtx.
+func (f *Func) TaskCtx(ctx *context.Context, args ...interface{}) func(*error) {
+	ctx = cleanCtx(ctx)
+	if ctx == &taskSecret && taskArgs(f, args) {
+		return nil
+	}
+	if !f.scope.Enabled() {
+		return disabledExit
+	}
+	s, exit := newSpan(*ctx, f, args, nil, nil, true)
 	if ctx != &unparented {
 		*ctx = s
 	}
@@ -251,37 +443,78 @@ func (f *Func) Task(ctx *context.Context, args ...interface{}) func(*error) {
 // RemoteTrace is like Func.Task, except you can specify the trace and parent
 // span id.
 // Needed for things like the Zipkin plugin.
+// If trace has no sampling decision of its own but ctx already belongs to a
+// trace that does, trace inherits that decision. See Registry.SetSampler.
 func (f *Func) RemoteTrace(ctx *context.Context, parentId int64, trace *Trace,
 	args ...interface{}) func(*error) {
 	ctx = cleanCtx(ctx)
+	if !f.scope.Enabled() {
+		return disabledExit
+	}
 	if trace != nil {
+		if current := SpanFromCtx(*ctx); current != nil {
+			inheritSampling(trace, current.trace)
+		}
 		f.scope.r.observeTrace(trace)
 	}
-	s, exit := newSpan(*ctx, f, args, trace, &parentId)
+	s, exit := newSpan(*ctx, f, args, trace, &parentId, false)
 	if ctx != &unparented {
 		*ctx = s
 	}
 	return exit
 }
 
-// ResetTrace is like Func.Task, except it always creates a new Trace.
+// ResetTrace is like Func.Task, except it always creates a new Trace. The new
+// Trace inherits the sampling decision of the trace ctx belongs to, if any.
 func (f *Func) ResetTrace(ctx *context.Context,
 	args ...interface{}) func(*error) {
 	ctx = cleanCtx(ctx)
 	if ctx == &taskSecret && taskArgs(f, args) {
 		return nil
 	}
-	trace := NewTrace(NewId())
+	if !f.scope.Enabled() {
+		return disabledExit
+	}
+	trace := NewTrace(f.scope.r.newId())
+	if current := SpanFromCtx(*ctx); current != nil {
+		inheritSampling(trace, current.trace)
+	}
 	f.scope.r.observeTrace(trace)
-	s, exit := newSpan(*ctx, f, args, trace, nil)
+	s, exit := newSpan(*ctx, f, args, trace, nil, false)
 	if ctx != &unparented {
 		*ctx = s
 	}
 	return exit
 }
 
+// observeOnly times a call of f without starting a Span, for Funcs of
+// unsampled traces. See Scope.TaskIfSampled.
+func observeOnly(f *Func, parent *Span) func(*error) {
+	var parentFunc *Func
+	if parent != nil {
+		parentFunc = parent.f
+	}
+	f.start(parentFunc)
+	start := f.scope.r.now()
+	return func(errptr *error) {
+		rec := recover()
+		panicked := rec != nil
+		var err error
+		if errptr != nil {
+			err = *errptr
+		}
+		f.end(err, panicked, f.scope.r.now().Sub(start))
+		if panicked {
+			panic(rec)
+		}
+	}
+}
+
 var unparented = context.Background()
 
+// disabledExit is returned by Tasks of disabled Scopes.
+func disabledExit(*error) {}
+
 func cleanCtx(ctx *context.Context) *context.Context {
 	if ctx == nil {
 		return &unparented
@@ -2,6 +2,9 @@ package monkit
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 )
@@ -10,7 +13,7 @@ import (
 // begun, the original span that started the trace will also be observed
 func TestLateObserver(t *testing.T) {
 	ctx := context.Background()
-	mon := Package()
+	mon := NewRegistry().Package()
 	mock := &mockSpanObserver{}
 	func() {
 		// Start the first span, this is the trace
@@ -84,3 +87,267 @@ func BenchmarkTaskNested(b *testing.B) {
 		}()
 	}
 }
+
+func TestTaskCtx(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	func() {
+		ctx := context.Background()
+		defer mon.FuncNamed("quiet").TaskCtx(&ctx)(nil)
+	}()
+	for _, field := range []string{"cancelled", "deadline_exceeded"} {
+		key := "function,name=quiet,scope=test " + field
+		if _, ok := Collect(mon)[key]; ok {
+			t.Fatalf("expected %s not to be reported before it happens", field)
+		}
+	}
+
+	var span *Span
+	func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer mon.TaskCtx()(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+		cancel()
+	}()
+	f := span.Func()
+	annotations := span.Annotations()
+
+	if f.Cancelled() != 1 || f.DeadlineExceeded() != 0 {
+		t.Fatalf("unexpected counts: %d %d", f.Cancelled(), f.DeadlineExceeded())
+	}
+	if len(annotations) == 0 || annotations[0].Name != "cancelled" {
+		t.Fatalf("unexpected annotations: %v", annotations)
+	}
+
+	func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+		defer f.TaskCtx(&ctx)(nil)
+	}()
+	if f.DeadlineExceeded() != 1 {
+		t.Fatalf("expected deadline exceeded to be counted")
+	}
+
+	stats := Collect(mon)
+	if stats["function,name="+f.ShortName()+",scope=test cancelled"] != 1 {
+		t.Fatalf("missing cancelled stat: %v", stats)
+	}
+}
+
+func TestTrace128(t *testing.T) {
+	id := NewId128()
+	trace := NewTrace128(id)
+	if trace.Id128() != id {
+		t.Fatalf("expected %s, got %s", id, trace.Id128())
+	}
+	if trace.Id() != id.Low() {
+		t.Fatalf("expected Id to return the low 64 bits")
+	}
+	if got := NewTrace(5).Id128(); got != TraceIdFromInt64(5) || got.High() != 0 {
+		t.Fatalf("unexpected 64-bit trace id: %s", got)
+	}
+}
+
+func TestTraceBaggage(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	trace := NewTrace(NewId())
+	trace.SetBaggage("tenant", "acme")
+
+	all := trace.AllBaggage()
+	all["tenant"] = "changed"
+	if val, ok := trace.Baggage("tenant"); !ok || val != "acme" {
+		t.Fatalf("unexpected baggage: %q %v", val, ok)
+	}
+
+	ctx := context.Background()
+	defer mon.Func().RemoteTrace(&ctx, 0, trace)(nil)
+	if val, ok := BaggageFromCtx(ctx, "tenant"); !ok || val != "acme" {
+		t.Fatalf("expected baggage from ctx, got %q %v", val, ok)
+	}
+	if _, ok := BaggageFromCtx(context.Background(), "tenant"); ok {
+		t.Fatalf("expected no baggage without a span")
+	}
+}
+
+func TestTaskIfSampled(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	task := mon.TaskIfSampled()
+
+	run := func(ctx context.Context) (span *Span) {
+		func() {
+			err := io.EOF
+			defer task(&ctx)(&err)
+			span = SpanFromCtx(ctx)
+		}()
+		return span
+	}
+
+	if run(context.Background()) != nil {
+		t.Fatalf("expected no span without a trace")
+	}
+
+	ctx := context.Background()
+	defer mon.Task()(&ctx)(nil)
+	parent := SpanFromCtx(ctx)
+	if run(ctx) != parent {
+		t.Fatalf("expected no span for an unsampled trace")
+	}
+
+	parent.Trace().Set(SampledKey, true)
+	span := run(ctx)
+	if span == parent || span.Parent() != parent {
+		t.Fatalf("expected a child span for a sampled trace")
+	}
+
+	f := span.Func()
+	if errs := f.Errors(); errs["EOF"] != 3 {
+		t.Fatalf("expected every call to be counted, got %v", errs)
+	}
+	found := false
+	f.Parents(func(p *Func) { found = found || p == parent.Func() })
+	if !found {
+		t.Fatalf("expected the enclosing func to be recorded as a parent")
+	}
+}
+
+func TestTraceBinary(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	trace := NewTrace128(NewId128())
+	trace.Set(SampledKey, true)
+	trace.SetBaggage("tenant", "acme")
+	trace.SetBaggage("origin", "queue")
+
+	ctx := context.Background()
+	defer mon.Func().RemoteTrace(&ctx, 0, trace)(nil)
+	span := SpanFromCtx(ctx)
+
+	decoded, parentId, err := UnmarshalTraceBinary(span.MarshalTraceBinary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Id128() != trace.Id128() || parentId != span.Id() {
+		t.Fatalf("unexpected ids: %v %d", decoded.Id128(), parentId)
+	}
+	if sampled, ok := decoded.Get(SampledKey).(bool); !ok || !sampled {
+		t.Fatalf("expected the sampling decision to round trip")
+	}
+	if all := decoded.AllBaggage(); len(all) != 2 ||
+		all["tenant"] != "acme" || all["origin"] != "queue" {
+		t.Fatalf("unexpected baggage: %v", all)
+	}
+
+	// without a parent or a decision, neither is decoded
+	data, err := NewTrace(5).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, parentId, err = UnmarshalTraceBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Id() != 5 || decoded.Id128().High() != 0 || parentId != 0 ||
+		decoded.Get(SampledKey) != nil || len(data) != 11 {
+		t.Fatalf("unexpected trace %d, parent %d, %d bytes",
+			decoded.Id(), parentId, len(data))
+	}
+
+	for _, bad := range [][]byte{nil, {2, 0}, data[:5], data[:len(data)-1],
+		append(data[:len(data)-1:len(data)-1], 1, 5, 'a')} {
+		if _, _, err := UnmarshalTraceBinary(bad); err == nil {
+			t.Fatalf("expected an error decoding %v", bad)
+		}
+	}
+}
+
+func TestTraceBinaryBaggageLimits(t *testing.T) {
+	header := func(entries uint64) []byte {
+		data, _ := NewTrace(5).MarshalBinary()
+		return appendUvarint(data[:len(data)-1], entries)
+	}
+
+	// too many entries are rejected before any is read
+	_, _, err := UnmarshalTraceBinary(header(1 << 40))
+	if err != errTraceBinaryBaggage {
+		t.Fatalf("expected too many entries to be rejected, got %v", err)
+	}
+	// as are entries past the size limit
+	big := strings.Repeat("x", maxTraceBinaryBaggageSize/2)
+	data := header(2)
+	for _, s := range []string{"a", big, "b", big} {
+		data = appendString(data, s)
+	}
+	if _, _, err = UnmarshalTraceBinary(data); err != errTraceBinaryBaggage {
+		t.Fatalf("expected too much baggage to be rejected, got %v", err)
+	}
+
+	// encoding stops at the limits, so what is encoded can be decoded
+	trace := NewTrace(5)
+	for i := 0; i < 2*maxTraceBinaryBaggageEntries; i++ {
+		trace.SetBaggage(fmt.Sprintf("key%03d", i), "val")
+	}
+	data, _ = trace.MarshalBinary()
+	decoded, _, err := UnmarshalTraceBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := decoded.AllBaggage()
+	if len(all) != maxTraceBinaryBaggageEntries || all["key000"] != "val" {
+		t.Fatalf("unexpected baggage: %d entries", len(all))
+	}
+}
+
+func TestTraceDuration(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	now := time.Unix(100, 0)
+	r.SetClock(func() time.Time { return now })
+
+	var trace *Trace
+	func() {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		trace = SpanFromCtx(ctx).Trace()
+		for i := 0; i < 2; i++ {
+			func() {
+				ctx := ctx
+				defer mon.TaskNamed("child")(&ctx)(nil)
+				now = now.Add(time.Second)
+			}()
+		}
+		if trace.Duration() != 2*time.Second {
+			t.Fatalf("unexpected duration while running: %v", trace.Duration())
+		}
+		now = now.Add(time.Second)
+	}()
+
+	if trace.SpanCount() != 3 || trace.Spans() != 0 {
+		t.Fatalf("unexpected span counts: %d total, %d running",
+			trace.SpanCount(), trace.Spans())
+	}
+	if trace.Duration() != 3*time.Second {
+		t.Fatalf("unexpected duration: %v", trace.Duration())
+	}
+}
+
+func TestTraceDurationAtEpoch(t *testing.T) {
+	// spans starting at the Unix epoch used to be mistaken for unset times
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	now := time.Unix(0, 0)
+	r.SetClock(func() time.Time { return now })
+
+	ctx := context.Background()
+	finish := mon.Task()(&ctx)
+	trace := SpanFromCtx(ctx).Trace()
+	if trace.Duration() != 0 {
+		t.Fatalf("expected no duration before any span finished, got %v",
+			trace.Duration())
+	}
+	now = now.Add(time.Second)
+	finish(nil)
+	if trace.Duration() != time.Second || trace.SpanCount() != 1 {
+		t.Fatalf("unexpected duration %v and span count %d", trace.Duration(),
+			trace.SpanCount())
+	}
+}
@@ -15,6 +15,8 @@
 package monkit
 
 import (
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,6 +28,8 @@ var (
 	// If Window is > 0, the probability of replacing a datapoint will never
 	// fall below ReservoirSize/Window instead of continuing to fall over time.
 	// Window should be a multiple of ReservoirSize.
+	// Distributions with a non-default reservoir size scale Window by the
+	// same factor.
 	Window int64 = 1024
 )
 
@@ -48,7 +52,18 @@ func (p float32Slice) Less(i, j int) bool {
 //go:generate sh -c "m4 -D_IMPORT_= -D_NAME_=Int -D_LOWER_NAME_=int -D_TYPE_=int64 distgen.go.m4 > intdist.go"
 //go:generate gofmt -w -s durdist.go floatdist.go intdist.go
 
+// SetUnit changes the unit durations are reported in by Stats. By default,
+// durations are reported as seconds. For example, a unit of time.Millisecond
+// reports durations as milliseconds. Observed values are not affected, only
+// how they are reported.
+func (d *DurationDist) SetUnit(unit time.Duration) {
+	d.unit = unit
+}
+
 func (d *DurationDist) toFloat64(v time.Duration) float64 {
+	if d.unit > 0 {
+		return float64(v) / float64(d.unit)
+	}
 	return v.Seconds()
 }
 
@@ -59,3 +74,12 @@ func (d *IntDist) toFloat64(v int64) float64 {
 func (d *FloatDist) toFloat64(v float64) float64 {
 	return v
 }
+
+// percentileField returns the Stats field name of a reservoir percentile,
+// such as r99 for 99 or r99_9 for 99.9. Decimal points are written as
+// underscores so that field names stay free of dots, which presenters such
+// as graphite and statsd use to separate the parts of metric names.
+func percentileField(percentile float64) string {
+	return "r" + strings.Replace(
+		strconv.FormatFloat(percentile, 'f', -1, 64), ".", "_", 1)
+}
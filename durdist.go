@@ -19,6 +19,7 @@
 package monkit
 
 import (
+	"math"
 	"sort"
 	"time"
 )
@@ -42,10 +43,12 @@ type DurationDist struct {
 	// reset.
 	Sum time.Duration
 
-	key       SeriesKey
-	reservoir [ReservoirSize]float32
-	rng       xorshift128
-	sorted    bool
+	key         SeriesKey
+	reservoir   []float32
+	rng         xorshift128
+	sorted      bool
+	percentiles []float64
+	unit        time.Duration
 }
 
 func initDurationDist(v *DurationDist, key SeriesKey) {
@@ -75,28 +78,156 @@ func (d *DurationDist) Insert(val time.Duration) {
 	}
 	d.Recent = val
 	d.Sum += val
+	d.sample(float32(val))
+}
+
+// InsertN adds a value to the distribution as if Insert had been called n
+// times with it. Values with n <= 0 are ignored. For n larger than the
+// reservoir, the reservoir is updated in closed form instead of drawing for
+// every insert, so the cost is bounded by the reservoir size no matter how
+// large n is.
+func (d *DurationDist) InsertN(val time.Duration, n int64) {
+	if n <= 0 {
+		return
+	}
+	if d.Count != 0 {
+		if val < d.Low {
+			d.Low = val
+		}
+		if val > d.High {
+			d.High = val
+		}
+	} else {
+		d.Low = val
+		d.High = val
+	}
+	d.Recent = val
+	d.Sum += val * time.Duration(n)
+
+	reservoir := d.samples()
+	size := int64(len(reservoir))
+	for ; n > 0 && (n <= size || d.Count < size); n-- {
+		d.sample(float32(val))
+	}
+	if n == 0 {
+		return
+	}
+
+	// every slot is overwritten independently with the probability that at
+	// least one of the n inserts would have picked it.
+	keep := d.survival(n)
+	d.Count += n
+	for i := range reservoir {
+		if d.randFloat() >= keep {
+			reservoir[i] = float32(val)
+			d.sorted = false
+		}
+	}
+}
+
+// InsertWeighted adds a value to the distribution with the given weight,
+// such as the inverse of the rate it was sampled at. Since the distribution
+// counts whole observations, a fractional weight is rounded up or down at
+// random so that the expected count, and with it the expected sum, match
+// the weight. Weights that aren't positive are ignored, and weights above
+// 2^62 are capped there.
+func (d *DurationDist) InsertWeighted(val time.Duration, weight float64) {
+	if !(weight > 0) {
+		return
+	}
+	if weight > 1<<62 {
+		weight = 1 << 62
+	}
+	n := int64(weight)
+	if frac := weight - float64(n); frac > 0 && d.randFloat() < frac {
+		n++
+	}
+	d.InsertN(val, n)
+}
+
+// randFloat returns a uniformly distributed value in [0, 1).
+func (d *DurationDist) randFloat() float64 {
+	return float64(d.rng.Uint64()>>11) / (1 << 53)
+}
+
+// survival returns the probability that a slot of the full reservoir is not
+// replaced by any of n more inserts. Insert number i picks each slot with
+// probability 1/w_i, where the window w_i is the count after the insert,
+// capped at windowLimit. While the window grows, the product of 1-1/w
+// telescopes to count/(count+n); once it is capped, each insert keeps the
+// slot with the same probability 1-1/limit.
+func (d *DurationDist) survival(n int64) float64 {
+	count, limit := d.Count, d.windowLimit()
+	growing := n
+	if limit > 0 {
+		growing = limit - count
+		if growing < 0 {
+			growing = 0
+		} else if growing > n {
+			growing = n
+		}
+	}
+	keep := 1.0
+	if growing > 0 {
+		keep = float64(count) / float64(count+growing)
+	}
+	if capped := n - growing; capped > 0 {
+		keep *= math.Exp(float64(capped) * math.Log1p(-1/float64(limit)))
+	}
+	return keep
+}
+
+// windowLimit returns Window scaled to the size of the reservoir.
+func (d *DurationDist) windowLimit() int64 {
+	// careful, the capitalization of Window is important. it is scaled along
+	// with the reservoir so that sized reservoirs keep the same minimum
+	// replacement probability.
+	return Window * int64(len(d.samples())) / ReservoirSize
+}
 
+// sample counts a value and adds it to the reservoir if it is chosen.
+func (d *DurationDist) sample(val float32) {
+	reservoir := d.samples()
+	size := int64(len(reservoir))
 	index := d.Count
 	d.Count += 1
 
-	if index < ReservoirSize {
-		d.reservoir[index] = float32(val)
+	if index < size {
+		reservoir[index] = val
 		d.sorted = false
 	} else {
 		window := d.Count
-		// careful, the capitalization of Window is important
-		if Window > 0 && window > Window {
-			window = Window
+		if limit := d.windowLimit(); limit > 0 && window > limit {
+			window = limit
 		}
 		// fast, but kind of biased. probably okay
 		j := d.rng.Uint64() % uint64(window)
-		if j < ReservoirSize {
-			d.reservoir[int(j)] = float32(val)
+		if j < uint64(size) {
+			reservoir[int(j)] = val
 			d.sorted = false
 		}
 	}
 }
 
+// samples returns the reservoir, allocating it with the default size if it
+// hasn't been allocated yet.
+func (d *DurationDist) samples() []float32 {
+	if d.reservoir == nil {
+		d.reservoir = make([]float32, ReservoirSize)
+	}
+	return d.reservoir
+}
+
+// setReservoirSize changes the number of samples kept for quantile
+// estimation. It must be called before any values are inserted. Sizes less
+// than 1 use the default of ReservoirSize.
+func (d *DurationDist) setReservoirSize(size int) {
+	if size < 1 {
+		size = ReservoirSize
+	}
+	d.reservoir = make([]float32, size)
+}
+
 // FullAverage calculates and returns the average of all inserted values.
 func (d *DurationDist) FullAverage() time.Duration {
 	if d.Count > 0 {
@@ -107,7 +238,8 @@ func (d *DurationDist) FullAverage() time.Duration {
 
 // ReservoirAverage calculates the average of the current reservoir.
 func (d *DurationDist) ReservoirAverage() time.Duration {
-	amount := ReservoirSize
+	reservoir := d.samples()
+	amount := len(reservoir)
 	if d.Count < int64(amount) {
 		amount = int(d.Count)
 	}
@@ -116,7 +248,7 @@ func (d *DurationDist) ReservoirAverage() time.Duration {
 	}
 	var sum float32
 	for i := 0; i < amount; i++ {
-		sum += d.reservoir[i]
+		sum += reservoir[i]
 	}
 	return time.Duration(sum / float32(amount))
 }
@@ -124,16 +256,17 @@ func (d *DurationDist) ReservoirAverage() time.Duration {
 // Query will return the approximate value at the given quantile from the
 // reservoir, where 0 <= quantile <= 1.
 func (d *DurationDist) Query(quantile float64) time.Duration {
-	rlen := int(ReservoirSize)
+	reservoir := d.samples()
+	rlen := len(reservoir)
 	if int64(rlen) > d.Count {
 		rlen = int(d.Count)
 	}
 
 	if rlen < 2 {
-		return time.Duration(d.reservoir[0])
+		return time.Duration(reservoir[0])
 	}
 
-	reservoir := d.reservoir[:rlen]
+	reservoir = reservoir[:rlen]
 	if !d.sorted {
 		sort.Sort(float32Slice(reservoir))
 		d.sorted = true
@@ -158,9 +291,27 @@ func (d *DurationDist) Query(quantile float64) time.Duration {
 func (d *DurationDist) Copy() *DurationDist {
 	cp := *d
 	cp.rng = newXORShift128()
+	if d.reservoir != nil {
+		cp.reservoir = append([]float32(nil), d.reservoir...)
+	}
 	return &cp
 }
 
+// SetPercentiles changes the reservoir percentiles reported by Stats. Each
+// percentile is given as a value between 0 and 100 and is reported with a
+// field name of "r" followed by the percentile, with an underscore for the
+// decimal point, e.g. 99.9 is reported as "r99_9". The min and max of the
+// reservoir are always reported as rmin and rmax. Passing nil restores the
+// default set of r10, r50, r90, and r99.
+func (d *DurationDist) SetPercentiles(percentiles []float64) {
+	if percentiles == nil {
+		d.percentiles = nil
+		return
+	}
+	d.percentiles = append([]float64(nil), percentiles...)
+}
+
+// Reset clears all observed values from the distribution.
 func (d *DurationDist) Reset() {
 	d.Low, d.High, d.Recent, d.Count, d.Sum = 0, 0, 0, 0, 0
 	// resetting count will reset the quantile reservoir
@@ -176,10 +327,16 @@ func (d *DurationDist) Stats(cb func(key SeriesKey, field string, val float64))
 		cb(d.key, "max", d.toFloat64(d.High))
 		cb(d.key, "rmin", d.toFloat64(d.Query(0)))
 		cb(d.key, "ravg", d.toFloat64(d.ReservoirAverage()))
-		cb(d.key, "r10", d.toFloat64(d.Query(.1)))
-		cb(d.key, "r50", d.toFloat64(d.Query(.5)))
-		cb(d.key, "r90", d.toFloat64(d.Query(.9)))
-		cb(d.key, "r99", d.toFloat64(d.Query(.99)))
+		if d.percentiles == nil {
+			cb(d.key, "r10", d.toFloat64(d.Query(.1)))
+			cb(d.key, "r50", d.toFloat64(d.Query(.5)))
+			cb(d.key, "r90", d.toFloat64(d.Query(.9)))
+			cb(d.key, "r99", d.toFloat64(d.Query(.99)))
+		} else {
+			for _, p := range d.percentiles {
+				cb(d.key, percentileField(p), d.toFloat64(d.Query(p/100)))
+			}
+		}
 		cb(d.key, "rmax", d.toFloat64(d.Query(1)))
 		cb(d.key, "recent", d.toFloat64(d.Recent))
 	}
@@ -16,6 +16,7 @@ package environment
 
 import (
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -38,3 +39,20 @@ func fdCount() (count int, err error) {
 	}
 	return int(procCount), nil
 }
+
+func cpuTime() (user, system time.Duration, ok bool) {
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, 0, false
+	}
+	var creation, exit, kernel, usr syscall.Filetime
+	err = syscall.GetProcessTimes(h, &creation, &exit, &kernel, &usr)
+	if err != nil {
+		return 0, 0, false
+	}
+	// Filetimes count 100-nanosecond intervals.
+	toDuration := func(ft syscall.Filetime) time.Duration {
+		return time.Duration(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) * 100
+	}
+	return toDuration(usr), toDuration(kernel), true
+}
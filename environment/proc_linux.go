@@ -17,6 +17,7 @@ package environment
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 
 	"github.com/spacemonkeygo/monkit/v3"
 )
@@ -35,6 +36,15 @@ func proc(cb func(key monkit.SeriesKey, field string, val float64)) {
 	}
 }
 
+func memoryUsage() (resident, virtual int64, ok bool) {
+	var statm procSelfStatm
+	if err := readProcSelfStatm(&statm); err != nil {
+		return 0, 0, false
+	}
+	pageSize := int64(os.Getpagesize())
+	return int64(statm.Resident) * pageSize, int64(statm.Size) * pageSize, true
+}
+
 type procSelfStat struct {
 	Pid                 int64
 	Comm                string
@@ -19,3 +19,5 @@ package environment
 import "github.com/spacemonkeygo/monkit/v3"
 
 func proc(cb func(series monkit.SeriesKey, field string, val float64)) {}
+
+func memoryUsage() (resident, virtual int64, ok bool) { return 0, 0, false }
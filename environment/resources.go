@@ -0,0 +1,49 @@
+// Copyright (C) 2016 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package environment
+
+import (
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// Resources returns a StatSource with the process' resource usage under
+// process_resources: resident and virtual memory in bytes (resident_bytes,
+// virtual_bytes), the number of open file descriptors (open_fds), and the
+// cumulative user and system CPU time in seconds (cpu_user_seconds,
+// cpu_system_seconds). Values that are not available on the current platform
+// are left out. Unlike the other StatSources in this package, Resources is not
+// added by Register. See RegisterProc.
+func Resources() monkit.StatSource {
+	key := monkit.NewSeriesKey("process_resources")
+	return monkit.StatSourceFunc(func(cb func(key monkit.SeriesKey, field string, val float64)) {
+		if resident, virtual, ok := memoryUsage(); ok {
+			cb(key, "resident_bytes", float64(resident))
+			cb(key, "virtual_bytes", float64(virtual))
+		}
+		if fds, err := fdCount(); err == nil {
+			cb(key, "open_fds", float64(fds))
+		}
+		if user, system, ok := cpuTime(); ok {
+			cb(key, "cpu_user_seconds", user.Seconds())
+			cb(key, "cpu_system_seconds", system.Seconds())
+		}
+	})
+}
+
+// RegisterProc attaches the process' resource usage to the given scope. See
+// Resources.
+func RegisterProc(scope *monkit.Scope) {
+	scope.Chain(Resources())
+}
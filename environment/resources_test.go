@@ -0,0 +1,37 @@
+// Copyright (C) 2016 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package environment
+
+import (
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestResources(t *testing.T) {
+	stats := monkit.Collect(Resources())
+	for _, field := range []string{"resident_bytes", "virtual_bytes", "open_fds"} {
+		if stats["process_resources "+field] <= 0 {
+			t.Fatalf("expected positive %s: %v", field, stats)
+		}
+	}
+	for _, field := range []string{"cpu_user_seconds", "cpu_system_seconds"} {
+		if _, ok := stats["process_resources "+field]; !ok {
+			t.Fatalf("missing %s: %v", field, stats)
+		}
+	}
+}
@@ -17,36 +17,124 @@ package environment
 import (
 	"runtime"
 	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/spacemonkeygo/monkit/v3"
+	"github.com/spacemonkeygo/monkit/v3/monotime"
 )
 
+// RuntimeMetrics selects which groups of Go runtime metrics are reported by
+// RuntimeMetricsSource. Groups can be combined with |.
+type RuntimeMetrics int
+
+const (
+	// RuntimeGoroutines reports the number of goroutines as goroutines count.
+	RuntimeGoroutines RuntimeMetrics = 1 << iota
+	// RuntimeMemStats reports all of runtime.MemStats, such as HeapAlloc and
+	// HeapObjects, under runtime_memstats.
+	RuntimeMemStats
+	// RuntimeGCPauses reports the distribution of GC pause times under
+	// runtime_gcstats.
+	RuntimeGCPauses
+	// RuntimeCgoCalls reports the number of cgo calls made as
+	// runtime_cgo calls.
+	RuntimeCgoCalls
+
+	// RuntimeAll selects all of the runtime metrics.
+	RuntimeAll = RuntimeGoroutines | RuntimeMemStats | RuntimeGCPauses |
+		RuntimeCgoCalls
+)
+
+// memStatsMaxAge is how long runtime.MemStats are reused before being read
+// again, so that several stat walks in a row don't each stop the world.
+const memStatsMaxAge = time.Second
+
 // Runtime returns a StatSource that includes information gathered from the
 // Go runtime, including the number of goroutines currently running, and
 // other live memory data. Not expected to be called directly, as this
 // StatSource is added by Register.
 func Runtime() monkit.StatSource {
-	durDist := monkit.NewDurationDist(monkit.NewSeriesKey("runtime_gcstats"))
-	lastNumGC := int64(0)
+	return RuntimeMetricsSource(RuntimeAll)
+}
+
+// RuntimeMetricsSource is like Runtime but only reports the selected groups
+// of metrics. runtime.ReadMemStats, which stops the world, is called at most
+// once per second no matter how often the stats are walked.
+func RuntimeMetricsSource(metrics RuntimeMetrics) monkit.StatSource {
+	rs := &runtimeSource{
+		metrics: metrics,
+		pauses:  monkit.NewDurationDist(monkit.NewSeriesKey("runtime_gcstats")),
+	}
+	return monkit.StatSourceFunc(rs.Stats)
+}
+
+// RegisterRuntime attaches the selected groups of Go runtime metrics to the
+// given scope.
+func RegisterRuntime(scope *monkit.Scope, metrics RuntimeMetrics) {
+	scope.Chain(RuntimeMetricsSource(metrics))
+}
 
-	return monkit.StatSourceFunc(func(cb func(key monkit.SeriesKey, field string, val float64)) {
+type runtimeSource struct {
+	metrics RuntimeMetrics
+
+	mtx          sync.Mutex
+	memStats     runtime.MemStats
+	memStatsRead time.Time
+	lastNumGC    int64
+	pauses       *monkit.DurationDist
+}
+
+func (rs *runtimeSource) Stats(cb func(key monkit.SeriesKey, field string, val float64)) {
+	if rs.metrics&RuntimeGoroutines != 0 {
 		cb(monkit.NewSeriesKey("goroutines"), "count", float64(runtime.NumGoroutine()))
+	}
+
+	if rs.metrics&RuntimeCgoCalls != 0 {
+		cb(monkit.NewSeriesKey("runtime_cgo"), "calls", float64(runtime.NumCgoCall()))
+	}
+
+	if rs.metrics&RuntimeMemStats != 0 {
+		monkit.StatSourceFromStruct(monkit.NewSeriesKey("runtime_memstats"),
+			rs.readMemStats()).Stats(cb)
+	}
+
+	if rs.metrics&RuntimeGCPauses != 0 {
+		rs.gcPauses().Stats(cb)
+	}
+}
+
+// readMemStats returns recent runtime.MemStats, reading them again only if
+// the cached ones are too old.
+func (rs *runtimeSource) readMemStats() runtime.MemStats {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	now := monotime.Now()
+	if rs.memStatsRead.IsZero() || now.Sub(rs.memStatsRead) >= memStatsMaxAge {
+		runtime.ReadMemStats(&rs.memStats)
+		rs.memStatsRead = now
+	}
+	return rs.memStats
+}
+
+// gcPauses adds the GC pauses that happened since the last call to the pause
+// distribution, and returns a copy of it.
+func (rs *runtimeSource) gcPauses() *monkit.DurationDist {
+	var stats debug.GCStats
+	debug.ReadGCStats(&stats)
 
-		{
-			var stats runtime.MemStats
-			runtime.ReadMemStats(&stats)
-			monkit.StatSourceFromStruct(monkit.NewSeriesKey("runtime_memstats"), stats).Stats(cb)
-		}
-
-		{
-			var stats debug.GCStats
-			debug.ReadGCStats(&stats)
-			if lastNumGC != stats.NumGC && len(stats.Pause) > 0 {
-				durDist.Insert(stats.Pause[0])
-			}
-			durDist.Stats(cb)
-		}
-	})
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	// stats.Pause is most recent first, and only holds so many pauses.
+	newPauses := stats.NumGC - rs.lastNumGC
+	if newPauses > int64(len(stats.Pause)) {
+		newPauses = int64(len(stats.Pause))
+	}
+	for i := newPauses - 1; i >= 0; i-- {
+		rs.pauses.Insert(stats.Pause[i])
+	}
+	rs.lastNumGC = stats.NumGC
+	return rs.pauses.Copy()
 }
 
 func init() { registrations = append(registrations, Runtime()) }
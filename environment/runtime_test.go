@@ -0,0 +1,47 @@
+// Copyright (C) 2016 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package environment
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestRuntimeMetricsSource(t *testing.T) {
+	runtime.GC()
+	runtime.GC()
+
+	stats := monkit.Collect(RuntimeMetricsSource(RuntimeGoroutines | RuntimeGCPauses))
+	if stats["goroutines count"] < 1 {
+		t.Fatalf("expected goroutines: %v", stats)
+	}
+	if stats["runtime_gcstats count"] < 2 {
+		t.Fatalf("expected every gc pause to be recorded: %v", stats)
+	}
+	if _, ok := stats["runtime_memstats HeapAlloc"]; ok {
+		t.Fatalf("expected memstats to be left out: %v", stats)
+	}
+
+	stats = monkit.Collect(RuntimeMetricsSource(RuntimeMemStats | RuntimeCgoCalls))
+	if stats["runtime_memstats HeapAlloc"] <= 0 ||
+		stats["runtime_memstats HeapObjects"] <= 0 {
+		t.Fatalf("expected heap stats: %v", stats)
+	}
+	if _, ok := stats["runtime_cgo calls"]; !ok {
+		t.Fatalf("expected cgo calls: %v", stats)
+	}
+}
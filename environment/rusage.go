@@ -18,6 +18,7 @@ package environment
 
 import (
 	"syscall"
+	"time"
 
 	"github.com/spacemonkeygo/monkit/v3"
 )
@@ -35,4 +36,12 @@ func Rusage() monkit.StatSource {
 	})
 }
 
+func cpuTime() (user, system time.Duration, ok bool) {
+	var rusage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return 0, 0, false
+	}
+	return time.Duration(rusage.Utime.Nano()), time.Duration(rusage.Stime.Nano()), true
+}
+
 func init() { registrations = append(registrations, Rusage()) }
@@ -0,0 +1,86 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3/monotime"
+)
+
+// EventCounter counts occurrences of a discrete event, such as a deploy, a
+// cache flush or a leader election, and remembers when it last happened.
+// Unlike a Meter, it doesn't track rates, and marking it is lock-free, so the
+// EventCounter should be retrieved once and held by the caller. Implements the
+// StatSource interface. You should construct using NewEventCounter, though
+// expected usage is like:
+//
+//   var (
+//     mon     = monkit.Package()
+//     deploys = mon.EventCounter("deploys")
+//   )
+//
+//   func Deploy() {
+//     ...
+//     deploys.Mark()
+//     ...
+//   }
+//
+type EventCounter struct {
+	// sync/atomic things
+	count int64
+	last  int64 // UnixNano of the last Mark, or 0 if there was none
+
+	scopeGate
+	key SeriesKey
+}
+
+// NewEventCounter constructs an EventCounter
+func NewEventCounter(key SeriesKey) *EventCounter {
+	return &EventCounter{key: key}
+}
+
+// Mark records that the event happened.
+func (e *EventCounter) Mark() {
+	if e.off() {
+		return
+	}
+	atomic.AddInt64(&e.count, 1)
+	atomic.StoreInt64(&e.last, monotime.Now().UnixNano())
+}
+
+// Count returns how many times the event happened.
+func (e *EventCounter) Count() int64 {
+	return atomic.LoadInt64(&e.count)
+}
+
+// SinceLast returns how long ago the event last happened. ok is false if it
+// hasn't happened yet.
+func (e *EventCounter) SinceLast() (since time.Duration, ok bool) {
+	last := atomic.LoadInt64(&e.last)
+	if last == 0 {
+		return 0, false
+	}
+	return monotime.Now().Sub(time.Unix(0, last)), true
+}
+
+// Stats implements the StatSource interface
+func (e *EventCounter) Stats(cb func(key SeriesKey, field string, val float64)) {
+	cb(e.key, "total", float64(e.Count()))
+	if since, ok := e.SinceLast(); ok {
+		cb(e.key, "seconds_since_last", since.Seconds())
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sync"
+	"time"
+)
+
+// FinishedSpan is a Span that has finished, along with how it finished.
+type FinishedSpan struct {
+	Span     *Span
+	Err      error
+	Panicked bool
+	Finish   time.Time
+}
+
+// ObserveFinish calls cb once all of the Spans of the Trace have finished,
+// with the Spans that finished after ObserveFinish was called, in the order
+// they finished, up to the Registry's trace span limit (see
+// Registry.SetTraceSpanLimit). cb is called at most once, on the goroutine that finished
+// the last Span. The returned cancel method stops observing the Trace without
+// calling cb.
+func (t *Trace) ObserveFinish(
+	cb func(t *Trace, spans []*FinishedSpan)) (cancel func()) {
+	o := newFinishObserver(t, nil, cb, true)
+	return func() { o.stop() }
+}
+
+// ObserveFinishedTraces calls cb for every new trace once all of its Spans
+// have finished, with the Spans in the order they finished. See
+// Trace.ObserveFinish. Like ObserveTraces, this only applies to traces that
+// start after ObserveFinishedTraces is called. The returned cancel method
+// stops observing traces, and calls cb for the traces that are still running
+// with the Spans that have finished so far, so exporters don't lose them.
+func (r *Registry) ObserveFinishedTraces(
+	cb func(t *Trace, spans []*FinishedSpan)) (cancel func()) {
+	return r.observeFinishedTraces(nil, cb, false)
+}
+
+// observeFinishedTraces is the basis of all of the Registry's ways to observe
+// the Spans of new traces. observer, if not nil, sees every Span start and
+// finish, and cb, if not nil, gets every finished trace.
+func (r *Registry) observeFinishedTraces(observer SpanObserver,
+	cb func(*Trace, []*FinishedSpan), sampledOnly bool) (cancel func()) {
+	w := &finishedTraceWatcher{
+		observer: observer,
+		cb:       cb,
+		traces:   map[*Trace]*finishObserver{},
+	}
+	stop := r.addWatcher(traceWatcherEntry{
+		cb:          w.observeTrace,
+		sampledOnly: sampledOnly,
+	})
+	return func() {
+		stop()
+		w.cancel()
+	}
+}
+
+type finishedTraceWatcher struct {
+	observer SpanObserver
+	cb       func(*Trace, []*FinishedSpan)
+
+	mtx      sync.Mutex
+	canceled bool
+	traces   map[*Trace]*finishObserver
+}
+
+func (w *finishedTraceWatcher) observeTrace(t *Trace) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.canceled {
+		return
+	}
+	if _, exists := w.traces[t]; exists {
+		return
+	}
+	w.traces[t] = newFinishObserver(t, w.observer, w.finished, w.cb != nil)
+}
+
+func (w *finishedTraceWatcher) finished(t *Trace, spans []*FinishedSpan) {
+	// once the last span of a trace is done, forget the trace so that it can
+	// be garbage collected.
+	w.mtx.Lock()
+	delete(w.traces, t)
+	w.mtx.Unlock()
+	if w.cb != nil {
+		w.cb(t, spans)
+	}
+}
+
+func (w *finishedTraceWatcher) cancel() {
+	w.mtx.Lock()
+	w.canceled = true
+	traces := w.traces
+	w.traces = nil
+	w.mtx.Unlock()
+	for t, o := range traces {
+		spans, stopped := o.stop()
+		if stopped && w.cb != nil && len(spans) > 0 {
+			w.cb(t, spans)
+		}
+	}
+}
+
+// finishObserver observes the Spans of a single Trace until all of them have
+// finished.
+type finishObserver struct {
+	trace    *Trace
+	observer SpanObserver
+	done     func(*Trace, []*FinishedSpan)
+	collect  bool
+
+	mtx    sync.Mutex
+	cancel func()
+	spans  []*FinishedSpan
+}
+
+func newFinishObserver(t *Trace, observer SpanObserver,
+	done func(*Trace, []*FinishedSpan), collect bool) *finishObserver {
+	o := &finishObserver{
+		trace:    t,
+		observer: observer,
+		done:     done,
+		collect:  collect,
+	}
+	o.mtx.Lock()
+	stopObserving := t.ObserveSpans(o)
+	removeHook := t.onDone(o.complete)
+	o.cancel = func() {
+		stopObserving()
+		removeHook()
+	}
+	o.mtx.Unlock()
+	return o
+}
+
+// Start implements SpanObserver.
+func (o *finishObserver) Start(s *Span) {
+	if o.observer != nil {
+		o.observer.Start(s)
+	}
+}
+
+// Finish implements SpanObserver.
+func (o *finishObserver) Finish(s *Span, err error, panicked bool,
+	finish time.Time) {
+	if o.observer != nil {
+		o.observer.Finish(s, err, panicked, finish)
+	}
+	o.mtx.Lock()
+	if o.cancel == nil {
+		o.mtx.Unlock()
+		return
+	}
+	dropped := false
+	if o.collect {
+		if len(o.spans) < s.f.scope.r.traceSpanLimit() {
+			o.spans = append(o.spans, &FinishedSpan{
+				Span: s, Err: err, Panicked: panicked, Finish: finish})
+		} else {
+			dropped = true
+		}
+	}
+	o.mtx.Unlock()
+	if dropped {
+		s.f.scope.r.spanDropped()
+	}
+}
+
+// complete is called once all of the Spans of the Trace have finished. See
+// Trace.onDone.
+func (o *finishObserver) complete() {
+	o.mtx.Lock()
+	if o.cancel == nil {
+		o.mtx.Unlock()
+		return
+	}
+	spans := o.spans
+	o.spans = nil
+	o.cancel()
+	o.cancel = nil
+	o.mtx.Unlock()
+
+	o.done(o.trace, spans)
+}
+
+// stop stops observing the Trace and returns the Spans that have finished so
+// far. stopped is false if the Trace had already finished.
+func (o *finishObserver) stop() (spans []*FinishedSpan, stopped bool) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if o.cancel == nil {
+		return nil, false
+	}
+	o.cancel()
+	o.cancel = nil
+	spans = o.spans
+	o.spans = nil
+	return spans, true
+}
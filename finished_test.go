@@ -0,0 +1,176 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestObserveFinishedTraces(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	type finished struct {
+		trace *Trace
+		spans []*FinishedSpan
+	}
+	var traces []finished
+	cancel := r.ObserveFinishedTraces(func(t *Trace, spans []*FinishedSpan) {
+		traces = append(traces, finished{trace: t, spans: spans})
+	})
+
+	childErr := errors.New("child failed")
+	var root *Span
+	func() {
+		ctx := context.Background()
+		defer mon.TaskNamed("root")(&ctx)(nil)
+		root = SpanFromCtx(ctx)
+		func() {
+			err := childErr
+			ctx := ctx
+			defer mon.TaskNamed("child")(&ctx)(&err)
+		}()
+		if len(traces) != 0 {
+			t.Fatalf("expected no calls while the root is running")
+		}
+	}()
+
+	if len(traces) != 1 || traces[0].trace != root.Trace() {
+		t.Fatalf("expected the finished trace, got %v", traces)
+	}
+	spans := traces[0].spans
+	if len(spans) != 2 || spans[0].Span.Func().ShortName() != "child" ||
+		spans[0].Err != childErr || spans[1].Span != root ||
+		spans[1].Err != nil || spans[1].Finish.Before(spans[0].Finish) {
+		t.Fatalf("expected the spans in the order they finished, got %v", spans)
+	}
+
+	// canceling reports the spans that finished so far of running traces.
+	ctx := context.Background()
+	finishRoot := mon.TaskNamed("root")(&ctx)
+	func() {
+		ctx := ctx
+		defer mon.TaskNamed("child")(&ctx)(nil)
+	}()
+	cancel()
+	if len(traces) != 2 || len(traces[1].spans) != 1 ||
+		traces[1].spans[0].Span.Func().ShortName() != "child" {
+		t.Fatalf("expected the running trace to be reported, got %v", traces)
+	}
+	finishRoot(nil)
+	if len(traces) != 2 {
+		t.Fatalf("expected no calls after cancel")
+	}
+}
+
+// yieldingObserver gives other goroutines a chance to run while it observes
+// a span finishing.
+type yieldingObserver struct{}
+
+func (yieldingObserver) Start(s *Span) {}
+
+func (yieldingObserver) Finish(s *Span, err error, panicked bool,
+	finish time.Time) {
+	time.Sleep(time.Millisecond)
+}
+
+func TestObserveFinishedTracesConcurrent(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	const traces, children = 100, 8
+
+	var mtx sync.Mutex
+	calls := map[*Trace]int{}
+	spans := map[*Trace]int{}
+	defer r.ObserveFinishedTraces(func(t *Trace, finished []*FinishedSpan) {
+		mtx.Lock()
+		calls[t]++
+		spans[t] += len(finished)
+		mtx.Unlock()
+	})()
+	defer r.ObserveTraces(func(t *Trace) { t.ObserveSpans(yieldingObserver{}) })()
+
+	var wg sync.WaitGroup
+	for i := 0; i < traces; i++ {
+		ctx := context.Background()
+		finishRoot := mon.TaskNamed("root")(&ctx)
+		start := make(chan struct{})
+		for j := 0; j < children; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx := ctx
+				finish := mon.TaskNamed("child")(&ctx)
+				<-start
+				finish(nil)
+			}()
+		}
+		// finish the root along with its children, so the last spans of the
+		// trace finish concurrently.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			finishRoot(nil)
+		}()
+		time.Sleep(time.Millisecond)
+		close(start)
+	}
+	wg.Wait()
+
+	if len(calls) != traces {
+		t.Fatalf("expected %d finished traces, got %d", traces, len(calls))
+	}
+	for trace, n := range calls {
+		if n != 1 || spans[trace] != children+1 {
+			t.Fatalf("expected one call with %d spans, got %d calls with %d",
+				children+1, n, spans[trace])
+		}
+	}
+}
+
+func TestTraceObserveFinish(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	var calls int
+	var spans []*FinishedSpan
+	ctx := context.Background()
+	finishRoot := mon.Task()(&ctx)
+	SpanFromCtx(ctx).Trace().ObserveFinish(
+		func(t *Trace, finished []*FinishedSpan) {
+			calls++
+			spans = finished
+		})
+	finishRoot(nil)
+	if calls != 1 || len(spans) != 1 || spans[0].Span.Parent() != nil {
+		t.Fatalf("expected one call with the root span, got %d %v", calls, spans)
+	}
+
+	ctx = context.Background()
+	finishRoot = mon.Task()(&ctx)
+	cancel := SpanFromCtx(ctx).Trace().ObserveFinish(
+		func(t *Trace, finished []*FinishedSpan) { calls++ })
+	cancel()
+	finishRoot(nil)
+	if calls != 1 {
+		t.Fatalf("expected no call after cancel")
+	}
+}
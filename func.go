@@ -15,7 +15,8 @@
 package monkit
 
 import (
-	"fmt"
+	"runtime"
+	"sync/atomic"
 )
 
 // Func represents a FuncStats bound to a particular function id, scope, and
@@ -33,18 +34,23 @@ import (
 type Func struct {
 	// sync/atomic things
 	FuncStats
+	maxChildren   int32
+	capturePanics int32
+	captureDeltas int32
 
 	// constructor things
-	id    int64
-	scope *Scope
-	key   SeriesKey
+	id       int64
+	scope    *Scope
+	key      SeriesKey
+	fullName string // see Registry.SetNameFormatter
 }
 
 func newFunc(s *Scope, key SeriesKey) (f *Func) {
 	f = &Func{
-		id:    NewId(),
-		scope: s,
-		key:   key,
+		id:       NewId(),
+		scope:    s,
+		key:      key,
+		fullName: s.r.formatName(s.name, key.Tags.Get("name")),
 	}
 	initFuncStats(&f.FuncStats, key)
 	return f
@@ -53,10 +59,9 @@ func newFunc(s *Scope, key SeriesKey) (f *Func) {
 // ShortName returns the name of the function within the package
 func (f *Func) ShortName() string { return f.key.Tags.Get("name") }
 
-// FullName returns the name of the function including the package
-func (f *Func) FullName() string {
-	return fmt.Sprintf("%s.%s", f.scope.name, f.key.Tags.Get("name"))
-}
+// FullName returns the name of the function including the package, or as
+// formatted by the Registry's name formatter. See Registry.SetNameFormatter.
+func (f *Func) FullName() string { return f.fullName }
 
 // Id returns a unique integer referencing this function
 func (f *Func) Id() int64 { return f.id }
@@ -69,3 +74,89 @@ func (f *Func) Scope() *Scope { return f.scope }
 func (f *Func) Parents(cb func(f *Func)) {
 	f.FuncStats.parents(cb)
 }
+
+// SetMaxChildren limits how many running child Spans each Span of this Func
+// keeps track of. Once a Span has n children running, further children still
+// run and are monitored as usual, but the Span only counts them (see
+// Span.DroppedChildren) instead of listing them in Children, so they don't
+// show up in AllSpans or the present package's span trees. Untracked children
+// are not orphaned when their parent finishes first. A limit of 0, the
+// default, keeps track of all children.
+func (f *Func) SetMaxChildren(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&f.maxChildren, int32(n))
+}
+
+// MaxChildren returns the limit set with SetMaxChildren.
+func (f *Func) MaxChildren() int {
+	return int(atomic.LoadInt32(&f.maxChildren))
+}
+
+// SetCapturePanics controls whether Spans of this Func that panic are
+// annotated with panicked=true and the panic value, formatted with fmt.Sprint.
+// Panics are always counted in the Func's panics stat and propagated
+// unchanged to the caller once the Span has finished. Formatting arbitrary
+// panic values may be expensive or have side effects, so this is off by
+// default.
+func (f *Func) SetCapturePanics(capture bool) {
+	var val int32
+	if capture {
+		val = 1
+	}
+	atomic.StoreInt32(&f.capturePanics, val)
+}
+
+// CapturePanics returns whether panics are annotated. See SetCapturePanics.
+func (f *Func) CapturePanics() bool {
+	return atomic.LoadInt32(&f.capturePanics) != 0
+}
+
+// SetCaptureRuntimeDeltas controls whether Spans of this Func measure how
+// many heap bytes were allocated and how much the number of goroutines
+// changed while they ran. Each Span is annotated with runtime.alloc_bytes
+// and runtime.goroutines, and the deltas are reported in the
+// function_alloc_bytes and function_goroutines distributions.
+//
+// This is expensive: every Span calls runtime.ReadMemStats twice, which
+// briefly stops the world. Only turn it on for the Funcs being investigated.
+// The measurements are process-wide, so they include whatever else the
+// process did concurrently, and are only meaningful when comparing many
+// Spans.
+func (f *Func) SetCaptureRuntimeDeltas(capture bool) {
+	var val int32
+	if capture {
+		val = 1
+	}
+	atomic.StoreInt32(&f.captureDeltas, val)
+}
+
+// CaptureRuntimeDeltas returns whether runtime deltas are measured. See
+// SetCaptureRuntimeDeltas.
+func (f *Func) CaptureRuntimeDeltas() bool {
+	return atomic.LoadInt32(&f.captureDeltas) != 0
+}
+
+// runtimeSample is the state of the runtime at the start of a Span. See
+// SetCaptureRuntimeDeltas.
+type runtimeSample struct {
+	allocBytes uint64
+	goroutines int
+}
+
+func sampleRuntime() *runtimeSample {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return &runtimeSample{
+		allocBytes: stats.TotalAlloc,
+		goroutines: runtime.NumGoroutine(),
+	}
+}
+
+// deltas returns how much the runtime changed since the sample was taken.
+func (start *runtimeSample) deltas() (allocBytes int64, goroutines int) {
+	end := sampleRuntime()
+	return int64(end.allocBytes - start.allocBytes),
+		end.goroutines - start.goroutines
+}
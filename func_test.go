@@ -15,7 +15,13 @@
 
 package monkit
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
 
 func TestFuncName(t *testing.T) {
 	f := Default.Package().Func()
@@ -26,3 +32,283 @@ func TestFuncName(t *testing.T) {
 		t.Fatal("invalid full name:", f.FullName())
 	}
 }
+
+func TestFuncNameFormatter(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("example.com/pkg")
+	before := mon.FuncNamed("Before")
+
+	r.SetNameFormatter(func(pkg, fn string) string { return fn })
+	if name := mon.FuncNamed("(*Server).Handle").FullName(); name != "(*Server).Handle" {
+		t.Fatalf("unexpected formatted name: %q", name)
+	}
+	if name := before.FullName(); name != "example.com/pkg.Before" {
+		t.Fatalf("expected existing funcs to keep their name, got %q", name)
+	}
+
+	r.SetNameFormatter(nil)
+	if name := mon.FuncNamed("After").FullName(); name != "example.com/pkg.After" {
+		t.Fatalf("unexpected default name: %q", name)
+	}
+}
+
+func TestFuncSLO(t *testing.T) {
+	f := NewRegistry().ScopeNamed("test").FuncNamed("slo")
+	f.end(nil, false, time.Second)
+	if _, total := f.SLO(); total != 0 {
+		t.Fatal("expected SLO tracking to be disabled by default")
+	}
+	if _, ok := Collect(f)["function,name=slo slo_total"]; ok {
+		t.Fatal("expected no SLO stats while disabled")
+	}
+
+	f.SetSLO(100 * time.Millisecond)
+	f.end(nil, false, time.Millisecond)
+	f.end(nil, false, time.Second)
+	f.end(nil, true, time.Second)
+	if violations, total := f.SLO(); violations != 2 || total != 3 {
+		t.Fatalf("unexpected SLO counts: %d/%d", violations, total)
+	}
+	stats := Collect(f)
+	if stats["function,name=slo slo_violations"] != 2 ||
+		stats["function,name=slo slo_total"] != 3 {
+		t.Fatalf("unexpected SLO stats: %v", stats)
+	}
+}
+
+func TestFuncErrorClassifier(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	f := mon.FuncNamed("classified")
+	f.SetErrorClassifier(func(err error) string {
+		if err == io.EOF {
+			return "eof"
+		}
+		return ""
+	})
+
+	var spans []*Span
+	for _, failure := range []error{io.EOF, io.EOF, errors.New("other")} {
+		func() (err error) {
+			ctx := context.Background()
+			defer f.Task(&ctx)(&err)
+			spans = append(spans, SpanFromCtx(ctx))
+			return failure
+		}()
+	}
+
+	if errs := f.Errors(); errs["eof"] != 2 || len(errs) != 2 {
+		t.Fatalf("unexpected error counts: %v", errs)
+	}
+	stats := Collect(f)
+	if stats["function,error_name=eof,name=classified count"] != 2 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+
+	annotations := map[string]string{}
+	for _, a := range spans[0].Annotations() {
+		annotations[a.Name] = a.Value
+	}
+	if annotations["error"] != "EOF" || annotations["error.class"] != "eof" {
+		t.Fatalf("unexpected annotations: %v", annotations)
+	}
+}
+
+func TestFuncCurrent(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	f := mon.FuncNamed("inflight")
+
+	var exits []func(*error)
+	for i := 0; i < 3; i++ {
+		ctx := context.Background()
+		exits = append(exits, f.Task(&ctx))
+	}
+	if f.Current() != 3 {
+		t.Fatalf("expected 3 calls in flight, got %d", f.Current())
+	}
+	for _, exit := range exits {
+		exit(nil)
+	}
+
+	func() {
+		defer func() { _ = recover() }()
+		ctx := context.Background()
+		defer f.Task(&ctx)(nil)
+		panic("boom")
+	}()
+
+	stats := Collect(f)
+	if stats["function,name=inflight current"] != 0 ||
+		stats["function,name=inflight highwater"] != 3 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+func TestFuncCapturePanics(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	f := mon.FuncNamed("panicky")
+	f.SetCapturePanics(true)
+
+	var span *Span
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		ctx := context.Background()
+		defer f.Task(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+		panic("boom")
+	}()
+
+	if recovered != "boom" {
+		t.Fatalf("expected the panic to propagate, got %v", recovered)
+	}
+	annotations := map[string]interface{}{}
+	for _, a := range span.Annotations() {
+		annotations[a.Name] = a.Interface()
+	}
+	if annotations["panicked"] != true || annotations["panic"] != "boom" {
+		t.Fatalf("unexpected annotations: %v", annotations)
+	}
+	if f.Panics() != 1 {
+		t.Fatalf("expected 1 panic, got %d", f.Panics())
+	}
+}
+
+func TestFuncStatsSnapshot(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	f := mon.FuncNamed("snap")
+
+	for i := 0; i < 3; i++ {
+		ctx := context.Background()
+		f.Task(&ctx)(nil)
+	}
+	ctx := context.Background()
+	err := io.EOF
+	f.Task(&ctx)(&err)
+
+	s := f.Snapshot()
+	if s.Successes != 3 || s.ErrorCount != 1 || s.Errors["EOF"] != 1 ||
+		s.Panics != 0 || s.Total() != 4 || s.FailureRate() != 0.25 {
+		t.Fatalf("unexpected snapshot: %+v", s)
+	}
+	if s.SuccessTimes.Count != 3 || s.FailureTimes.Count != 1 {
+		t.Fatalf("unexpected distributions: %d, %d",
+			s.SuccessTimes.Count, s.FailureTimes.Count)
+	}
+
+	// the snapshot is a copy
+	f.Task(&ctx)(nil)
+	if s.Successes != 3 || s.SuccessTimes.Count != 3 {
+		t.Fatalf("expected the snapshot not to change")
+	}
+}
+
+func TestFuncConsecutiveFailures(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	f := mon.FuncNamed("flaky")
+
+	run := func(err error) {
+		ctx := context.Background()
+		f.Task(&ctx)(&err)
+	}
+	streak := func() float64 {
+		return Collect(mon)["function,name=flaky,scope=test consecutive_failures"]
+	}
+	reported := func() bool {
+		_, ok := Collect(mon)["function,name=flaky,scope=test consecutive_failures"]
+		return ok
+	}
+
+	run(nil)
+	if reported() {
+		t.Fatalf("expected no streak to be reported before a failure")
+	}
+
+	run(io.EOF)
+	run(io.EOF)
+	func() {
+		defer func() { _ = recover() }()
+		ctx := context.Background()
+		defer f.Task(&ctx)(nil)
+		panic("oops")
+	}()
+	if got := streak(); got != 3 {
+		t.Fatalf("expected a streak of 3, got %v", got)
+	}
+	run(nil)
+	if reported() {
+		t.Fatalf("expected the streak to reset, got %v", streak())
+	}
+	run(io.EOF)
+	if got := f.Snapshot().ConsecutiveFailures; got != 1 {
+		t.Fatalf("expected a streak of 1, got %v", got)
+	}
+}
+
+func TestFuncNamed(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+
+	var span *Span
+	upload := func(ctx context.Context) {
+		defer mon.FuncNamed("upload").Task(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+	}
+	upload(context.Background())
+	upload(context.Background())
+
+	f := mon.FuncNamed("upload")
+	if span.Func() != f || f.ShortName() != "upload" ||
+		f.FullName() != "test.upload" {
+		t.Fatalf("unexpected func: %q", f.FullName())
+	}
+	stats := Collect(mon)
+	if stats["function,name=upload,scope=test successes"] != 2 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	found := false
+	mon.Funcs(func(f *Func) { found = found || f.ShortName() == "upload" })
+	if !found {
+		t.Fatalf("expected the named func to be listed with the scope's funcs")
+	}
+}
+
+func TestFuncCaptureRuntimeDeltas(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	f := mon.FuncNamed("leaky")
+	f.SetCaptureRuntimeDeltas(true)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	var sink []byte
+	var span *Span
+	func() {
+		ctx := context.Background()
+		defer f.Task(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+		sink = make([]byte, 1<<20)
+		go func() { <-stop }()
+	}()
+	_ = sink
+
+	annotations := map[string]interface{}{}
+	for _, a := range span.Annotations() {
+		annotations[a.Name] = a.Interface()
+	}
+	if alloc, _ := annotations["runtime.alloc_bytes"].(int64); alloc < 1<<20 {
+		t.Fatalf("expected at least 1MiB allocated, got %v", annotations)
+	}
+	if goroutines, _ := annotations["runtime.goroutines"].(int); goroutines < 1 {
+		t.Fatalf("expected a goroutine to be started, got %v", annotations)
+	}
+
+	ctx := context.Background()
+	mon.FuncNamed("other").Task(&ctx)(nil)
+
+	stats := Collect(mon)
+	if stats["function_alloc_bytes,name=leaky,scope=test count"] != 1 ||
+		stats["function_goroutines,name=leaky,scope=test max"] < 1 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if _, ok := stats["function_alloc_bytes,name=other,scope=test count"]; ok {
+		t.Fatalf("unexpected stats for funcs that don't capture deltas")
+	}
+}
@@ -15,6 +15,7 @@
 package monkit
 
 import (
+	"context"
 	"sync/atomic"
 	"time"
 
@@ -36,23 +37,39 @@ type FuncStats struct {
 	// sync/atomic things
 	current         int64
 	highwater       int64
+	sloThreshold    int64
 	parentsAndMutex funcSet
+	classifier      atomic.Value // errorClassifier
 
 	// mutex things (reuses mutex from parents)
-	errors       map[string]int64
-	panics       int64
-	successTimes DurationDist
-	failureTimes DurationDist
-	key          SeriesKey
+	errors              map[string]int64
+	panics              int64
+	consecutiveFailures int64
+	cancelled           int64
+	deadlineExceeded    int64
+	sloViolations       int64
+	sloTotal            int64
+	successTimes        DurationDist
+	failureTimes        DurationDist
+	allocBytes          IntDist
+	goroutines          IntDist
+	key                 SeriesKey
 }
 
 func initFuncStats(f *FuncStats, key SeriesKey) {
 	f.key = key
 	f.errors = map[string]int64{}
 
-	key.Measurement += "_times"
-	initDurationDist(&f.successTimes, key.WithTag("kind", "success"))
-	initDurationDist(&f.failureTimes, key.WithTag("kind", "failure"))
+	times := key
+	times.Measurement += "_times"
+	initDurationDist(&f.successTimes, times.WithTag("kind", "success"))
+	initDurationDist(&f.failureTimes, times.WithTag("kind", "failure"))
+
+	allocBytes, goroutines := key, key
+	allocBytes.Measurement += "_alloc_bytes"
+	goroutines.Measurement += "_goroutines"
+	initIntDist(&f.allocBytes, allocBytes)
+	initIntDist(&f.goroutines, goroutines)
 }
 
 // NewFuncStats creates a FuncStats
@@ -66,11 +83,26 @@ func NewFuncStats(key SeriesKey) (f *FuncStats) {
 func (f *FuncStats) Reset() {
 	atomic.StoreInt64(&f.current, 0)
 	atomic.StoreInt64(&f.highwater, 0)
+	f.resetCounts()
+}
+
+// resetCounts resets all recorded data except for the current number of
+// running instances, which are still going to finish. The highwater mark
+// restarts from the current value.
+func (f *FuncStats) resetCounts() {
+	atomic.StoreInt64(&f.highwater, atomic.LoadInt64(&f.current))
 	f.parentsAndMutex.Lock()
 	f.errors = make(map[string]int64, len(f.errors))
 	f.panics = 0
+	f.consecutiveFailures = 0
+	f.cancelled = 0
+	f.deadlineExceeded = 0
+	f.sloViolations = 0
+	f.sloTotal = 0
 	f.successTimes.Reset()
 	f.failureTimes.Reset()
+	f.allocBytes.Reset()
+	f.goroutines.Reset()
 	f.parentsAndMutex.Unlock()
 }
 
@@ -86,22 +118,59 @@ func (f *FuncStats) start(parent *Func) {
 	}
 }
 
-func (f *FuncStats) end(err error, panicked bool, duration time.Duration) {
+// end records a finished call and returns the class the call's error was
+// counted under, if any.
+func (f *FuncStats) end(err error, panicked bool, duration time.Duration) (
+	errClass string) {
+	if err != nil && !panicked {
+		errClass = f.classify(err)
+	}
 	atomic.AddInt64(&f.current, -1)
+	threshold := time.Duration(atomic.LoadInt64(&f.sloThreshold))
 	f.parentsAndMutex.Lock()
+	if threshold > 0 {
+		f.sloTotal += 1
+		if duration > threshold {
+			f.sloViolations += 1
+		}
+	}
 	if panicked {
 		f.panics += 1
+		f.consecutiveFailures += 1
 		f.failureTimes.Insert(duration)
 		f.parentsAndMutex.Unlock()
-		return
+		return ""
 	}
 	if err == nil {
+		f.consecutiveFailures = 0
 		f.successTimes.Insert(duration)
 		f.parentsAndMutex.Unlock()
-		return
+		return ""
 	}
+	f.consecutiveFailures += 1
 	f.failureTimes.Insert(duration)
-	f.errors[getErrorName(err)] += 1
+	f.errors[errClass] += 1
+	f.parentsAndMutex.Unlock()
+	return errClass
+}
+
+// observeRuntimeDeltas records the deltas measured for a Span. See
+// Func.SetCaptureRuntimeDeltas.
+func (f *FuncStats) observeRuntimeDeltas(allocBytes int64, goroutines int) {
+	f.parentsAndMutex.Lock()
+	f.allocBytes.Insert(allocBytes)
+	f.goroutines.Insert(int64(goroutines))
+	f.parentsAndMutex.Unlock()
+}
+
+func (f *FuncStats) ctxDone(cerr error) {
+	f.parentsAndMutex.Lock()
+	switch cerr {
+	case context.Canceled:
+		f.cancelled += 1
+	case context.DeadlineExceeded:
+		f.deadlineExceeded += 1
+	}
 	f.parentsAndMutex.Unlock()
 }
 
@@ -141,38 +210,186 @@ func (f *FuncStats) Errors() (rv map[string]int64) {
 	return rv
 }
 
+// Cancelled returns the number of times a context-aware Task finished with a
+// cancelled context. See Scope.TaskCtx.
+func (f *FuncStats) Cancelled() (rv int64) {
+	f.parentsAndMutex.Lock()
+	rv = f.cancelled
+	f.parentsAndMutex.Unlock()
+	return rv
+}
+
+// DeadlineExceeded returns the number of times a context-aware Task finished
+// with an exceeded context deadline. See Scope.TaskCtx.
+func (f *FuncStats) DeadlineExceeded() (rv int64) {
+	f.parentsAndMutex.Lock()
+	rv = f.deadlineExceeded
+	f.parentsAndMutex.Unlock()
+	return rv
+}
+
+// SetSLO configures a latency threshold for the function. While a threshold
+// is set, every completed call is counted in slo_total, and calls that took
+// longer than the threshold are also counted in slo_violations. A threshold
+// of 0, the default, disables SLO tracking. The threshold can be changed at
+// any time.
+func (f *FuncStats) SetSLO(threshold time.Duration) {
+	atomic.StoreInt64(&f.sloThreshold, int64(threshold))
+}
+
+// SetErrorClassifier configures a func that derives an error class from the
+// errors this function fails with. Errors are counted per class, in the
+// error_name tagged series and in Errors, and Spans that fail with an error
+// are annotated with the error's string and its class. If classifier is nil
+// or returns the empty string, the class is determined by the handlers from
+// AddErrorNameHandler, as by default.
+func (f *FuncStats) SetErrorClassifier(classifier func(err error) string) {
+	f.classifier.Store(errorClassifier{classify: classifier})
+}
+
+type errorClassifier struct {
+	classify func(error) string
+}
+
+func (f *FuncStats) classify(err error) string {
+	if c, _ := f.classifier.Load().(errorClassifier); c.classify != nil {
+		if class := c.classify(err); class != "" {
+			return class
+		}
+	}
+	return getErrorName(err)
+}
+
+// SLO returns the number of calls that exceeded the SLO threshold and the
+// total number of calls observed while a threshold was set. See SetSLO.
+func (f *FuncStats) SLO() (violations, total int64) {
+	f.parentsAndMutex.Lock()
+	violations, total = f.sloViolations, f.sloTotal
+	f.parentsAndMutex.Unlock()
+	return violations, total
+}
+
 func (f *FuncStats) parents(cb func(f *Func)) {
 	f.parentsAndMutex.Iterate(cb)
 }
 
-// Stats implements the StatSource interface
-func (f *FuncStats) Stats(cb func(key SeriesKey, field string, val float64)) {
-	cb(f.key, "current", float64(f.Current()))
-	cb(f.key, "highwater", float64(f.Highwater()))
+// FuncStatsSnapshot is a consistent copy of the numbers a FuncStats reports,
+// for code that wants to act on them in-process. See FuncStats.Snapshot.
+type FuncStatsSnapshot struct {
+	Current   int64
+	Highwater int64
+
+	Successes int64
+	// Errors holds the number of errors by error name, and ErrorCount their
+	// sum. Panics are counted separately.
+	Errors     map[string]int64
+	ErrorCount int64
+	Panics     int64
+
+	// ConsecutiveFailures is the number of calls that have failed since the
+	// last successful one.
+	ConsecutiveFailures int64
+
+	Cancelled        int64
+	DeadlineExceeded int64
+
+	// SLOViolations and SLOTotal are only counted while an SLO threshold is
+	// set. See FuncStats.SetSLO.
+	SLOViolations int64
+	SLOTotal      int64
+
+	// SuccessTimes and FailureTimes are copies of the duration
+	// distributions, so they can be queried for any quantile.
+	SuccessTimes *DurationDist
+	FailureTimes *DurationDist
+}
+
+// Failures returns the number of errors and panics.
+func (s FuncStatsSnapshot) Failures() int64 { return s.ErrorCount + s.Panics }
+
+// Total returns the number of finished calls.
+func (s FuncStatsSnapshot) Total() int64 { return s.Successes + s.Failures() }
+
+// FailureRate returns the fraction of finished calls that failed, or 0 if no
+// calls have finished.
+func (s FuncStatsSnapshot) FailureRate() float64 {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Failures()) / float64(total)
+}
+
+// Snapshot returns a copy of the function's statistics. All counts and
+// distributions are copied together under the same lock, so they agree with
+// each other; only Current and Highwater, which are updated without the
+// lock, may be slightly ahead of or behind the rest.
+func (f *FuncStats) Snapshot() (s FuncStatsSnapshot) {
+	s.Current = f.Current()
+	s.Highwater = f.Highwater()
 
 	f.parentsAndMutex.Lock()
-	panics := f.panics
-	errs := make(map[string]int64, len(f.errors))
+	s.Successes = f.successTimes.Count
+	s.Errors = make(map[string]int64, len(f.errors))
 	for errname, count := range f.errors {
-		errs[errname] = count
+		s.Errors[errname] = count
+		s.ErrorCount += count
 	}
-	st := f.successTimes.Copy()
-	ft := f.failureTimes.Copy()
+	s.Panics = f.panics
+	s.ConsecutiveFailures = f.consecutiveFailures
+	s.Cancelled, s.DeadlineExceeded = f.cancelled, f.deadlineExceeded
+	s.SLOViolations, s.SLOTotal = f.sloViolations, f.sloTotal
+	s.SuccessTimes = f.successTimes.Copy()
+	s.FailureTimes = f.failureTimes.Copy()
 	f.parentsAndMutex.Unlock()
+	return s
+}
 
-	cb(f.key, "successes", float64(st.Count))
-	e_count := int64(0)
-	for errname, count := range errs {
-		e_count += count
+// Stats implements the StatSource interface
+func (f *FuncStats) Stats(cb func(key SeriesKey, field string, val float64)) {
+	s := f.Snapshot()
+
+	cb(f.key, "current", float64(s.Current))
+	cb(f.key, "highwater", float64(s.Highwater))
+	cb(f.key, "successes", float64(s.Successes))
+	for errname, count := range s.Errors {
 		cb(f.key.WithTag("error_name", errname), "count", float64(count))
 	}
-	cb(f.key, "errors", float64(e_count))
-	cb(f.key, "panics", float64(panics))
-	cb(f.key, "failures", float64(e_count+panics))
-	cb(f.key, "total", float64(st.Count+e_count+panics))
+	cb(f.key, "errors", float64(s.ErrorCount))
+	cb(f.key, "panics", float64(s.Panics))
+	cb(f.key, "failures", float64(s.Failures()))
+	cb(f.key, "total", float64(s.Total()))
+	// these are only reported once they happen, so Funcs that never fail or
+	// get canceled don't grow three extra series each.
+	if s.ConsecutiveFailures != 0 {
+		cb(f.key, "consecutive_failures", float64(s.ConsecutiveFailures))
+	}
+	if s.Cancelled != 0 {
+		cb(f.key, "cancelled", float64(s.Cancelled))
+	}
+	if s.DeadlineExceeded != 0 {
+		cb(f.key, "deadline_exceeded", float64(s.DeadlineExceeded))
+	}
+	if atomic.LoadInt64(&f.sloThreshold) > 0 {
+		cb(f.key, "slo_violations", float64(s.SLOViolations))
+		cb(f.key, "slo_total", float64(s.SLOTotal))
+	}
+
+	s.SuccessTimes.Stats(cb)
+	s.FailureTimes.Stats(cb)
 
-	st.Stats(cb)
-	ft.Stats(cb)
+	// runtime deltas are only reported once measured, so Funcs that don't
+	// capture them don't report empty distributions.
+	f.parentsAndMutex.Lock()
+	var allocBytes, goroutines *IntDist
+	if f.allocBytes.Count > 0 {
+		allocBytes, goroutines = f.allocBytes.Copy(), f.goroutines.Copy()
+	}
+	f.parentsAndMutex.Unlock()
+	if allocBytes != nil {
+		allocBytes.Stats(cb)
+		goroutines.Stats(cb)
+	}
 }
 
 // SuccessTimes returns a DurationDist of successes
@@ -0,0 +1,207 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpc provides gRPC interceptors that propagate monkit traces over
+// gRPC metadata. Trace information is encoded exactly like the http
+// subpackage encodes it in HTTP headers, so sampling decisions round-trip the
+// same way over both transports.
+package grpc // import "github.com/spacemonkeygo/monkit/v3/grpc"
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/spacemonkeygo/monkit/v3"
+	monkithttp "github.com/spacemonkeygo/monkit/v3/http"
+	"github.com/spacemonkeygo/monkit/v3/present"
+)
+
+// metadataCarrier adapts gRPC metadata to the http subpackage's
+// HeaderGetter and HeaderSetter interfaces.
+type metadataCarrier metadata.MD
+
+// Get implements monkithttp.HeaderGetter.
+func (m metadataCarrier) Get(key string) string {
+	vals := metadata.MD(m).Get(key)
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+// Set implements monkithttp.HeaderSetter.
+func (m metadataCarrier) Set(key, val string) {
+	metadata.MD(m).Set(key, val)
+}
+
+// TraceInfoFromContext returns the trace information found in the incoming
+// gRPC metadata of ctx, if any.
+func TraceInfoFromContext(ctx context.Context) monkithttp.TraceInfo {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return monkithttp.TraceInfoFromHeader(metadataCarrier(md))
+}
+
+// outgoingContext returns a copy of ctx with the trace information of the
+// Span in ctx added to the outgoing gRPC metadata.
+func outgoingContext(ctx context.Context) context.Context {
+	s := monkit.SpanFromCtx(ctx)
+	if s == nil {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	monkithttp.TraceInfoFromSpan(s).SetHeader(metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// remoteTrace prepares the arguments for Func.RemoteTrace from the incoming
+// gRPC metadata of ctx, the same way the http subpackage's TraceHandler does.
+func remoteTrace(ctx context.Context, scope *monkit.Scope, method string) (
+	f *monkit.Func, parentId int64, trace *monkit.Trace) {
+	info := TraceInfoFromContext(ctx)
+
+	if traceId, ok := info.TraceId128(); ok {
+		trace = monkit.NewTrace128(traceId)
+	} else {
+		trace = monkit.NewTrace(monkit.NewId())
+	}
+	if info.ParentId != nil {
+		parentId = *info.ParentId
+	}
+	if info.Sampled {
+		trace.Set(present.SampledKey, true)
+	}
+	if info.SampleRate > 0 {
+		// the caller decided at this rate, so keep its decision either way.
+		trace.Set(monkit.SampleRateKey, info.SampleRate)
+		trace.Set(present.SampledKey, info.Sampled)
+	}
+	if info.Priority > 0 {
+		trace.SetPriority(info.Priority)
+	}
+	for key, val := range info.Baggage {
+		trace.SetBaggage(key, val)
+	}
+	for key, val := range info.Values {
+		trace.Set(key, val)
+	}
+	return scope.FuncNamed(method), parentId, trace
+}
+
+// sampledCallback calls the callback stored under present.SampledCBKey on the
+// trace, if any. There is no trace if the Scope is disabled.
+func sampledCallback(ctx context.Context) {
+	s := monkit.SpanFromCtx(ctx)
+	if s == nil {
+		return
+	}
+	trace := s.Trace()
+	if cb, exists := trace.Get(present.SampledCBKey).(func(*monkit.Trace)); exists {
+		cb(trace)
+	}
+}
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor that continues
+// the remote trace found in the incoming metadata, or starts a new one, with
+// a Func named after the full gRPC method name on the given Scope.
+func UnaryServerInterceptor(scope *monkit.Scope) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		resp interface{}, err error) {
+		f, parentId, trace := remoteTrace(ctx, scope, info.FullMethod)
+		defer f.RemoteTrace(&ctx, parentId, trace)(&err)
+		sampledCallback(ctx)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor that
+// continues the remote trace found in the incoming metadata, or starts a new
+// one, for the lifetime of the stream. See UnaryServerInterceptor.
+func StreamServerInterceptor(scope *monkit.Scope) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := ss.Context()
+		f, parentId, trace := remoteTrace(ctx, scope, info.FullMethod)
+		defer f.RemoteTrace(&ctx, parentId, trace)(&err)
+		sampledCallback(ctx)
+		return handler(srv, serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context { return s.ctx }
+
+// UnaryClientInterceptor returns a grpc.UnaryClientInterceptor that starts a
+// Span named after the full gRPC method name on the given Scope for each call
+// and sends the trace information in the outgoing metadata.
+func UnaryClientInterceptor(scope *monkit.Scope) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) (err error) {
+		defer scope.FuncNamed(method).Task(&ctx)(&err)
+		return invoker(outgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a grpc.StreamClientInterceptor that starts
+// a Span named after the full gRPC method name on the given Scope for each
+// stream and sends the trace information in the outgoing metadata. The Span
+// finishes when the stream fails to be created or when receiving from the
+// stream returns an error, including io.EOF at the end of the stream.
+func StreamClientInterceptor(scope *monkit.Scope) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc,
+		cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		exit := scope.FuncNamed(method).Task(&ctx)
+		cs, err := streamer(outgoingContext(ctx), desc, cc, method, opts...)
+		if err != nil {
+			exit(&err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, exit: exit}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	exit func(*error)
+	once sync.Once
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.once.Do(func() {
+			var finalErr error
+			if err != io.EOF {
+				finalErr = err
+			}
+			s.exit(&finalErr)
+		})
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/spacemonkeygo/monkit/v3"
+	"github.com/spacemonkeygo/monkit/v3/present"
+)
+
+func TestUnaryRoundTrip(t *testing.T) {
+	mon := monkit.NewRegistry().ScopeNamed("test")
+	client := UnaryClientInterceptor(mon)
+	server := UnaryServerInterceptor(mon)
+
+	const method = "/test.Service/Method"
+
+	trace := monkit.NewTrace(monkit.NewId())
+	trace.Set(present.SampledKey, true)
+	trace.Set(monkit.SampleRateKey, 0.25)
+
+	var clientSpan, serverSpan *monkit.Span
+	func() {
+		ctx := context.Background()
+		defer mon.Func().RemoteTrace(&ctx, 0, trace)(nil)
+
+		invoker := func(ctx context.Context, method string, req, reply interface{},
+			cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			clientSpan = monkit.SpanFromCtx(ctx)
+			md, _ := metadata.FromOutgoingContext(ctx)
+			ctx = metadata.NewIncomingContext(context.Background(), md)
+			_, err := server(ctx, req, &grpc.UnaryServerInfo{FullMethod: method},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					serverSpan = monkit.SpanFromCtx(ctx)
+					return nil, nil
+				})
+			return err
+		}
+		if err := client(ctx, method, nil, nil, nil, invoker); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if clientSpan == nil || serverSpan == nil {
+		t.Fatal("expected spans on both sides")
+	}
+	if serverSpan.Trace().Id() != trace.Id() {
+		t.Fatalf("trace id mismatch: %d != %d", serverSpan.Trace().Id(), trace.Id())
+	}
+	// parent ids are propagated the same way the http subpackage does
+	expectedParent, _ := clientSpan.ParentId()
+	if parentId, ok := serverSpan.ParentId(); !ok || parentId != expectedParent {
+		t.Fatalf("unexpected server parent: %d != %d", parentId, expectedParent)
+	}
+	if sampled, _ := serverSpan.Trace().Get(present.SampledKey).(bool); !sampled {
+		t.Fatal("expected sampled flag to round trip")
+	}
+	if rate, _ := serverSpan.Trace().Get(monkit.SampleRateKey).(float64); rate != 0.25 {
+		t.Fatalf("expected sample rate to round trip, got %v", rate)
+	}
+	if serverSpan.Func().ShortName() != method {
+		t.Fatalf("unexpected func name: %q", serverSpan.Func().ShortName())
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s testServerStream) Context() context.Context { return s.ctx }
+
+type testClientStream struct {
+	grpc.ClientStream
+}
+
+func (testClientStream) RecvMsg(m interface{}) error { return io.EOF }
+
+// TestDisabledScope checks that all interceptors still pass calls through
+// when their Scope is disabled and no Spans are started.
+func TestDisabledScope(t *testing.T) {
+	mon := monkit.NewRegistry().ScopeNamed("test")
+	mon.SetEnabled(false)
+
+	const method = "/test.Service/Method"
+	noSpan := func(ctx context.Context) {
+		t.Helper()
+		if monkit.SpanFromCtx(ctx) != nil {
+			t.Fatal("expected no span while disabled")
+		}
+	}
+
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+	handled := false
+	_, err := UnaryServerInterceptor(mon)(incoming, nil,
+		&grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			noSpan(ctx)
+			handled = true
+			return nil, nil
+		})
+	if err != nil || !handled {
+		t.Fatalf("unary handler not called: %v", err)
+	}
+
+	handled = false
+	err = StreamServerInterceptor(mon)(nil, testServerStream{ctx: incoming},
+		&grpc.StreamServerInfo{FullMethod: method},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			noSpan(ss.Context())
+			handled = true
+			return nil
+		})
+	if err != nil || !handled {
+		t.Fatalf("stream handler not called: %v", err)
+	}
+
+	handled = false
+	err = UnaryClientInterceptor(mon)(context.Background(), method, nil, nil,
+		nil, func(ctx context.Context, method string, req, reply interface{},
+			cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			noSpan(ctx)
+			handled = true
+			return nil
+		})
+	if err != nil || !handled {
+		t.Fatalf("unary invoker not called: %v", err)
+	}
+
+	handled = false
+	cs, err := StreamClientInterceptor(mon)(context.Background(),
+		&grpc.StreamDesc{}, nil, method,
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+			method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			noSpan(ctx)
+			handled = true
+			return testClientStream{}, nil
+		})
+	if err != nil || !handled {
+		t.Fatalf("streamer not called: %v", err)
+	}
+	if err := cs.RecvMsg(nil); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// Histogram keeps counts of observed values in explicit buckets, along with
+// their sum and count. Unlike the reservoir sampled distributions, bucket
+// counts from many processes can be added together, so quantiles can be
+// computed correctly across instances.
+//
+// Stats reports a "bucket" field for every bucket, tagged with the bucket's
+// inclusive upper bound as "le", and counting all observations less than or
+// equal to the bound (like Prometheus histograms, the counts are
+// cumulative). A final bucket with "le" set to "+Inf" counts all
+// observations. The untagged key also reports "sum" and "count".
+// Implements the StatSource interface. You should construct using
+// NewHistogram or Scope.Histogram. Observing values is lock-free.
+type Histogram struct {
+	// sync/atomic things
+	sum uint64
+
+	scopeGate
+	key     SeriesKey
+	buckets []float64
+	labels  []string
+	counts  []int64
+}
+
+// NewHistogram constructs a Histogram with the given bucket upper bounds.
+// The bounds are sorted and deduplicated, and a bucket for +Inf is always
+// added.
+func NewHistogram(key SeriesKey, buckets []float64) *Histogram {
+	sorted := make([]float64, 0, len(buckets))
+	for _, bound := range buckets {
+		if !math.IsNaN(bound) && !math.IsInf(bound, 1) {
+			sorted = append(sorted, bound)
+		}
+	}
+	sort.Float64s(sorted)
+	deduped := sorted[:0]
+	for i, bound := range sorted {
+		if i == 0 || bound != sorted[i-1] {
+			deduped = append(deduped, bound)
+		}
+	}
+
+	labels := make([]string, 0, len(deduped)+1)
+	for _, bound := range deduped {
+		labels = append(labels, strconv.FormatFloat(bound, 'f', -1, 64))
+	}
+	labels = append(labels, "+Inf")
+
+	return &Histogram{
+		key:     key,
+		buckets: deduped,
+		labels:  labels,
+		counts:  make([]int64, len(deduped)+1),
+	}
+}
+
+// Observe adds val to the Histogram.
+func (h *Histogram) Observe(val float64) {
+	if h.off() {
+		return
+	}
+	i := sort.SearchFloat64s(h.buckets, val)
+	atomic.AddInt64(&h.counts[i], 1)
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		new := math.Float64bits(math.Float64frombits(old) + val)
+		if atomic.CompareAndSwapUint64(&h.sum, old, new) {
+			return
+		}
+	}
+}
+
+// Buckets returns the upper bounds of the buckets, not including +Inf, and
+// the cumulative count of observations in each bucket, including +Inf.
+func (h *Histogram) Buckets() (bounds []float64, counts []int64) {
+	counts = make([]int64, len(h.counts))
+	var total int64
+	for i := range h.counts {
+		total += atomic.LoadInt64(&h.counts[i])
+		counts[i] = total
+	}
+	return append([]float64(nil), h.buckets...), counts
+}
+
+// Sum returns the sum of all observed values.
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.sum))
+}
+
+// Reset clears all observations.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+	atomic.StoreUint64(&h.sum, 0)
+}
+
+// Stats implements the StatSource interface
+func (h *Histogram) Stats(cb func(key SeriesKey, field string, val float64)) {
+	_, counts := h.Buckets()
+	for i, count := range counts {
+		cb(h.key.WithTag("le", h.labels[i]), "bucket", float64(count))
+	}
+	cb(h.key, "sum", h.Sum())
+	cb(h.key, "count", float64(counts[len(counts)-1]))
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2022 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package http
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// see: https://www.w3.org/TR/baggage/
+const (
+	baggageHeader = "baggage"
+
+	// maxBaggageSize and maxBaggageEntries limit how much baggage is sent or
+	// accepted, to keep baggage from bloating headers.
+	maxBaggageSize    = 8192
+	maxBaggageEntries = 64
+)
+
+var baggageKeys struct {
+	mtx  sync.RWMutex
+	keys map[string]bool
+}
+
+// SetBaggageKeys limits which trace baggage keys are sent and accepted in
+// headers. By default, or if no keys are given, all baggage is propagated.
+// See monkit.Trace.SetBaggage.
+func SetBaggageKeys(keys ...string) {
+	var allowed map[string]bool
+	if len(keys) > 0 {
+		allowed = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			allowed[key] = true
+		}
+	}
+	baggageKeys.mtx.Lock()
+	baggageKeys.keys = allowed
+	baggageKeys.mtx.Unlock()
+}
+
+func baggageKeyAllowed(key string) bool {
+	baggageKeys.mtx.RLock()
+	defer baggageKeys.mtx.RUnlock()
+	return baggageKeys.keys == nil || baggageKeys.keys[key]
+}
+
+// formatBaggage renders the allowed baggage and the encoded trace values as
+// a baggage header value, in sorted key order, leaving out entries that
+// would go over the size limits. See RegisterBaggageCodec.
+func formatBaggage(baggage, values map[string]string) string {
+	all := make(map[string]string, len(baggage)+len(values))
+	for key, val := range baggage {
+		if validBaggageKey(key) && baggageKeyAllowed(key) {
+			all[key] = val
+		}
+	}
+	for key, val := range values {
+		all[key] = val
+	}
+	keys := make([]string, 0, len(all))
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	entries := 0
+	for _, key := range keys {
+		entry := key + "=" + url.PathEscape(all[key])
+		size := len(entry)
+		if b.Len() > 0 {
+			size++
+		}
+		if entries >= maxBaggageEntries || b.Len()+size > maxBaggageSize {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(entry)
+		entries++
+	}
+	return b.String()
+}
+
+// parseBaggage parses a baggage header value into baggage and the decoded
+// trace values of keys with a codec, ignoring malformed or disallowed entries
+// and any entry properties. Nothing is returned if the header is too large.
+func parseBaggage(header string) (
+	rv map[string]string, values map[string]interface{}) {
+	if header == "" || len(header) > maxBaggageSize {
+		return nil, nil
+	}
+	for _, entry := range strings.Split(header, ",") {
+		if i := strings.IndexByte(entry, ';'); i >= 0 {
+			entry = entry[:i]
+		}
+		eq := strings.IndexByte(entry, '=')
+		if eq < 0 {
+			continue
+		}
+		key := strings.TrimSpace(entry[:eq])
+		val, err := url.PathUnescape(strings.TrimSpace(entry[eq+1:]))
+		if err != nil || !validBaggageKey(key) {
+			continue
+		}
+		if len(rv)+len(values) >= maxBaggageEntries {
+			break
+		}
+		if codec, ok := lookupBaggageCodec(key); ok {
+			if decoded := codec.decode(val); decoded != nil {
+				if values == nil {
+					values = map[string]interface{}{}
+				}
+				values[key] = decoded
+			}
+			continue
+		}
+		if !baggageKeyAllowed(key) {
+			continue
+		}
+		if rv == nil {
+			rv = map[string]string{}
+		}
+		rv[key] = val
+	}
+	return rv, values
+}
+
+// validBaggageKey returns true if key is an RFC 7230 token.
+func validBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// restoreBaggage sets the given baggage on the trace.
+func restoreBaggage(trace *monkit.Trace, baggage map[string]string) {
+	for key, val := range baggage {
+		trace.SetBaggage(key, val)
+	}
+}
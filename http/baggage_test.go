@@ -0,0 +1,111 @@
+// Copyright (C) 2022 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestBaggageRoundTrip(t *testing.T) {
+	header := http.Header{}
+	TraceInfo{Baggage: map[string]string{
+		"tenant":    "acme corp",
+		"origin":    "a,b=c;d",
+		"bad key":   "dropped",
+		"other-key": "x",
+	}}.SetHeader(header)
+
+	if got := header.Get(baggageHeader); got !=
+		"origin=a%2Cb=c%3Bd,other-key=x,tenant=acme%20corp" {
+		t.Fatalf("unexpected header: %q", got)
+	}
+
+	baggage := TraceInfoFromHeader(header).Baggage
+	if len(baggage) != 3 || baggage["tenant"] != "acme corp" ||
+		baggage["origin"] != "a,b=c;d" || baggage["other-key"] != "x" {
+		t.Fatalf("unexpected baggage: %v", baggage)
+	}
+
+	SetBaggageKeys("tenant")
+	defer SetBaggageKeys()
+	baggage = TraceInfoFromHeader(header).Baggage
+	if len(baggage) != 1 || baggage["tenant"] != "acme corp" {
+		t.Fatalf("expected only allowed keys: %v", baggage)
+	}
+}
+
+func TestBaggageLimits(t *testing.T) {
+	big := strings.Repeat("x", maxBaggageSize)
+	header := http.Header{}
+	TraceInfo{Baggage: map[string]string{"big": big, "small": "y"}}.
+		SetHeader(header)
+	if got := header.Get(baggageHeader); got != "small=y" {
+		t.Fatalf("expected oversized entries to be dropped, got %q", got)
+	}
+
+	header.Set(baggageHeader, "k="+big)
+	if baggage := TraceInfoFromHeader(header).Baggage; baggage != nil {
+		t.Fatalf("expected oversized headers to be ignored")
+	}
+
+	header.Set(baggageHeader, " a = 1 ;prop=2, b, =3")
+	if baggage := TraceInfoFromHeader(header).Baggage; len(baggage) != 1 ||
+		baggage["a"] != "1" {
+		t.Fatalf("unexpected baggage: %v", baggage)
+	}
+}
+
+func TestBaggageCodec(t *testing.T) {
+	RegisterBaggageCodec("retries",
+		func(val interface{}) string { return strconv.Itoa(val.(int)) },
+		func(val string) interface{} {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return nil
+			}
+			return n
+		})
+	defer RegisterBaggageCodec("retries", nil, nil)
+	RegisterBaggageCodec("evil",
+		func(interface{}) string { return "x\r\nX-Injected: 1" },
+		func(val string) interface{} { return val })
+	defer RegisterBaggageCodec("evil", nil, nil)
+
+	trace := monkit.NewTrace(1)
+	trace.Set("retries", 3)
+	trace.Set("evil", true)
+	trace.Set("local", "stays")
+	values := traceValues(trace)
+	if len(values) != 2 || values["retries"] != 3 {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	// codec keys are propagated even if baggage keys are limited
+	SetBaggageKeys("tenant")
+	defer SetBaggageKeys()
+	header := http.Header{}
+	TraceInfo{Values: values, Baggage: map[string]string{"tenant": "acme"}}.
+		SetHeader(header)
+	if got := header.Get(baggageHeader); got != "retries=3,tenant=acme" {
+		t.Fatalf("unexpected header: %q", got)
+	}
+
+	info := TraceInfoFromHeader(header)
+	if len(info.Values) != 1 || info.Values["retries"] != 3 {
+		t.Fatalf("unexpected values: %v", info.Values)
+	}
+	if len(info.Baggage) != 1 || info.Baggage["tenant"] != "acme" {
+		t.Fatalf("unexpected baggage: %v", info.Baggage)
+	}
+
+	header.Set(baggageHeader, "retries=many")
+	if info := TraceInfoFromHeader(header); info.Values != nil {
+		t.Fatalf("expected undecodable values to be ignored: %v", info.Values)
+	}
+}
@@ -19,6 +19,10 @@ func TraceRequest(ctx context.Context, scope *monkit.Scope, cl Client, req *http
 	defer scope.TaskNamed(req.Method)(&ctx)(&err)
 
 	s := monkit.SpanFromCtx(ctx)
+	if s == nil {
+		// the scope is disabled, so there is no trace to send
+		return cl.Do(req)
+	}
 	s.Annotate("http.uri", req.URL.String())
 	TraceInfoFromSpan(s).SetHeader(req.Header)
 	resp, err = cl.Do(req)
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -19,9 +20,10 @@ import (
 type caller func(ctx context.Context, request *http.Request) (*http.Response, error)
 
 func TestPropagation(t *testing.T) {
-	mon := monkit.Package()
+	r := monkit.NewRegistry()
+	mon := r.Package()
 
-	addr, closeServer := startHTTPServer(t)
+	addr, closeServer := startHTTPServer(t, r)
 
 	defer closeServer()
 
@@ -32,7 +34,7 @@ func TestPropagation(t *testing.T) {
 	defer mon.Func().RemoteTrace(&ctx, 0, trace)(nil)
 
 	body, header := clientCallWithRetry(t, ctx, addr, func(ctx context.Context, request *http.Request) (*http.Response, error) {
-		return TraceRequest(ctx, monkit.ScopeNamed("client"), http.DefaultClient, request)
+		return TraceRequest(ctx, r.ScopeNamed("client"), http.DefaultClient, request)
 	})
 
 	s := monkit.SpanFromCtx(ctx)
@@ -50,7 +52,7 @@ func TestPropagation(t *testing.T) {
 // TestForcedSample checks if sampling can be turned on without having trace/span on client side.
 func TestForcedSample(t *testing.T) {
 
-	addr, closeServer := startHTTPServer(t)
+	addr, closeServer := startHTTPServer(t, monkit.NewRegistry())
 
 	defer closeServer()
 
@@ -69,6 +71,73 @@ func TestForcedSample(t *testing.T) {
 	}
 }
 
+// TestDisabledScope checks that TraceHandler and TraceRequest still serve and
+// send requests when their Scopes are disabled and no Spans are started.
+func TestDisabledScope(t *testing.T) {
+	r := monkit.NewRegistry()
+	server, client := r.ScopeNamed("server"), r.ScopeNamed("client")
+	server.SetEnabled(false)
+	client.SetEnabled(false)
+
+	ts := httptest.NewServer(TraceHandler(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if monkit.SpanFromCtx(r.Context()) != nil {
+				t.Error("expected no span while disabled")
+			}
+			_, _ = fmt.Fprint(w, "hello")
+		}), server))
+	defer ts.Close()
+
+	body, header, err := clientCall(context.Background(), ts.URL,
+		func(ctx context.Context, request *http.Request) (*http.Response, error) {
+			return TraceRequest(ctx, client, http.DefaultClient, request)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "hello" || header != "" {
+		t.Fatalf("unexpected response: %q %q", body, header)
+	}
+}
+
+// TestSampleRatePropagation checks that the rate a trace's sampling decision
+// was made with reaches the server along with the decision, sampled or not.
+func TestSampleRatePropagation(t *testing.T) {
+	r := monkit.NewRegistry()
+
+	var rate float64
+	var sampled, decided bool
+	ts := httptest.NewServer(TraceHandler(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			trace := monkit.SpanFromCtx(req.Context()).Trace()
+			rate, _ = trace.Get(monkit.SampleRateKey).(float64)
+			sampled, decided = trace.Get(present.SampledKey).(bool)
+		}), r.ScopeNamed("server")))
+	defer ts.Close()
+
+	for _, expected := range []bool{true, false} {
+		trace := monkit.NewTrace(monkit.NewId())
+		trace.Set(present.SampledKey, expected)
+		trace.Set(monkit.SampleRateKey, 0.25)
+
+		ctx := context.Background()
+		finish := r.ScopeNamed("client").Func().RemoteTrace(&ctx, 0, trace)
+		_, _, err := clientCall(ctx, ts.URL,
+			func(ctx context.Context, request *http.Request) (*http.Response, error) {
+				return TraceRequest(ctx, r.ScopeNamed("client"), http.DefaultClient,
+					request)
+			})
+		finish(&err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate != 0.25 || !decided || sampled != expected {
+			t.Fatalf("unexpected server trace: rate %v, sampled %v (%v)", rate,
+				sampled, decided)
+		}
+	}
+}
+
 func clientCallWithRetry(t *testing.T, ctx context.Context, addr string, caller caller) (string, string) {
 	var err error
 	for i := 0; i < 100; i++ {
@@ -100,9 +169,9 @@ func clientCall(ctx context.Context, addr string, caller caller) (string, string
 	return string(body), resp.Header.Get(traceStateHeader), nil
 }
 
-func startHTTPServer(t *testing.T) (addr string, def func()) {
+func startHTTPServer(t *testing.T, reg *monkit.Registry) (addr string, def func()) {
 	mux := http.NewServeMux()
-	mon := monkit.Package()
+	mon := reg.Package()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		defer mon.Task()(&ctx)(nil)
@@ -113,7 +182,7 @@ func startHTTPServer(t *testing.T) (addr string, def func()) {
 		if found {
 			// we are interested about the parent of the parent,
 			// created by the TraceHandler
-			monkit.RootSpans(func(s *monkit.Span) {
+			reg.RootSpans(func(s *monkit.Span) {
 				if s.Id() == parent {
 					grandParent, _ = s.ParentId()
 				}
@@ -128,7 +197,7 @@ func startHTTPServer(t *testing.T) (addr string, def func()) {
 		t.Fatal("Couldn't start tcp listener", err)
 	}
 
-	server := &http.Server{Addr: "localhost:5050", Handler: TraceHandler(mux, monkit.ScopeNamed("server"))}
+	server := &http.Server{Addr: "localhost:5050", Handler: TraceHandler(mux, reg.ScopeNamed("server"))}
 
 	go func() {
 		_ = server.Serve(listener)
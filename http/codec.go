@@ -0,0 +1,126 @@
+// Copyright (C) 2022 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package http
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+var baggageCodecs struct {
+	mtx    sync.RWMutex
+	codecs map[string]baggageCodec
+}
+
+type baggageCodec struct {
+	encode func(interface{}) string
+	decode func(string) interface{}
+}
+
+// RegisterBaggageCodec makes the trace value stored under key with
+// monkit.Trace.Set propagate in the baggage header, alongside the trace's
+// baggage. encode turns the value into the string to send, and decode turns
+// a received string back into the value to set under key on the receiving
+// trace. Values of keys without a codec stay local.
+//
+// Encoded strings that are too long or contain control characters or
+// invalid UTF-8 are not sent, so a misbehaving codec can't inject headers,
+// and received strings that decode to nil are ignored. Keys with a codec are
+// always propagated, even if SetBaggageKeys doesn't allow them, and take
+// precedence over baggage with the same key.
+//
+// Registering a key again replaces its codec, and registering nil funcs
+// removes it. RegisterBaggageCodec panics if key is not a valid baggage key,
+// that is, an RFC 7230 token.
+func RegisterBaggageCodec(key string, encode func(interface{}) string,
+	decode func(string) interface{}) {
+	if !validBaggageKey(key) {
+		panic(fmt.Sprintf("monkit/http: invalid baggage codec key %q", key))
+	}
+	baggageCodecs.mtx.Lock()
+	defer baggageCodecs.mtx.Unlock()
+	if encode == nil || decode == nil {
+		delete(baggageCodecs.codecs, key)
+		return
+	}
+	if baggageCodecs.codecs == nil {
+		baggageCodecs.codecs = map[string]baggageCodec{}
+	}
+	baggageCodecs.codecs[key] = baggageCodec{encode: encode, decode: decode}
+}
+
+func lookupBaggageCodec(key string) (codec baggageCodec, ok bool) {
+	baggageCodecs.mtx.RLock()
+	defer baggageCodecs.mtx.RUnlock()
+	codec, ok = baggageCodecs.codecs[key]
+	return codec, ok
+}
+
+// traceValues returns the values of the trace that have a codec, if any.
+func traceValues(trace *monkit.Trace) map[string]interface{} {
+	baggageCodecs.mtx.RLock()
+	keys := make([]string, 0, len(baggageCodecs.codecs))
+	for key := range baggageCodecs.codecs {
+		keys = append(keys, key)
+	}
+	baggageCodecs.mtx.RUnlock()
+	sort.Strings(keys)
+
+	var rv map[string]interface{}
+	for _, key := range keys {
+		if val := trace.Get(key); val != nil {
+			if rv == nil {
+				rv = map[string]interface{}{}
+			}
+			rv[key] = val
+		}
+	}
+	return rv
+}
+
+// encodeValues encodes the values that have a codec, leaving out values
+// whose encoding isn't safe to send.
+func encodeValues(values map[string]interface{}) map[string]string {
+	var rv map[string]string
+	for key, val := range values {
+		codec, ok := lookupBaggageCodec(key)
+		if !ok {
+			continue
+		}
+		encoded := codec.encode(val)
+		if !validEncodedValue(encoded) {
+			continue
+		}
+		if rv == nil {
+			rv = map[string]string{}
+		}
+		rv[key] = encoded
+	}
+	return rv
+}
+
+// validEncodedValue returns true if val is valid UTF-8 without control
+// characters that fits in the baggage header.
+func validEncodedValue(val string) bool {
+	if len(val) > maxBaggageSize || !utf8.ValidString(val) {
+		return false
+	}
+	for i := 0; i < len(val); i++ {
+		if val[i] < 0x20 || val[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreValues sets the given values on the trace.
+func restoreValues(trace *monkit.Trace, values map[string]interface{}) {
+	for key, val := range values {
+		trace.Set(key, val)
+	}
+}
@@ -15,6 +15,7 @@
 package http
 
 import (
+	"encoding/binary"
 	"fmt"
 	"strconv"
 	"strings"
@@ -34,6 +35,14 @@ const (
 	// (traceparent must not contain zero IDs)
 	// useful when you use curl (no client side tracing), and would like to get traces from the server.
 	orphanSampling = "sampled=true"
+
+	// priorityState prefixes the trace's sampling priority in the tracestate
+	// header.
+	priorityState = "priority="
+
+	// rateState prefixes the rate the trace's sampling decision was made
+	// with in the tracestate header.
+	rateState = "rate="
 )
 
 // TraceInfo is a structure representing an incoming RPC request. Every field
@@ -42,6 +51,37 @@ type TraceInfo struct {
 	TraceId  *int64
 	ParentId *int64
 	Sampled  bool
+
+	// TraceIdHigh holds the high 64 bits of a 128-bit trace id, in which case
+	// TraceId holds the low 64 bits. It is zero for 64-bit trace ids.
+	TraceIdHigh int64
+
+	// Baggage holds the trace baggage to propagate. See SetBaggageKeys.
+	Baggage map[string]string
+
+	// Values holds the trace values to propagate, by key. Only keys with a
+	// codec are propagated. See RegisterBaggageCodec.
+	Values map[string]interface{}
+
+	// Priority is the sampling priority of the trace, sent in the tracestate
+	// header. Requests with a priority above zero are always sampled. See
+	// monkit.Trace.SetPriority.
+	Priority int
+
+	// SampleRate is the rate the sampling decision in Sampled was made with,
+	// sent in the tracestate header, or zero if it isn't known. See
+	// monkit.SampleRateKey.
+	SampleRate float64
+}
+
+// TraceId128 returns the full width trace id, if there is one.
+func (r TraceInfo) TraceId128() (id monkit.TraceId, ok bool) {
+	if r.TraceId == nil {
+		return id, false
+	}
+	binary.BigEndian.PutUint64(id[:8], uint64(r.TraceIdHigh))
+	binary.BigEndian.PutUint64(id[8:], uint64(*r.TraceId))
+	return id, true
 }
 
 // HeaderGetter is an interface that http.Header matches for RequestFromHeader
@@ -57,36 +97,45 @@ type HeaderSetter interface {
 // TraceInfoFromHeader will create a TraceInfo object given a http.Header or
 // anything that matches the HeaderGetter interface.
 func TraceInfoFromHeader(header HeaderGetter) (rv TraceInfo) {
+	rv = traceInfoFromHeader(header)
+	rv.Baggage, rv.Values = parseBaggage(header.Get(baggageHeader))
+	rv.Priority, rv.SampleRate = parseTraceState(header.Get(traceStateHeader))
+	if rv.Priority > 0 {
+		rv.Sampled = true
+	}
+	return rv
+}
+
+// parseTraceState returns the priority and rate entries of a tracestate
+// header, if any. Rates outside of (0, 1] are ignored.
+func parseTraceState(traceState string) (priority int, rate float64) {
+	for _, entry := range strings.Split(traceState, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case strings.HasPrefix(entry, priorityState):
+			if v, err := strconv.Atoi(entry[len(priorityState):]); err == nil {
+				priority = v
+			}
+		case strings.HasPrefix(entry, rateState):
+			v, err := strconv.ParseFloat(entry[len(rateState):], 64)
+			if err == nil && v > 0 && v <= 1 {
+				rate = v
+			}
+		}
+	}
+	return priority, rate
+}
+
+func traceInfoFromHeader(header HeaderGetter) (rv TraceInfo) {
 	traceParent := header.Get(traceParentHeader)
 	traceState := header.Get(traceStateHeader)
 
 	if traceParent != "" {
-		parts := strings.Split(traceParent, "-")
-		if len(parts) != 4 {
-			return rv
-		}
-		version, err := hexToUint64(parts[0])
-		if err != nil || version != 0 {
-			return rv
-		}
-		traceID, err := hexToUint64(parts[1])
-		if err != nil {
+		info, ok := parseTraceParent(traceParent)
+		if !ok {
 			return rv
 		}
-		parentID, err := hexToUint64(parts[2])
-		if err != nil {
-			return rv
-		}
-		flags, err := hexToUint64(parts[3])
-		if err != nil {
-			return rv
-		}
-
-		return TraceInfo{
-			TraceId:  &traceID,
-			ParentId: &parentID,
-			Sampled:  (byte(flags) & traceSampled) == traceSampled,
-		}
+		return info
 	}
 
 	// trace parent is not set, but tracing can be turned on by a traceState
@@ -98,6 +147,77 @@ func TraceInfoFromHeader(header HeaderGetter) (rv TraceInfo) {
 	return rv
 }
 
+// parseTraceParent parses a traceparent header of the form
+// version-traceid-parentid-flags. Besides the fixed widths the spec requires,
+// it accepts the shorter ids older versions of this package sent. Headers
+// with an invalid version, non-hex fields, or all-zero ids are rejected.
+func parseTraceParent(traceParent string) (rv TraceInfo, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 {
+		return rv, false
+	}
+	version, err := hexToUint64(parts[0])
+	if err != nil || len(parts[0]) != 2 || version == 0xff {
+		return rv, false
+	}
+	// future versions may add fields after the flags, but version 00 must
+	// have exactly four.
+	if version == 0 && len(parts) != 4 {
+		return rv, false
+	}
+	if !validHexField(parts[1], 32) || !validHexField(parts[2], 16) ||
+		!validHexField(parts[3], 2) {
+		return rv, false
+	}
+
+	var traceIDHigh int64
+	traceIDLow := parts[1]
+	if len(traceIDLow) > 16 {
+		traceIDHigh, err = hexToUint64(traceIDLow[:len(traceIDLow)-16])
+		if err != nil {
+			return rv, false
+		}
+		traceIDLow = traceIDLow[len(traceIDLow)-16:]
+	}
+	traceID, err := hexToUint64(traceIDLow)
+	if err != nil {
+		return rv, false
+	}
+	parentID, err := hexToUint64(parts[2])
+	if err != nil {
+		return rv, false
+	}
+	flags, err := hexToUint64(parts[3])
+	if err != nil {
+		return rv, false
+	}
+	if (traceID == 0 && traceIDHigh == 0) || parentID == 0 {
+		return rv, false
+	}
+
+	return TraceInfo{
+		TraceId:     &traceID,
+		TraceIdHigh: traceIDHigh,
+		ParentId:    &parentID,
+		Sampled:     (byte(flags) & traceSampled) == traceSampled,
+	}, true
+}
+
+// validHexField returns true if s is a non-empty string of at most max hex
+// digits.
+func validHexField(s string, max int) bool {
+	if len(s) == 0 || len(s) > max {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
 func ref(v int64) *int64 {
 	return &v
 }
@@ -106,15 +226,33 @@ func TraceInfoFromSpan(s *monkit.Span) TraceInfo {
 	trace := s.Trace()
 
 	sampled, _ := trace.Get(present.SampledKey).(bool)
+	rate, _ := trace.Get(monkit.SampleRateKey).(float64)
+	priority := trace.Priority()
+	if priority > 0 {
+		sampled = true
+	}
+
+	var baggage map[string]string
+	if all := trace.AllBaggage(); len(all) > 0 {
+		baggage = all
+	}
+
+	values := traceValues(trace)
 
 	if !sampled {
-		return TraceInfo{Sampled: sampled}
+		return TraceInfo{Sampled: sampled, Baggage: baggage, Values: values,
+			SampleRate: rate}
 	}
 
 	req := TraceInfo{
-		TraceId:  ref(trace.Id()),
-		ParentId: ref(s.Id()),
-		Sampled:  sampled,
+		TraceId:     ref(trace.Id()),
+		TraceIdHigh: trace.Id128().High(),
+		ParentId:    ref(s.Id()),
+		Sampled:     sampled,
+		Baggage:     baggage,
+		Values:      values,
+		Priority:    priority,
+		SampleRate:  rate,
 	}
 	if parentID, hasParent := s.ParentId(); hasParent {
 		req.ParentId = ref(parentID)
@@ -129,10 +267,26 @@ func (r TraceInfo) SetHeader(header HeaderSetter) {
 	if r.Sampled {
 		sampled = traceSampled
 	}
+	var traceState []string
 	if r.TraceId != nil && r.ParentId != nil {
-		header.Set(traceParentHeader, fmt.Sprintf("00-%016x-%08x-%x", *r.TraceId, *r.ParentId, int(sampled)))
+		header.Set(traceParentHeader, fmt.Sprintf("00-%016x%016x-%016x-%02x",
+			uint64(r.TraceIdHigh), uint64(*r.TraceId), uint64(*r.ParentId), sampled))
 	} else if r.Sampled {
-		header.Set(traceStateHeader, orphanSampling)
+		traceState = append(traceState, orphanSampling)
+	}
+	if r.Priority > 0 {
+		traceState = append(traceState,
+			priorityState+strconv.Itoa(r.Priority))
+	}
+	if r.SampleRate > 0 {
+		traceState = append(traceState,
+			rateState+strconv.FormatFloat(r.SampleRate, 'g', -1, 64))
+	}
+	if len(traceState) > 0 {
+		header.Set(traceStateHeader, strings.Join(traceState, ","))
+	}
+	if baggage := formatBaggage(r.Baggage, encodeValues(r.Values)); baggage != "" {
+		header.Set(baggageHeader, baggage)
 	}
 
 }
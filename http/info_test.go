@@ -28,7 +28,7 @@ func TestSetHeader(t *testing.T) {
 				ParentId: ref(2),
 				Sampled:  false,
 			},
-			expectedParent: "00-0000000000000001-00000002-0",
+			expectedParent: "00-00000000000000000000000000000001-0000000000000002-00",
 			expectedState:  "",
 		},
 		{
@@ -43,7 +43,24 @@ func TestSetHeader(t *testing.T) {
 				ParentId: ref(16),
 				Sampled:  true,
 			},
-			expectedParent: "00-0000000000000001-00000010-1",
+			expectedParent: "00-00000000000000000000000000000001-0000000000000010-01",
+			expectedState:  "",
+		},
+		{
+			name: "128-bit trace id",
+			info: TraceInfo{
+				TraceId:     ref(1),
+				TraceIdHigh: 0x0af7651916cd43dd,
+				ParentId:    ref(16),
+				Sampled:     true,
+			},
+			expectedInfo: TraceInfo{
+				TraceId:     ref(1),
+				TraceIdHigh: 0x0af7651916cd43dd,
+				ParentId:    ref(16),
+				Sampled:     true,
+			},
+			expectedParent: "00-0af7651916cd43dd0000000000000001-0000000000000010-01",
 			expectedState:  "",
 		},
 		{
@@ -61,6 +78,63 @@ func TestSetHeader(t *testing.T) {
 			expectedParent: "",
 			expectedState:  "sampled=true",
 		},
+		{
+			name: "priority",
+			info: TraceInfo{
+				TraceId:  ref(1),
+				ParentId: ref(16),
+				Priority: 2,
+			},
+			expectedInfo: TraceInfo{
+				TraceId:  ref(1),
+				ParentId: ref(16),
+				Sampled:  true,
+				Priority: 2,
+			},
+			expectedParent: "00-00000000000000000000000000000001-0000000000000010-00",
+			expectedState:  "priority=2",
+		},
+		{
+			name: "priority without trace",
+			info: TraceInfo{
+				Sampled:  true,
+				Priority: 1,
+			},
+			expectedInfo: TraceInfo{
+				Sampled:  true,
+				Priority: 1,
+			},
+			expectedParent: "",
+			expectedState:  "sampled=true,priority=1",
+		},
+		{
+			name: "sample rate",
+			info: TraceInfo{
+				TraceId:    ref(1),
+				ParentId:   ref(16),
+				Sampled:    true,
+				SampleRate: 0.25,
+			},
+			expectedInfo: TraceInfo{
+				TraceId:    ref(1),
+				ParentId:   ref(16),
+				Sampled:    true,
+				SampleRate: 0.25,
+			},
+			expectedParent: "00-00000000000000000000000000000001-0000000000000010-01",
+			expectedState:  "rate=0.25",
+		},
+		{
+			name: "sample rate without trace, not sampled",
+			info: TraceInfo{
+				SampleRate: 0.001,
+			},
+			expectedInfo: TraceInfo{
+				SampleRate: 0.001,
+			},
+			expectedParent: "",
+			expectedState:  "rate=0.001",
+		},
 		{
 			name: "no trace, no sampled",
 			info: TraceInfo{
@@ -90,10 +164,19 @@ func TestSetHeader(t *testing.T) {
 			}
 			rv := TraceInfoFromHeader(header)
 			checkEq(t, tc.expectedInfo.TraceId, rv.TraceId)
+			if tc.expectedInfo.TraceIdHigh != rv.TraceIdHigh {
+				t.Fatalf("%x!=%x", tc.expectedInfo.TraceIdHigh, rv.TraceIdHigh)
+			}
 			checkEq(t, tc.expectedInfo.ParentId, rv.ParentId)
 			if tc.expectedInfo.Sampled != rv.Sampled {
 				t.Fatalf("%v!=%v", tc.expectedInfo.Sampled, rv.Sampled)
 			}
+			if tc.expectedInfo.Priority != rv.Priority {
+				t.Fatalf("%d!=%d", tc.expectedInfo.Priority, rv.Priority)
+			}
+			if tc.expectedInfo.SampleRate != rv.SampleRate {
+				t.Fatalf("%v!=%v", tc.expectedInfo.SampleRate, rv.SampleRate)
+			}
 		})
 
 	}
@@ -111,3 +194,64 @@ func checkEq(t *testing.T, v1 *int64, v2 *int64) {
 		t.Fatalf("%d!=%d", v1, v2)
 	}
 }
+
+func TestTraceInfoFromHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		traceParent  string
+		expectedInfo TraceInfo
+	}{
+		{
+			name:        "spec example",
+			traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expectedInfo: TraceInfo{
+				TraceId:     ref(-0x5c316d62f1f1b8ca),
+				TraceIdHigh: 0x4bf92f3577b34da6,
+				ParentId:    ref(0x00f067aa0ba902b7),
+				Sampled:     true,
+			},
+		},
+		{
+			name:        "legacy widths",
+			traceParent: "00-0000000000000001-00000002-1",
+			expectedInfo: TraceInfo{
+				TraceId:  ref(1),
+				ParentId: ref(2),
+				Sampled:  true,
+			},
+		},
+		{
+			name:        "future version with extra fields",
+			traceParent: "01-00000000000000000000000000000001-0000000000000002-00-extra",
+			expectedInfo: TraceInfo{
+				TraceId:  ref(1),
+				ParentId: ref(2),
+			},
+		},
+		{name: "zero trace id", traceParent: "00-00000000000000000000000000000000-0000000000000002-01"},
+		{name: "zero parent id", traceParent: "00-00000000000000000000000000000001-0000000000000000-01"},
+		{name: "invalid version", traceParent: "ff-00000000000000000000000000000001-0000000000000002-01"},
+		{name: "extra fields", traceParent: "00-00000000000000000000000000000001-0000000000000002-01-00"},
+		{name: "too few fields", traceParent: "00-00000000000000000000000000000001-01"},
+		{name: "trace id too long", traceParent: "00-000000000000000000000000000000001-0000000000000002-01"},
+		{name: "not hex", traceParent: "00-0000000000000000000000000000000g-0000000000000002-01"},
+		{name: "signed", traceParent: "00-+0000000000000000000000000000001-0000000000000002-01"},
+		{name: "empty fields", traceParent: "00---01"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(traceParentHeader, tc.traceParent)
+			rv := TraceInfoFromHeader(header)
+			checkEq(t, tc.expectedInfo.TraceId, rv.TraceId)
+			checkEq(t, tc.expectedInfo.ParentId, rv.ParentId)
+			if tc.expectedInfo.TraceIdHigh != rv.TraceIdHigh {
+				t.Fatalf("%x!=%x", tc.expectedInfo.TraceIdHigh, rv.TraceIdHigh)
+			}
+			if tc.expectedInfo.Sampled != rv.Sampled {
+				t.Fatalf("%v!=%v", tc.expectedInfo.Sampled, rv.Sampled)
+			}
+		})
+	}
+}
@@ -29,12 +29,12 @@ func (t traceHandler) ServeHTTP(writer http.ResponseWriter, request *http.Reques
 
 	info := TraceInfoFromHeader(request.Header)
 
-	traceId := monkit.NewId()
-	if info.TraceId != nil {
-		traceId = *info.TraceId
+	var trace *monkit.Trace
+	if traceId, ok := info.TraceId128(); ok {
+		trace = monkit.NewTrace128(traceId)
+	} else {
+		trace = monkit.NewTrace(monkit.NewId())
 	}
-
-	trace := monkit.NewTrace(traceId)
 	ctx := request.Context()
 
 	parent := int64(0)
@@ -45,6 +45,16 @@ func (t traceHandler) ServeHTTP(writer http.ResponseWriter, request *http.Reques
 	if info.Sampled {
 		trace.Set(present.SampledKey, true)
 	}
+	if info.SampleRate > 0 {
+		// the caller decided at this rate, so keep its decision either way.
+		trace.Set(monkit.SampleRateKey, info.SampleRate)
+		trace.Set(present.SampledKey, info.Sampled)
+	}
+	if info.Priority > 0 {
+		trace.SetPriority(info.Priority)
+	}
+	restoreBaggage(trace, info.Baggage)
+	restoreValues(trace, info.Values)
 	defer t.scope.Func().RemoteTrace(&ctx, parent, trace)(nil)
 
 	if cb, exists := trace.Get(present.SampledCBKey).(func(*monkit.Trace)); exists {
@@ -52,6 +62,11 @@ func (t traceHandler) ServeHTTP(writer http.ResponseWriter, request *http.Reques
 	}
 
 	s := monkit.SpanFromCtx(ctx)
+	if s == nil {
+		// the scope is disabled, so the request isn't traced
+		t.handler.ServeHTTP(writer, request)
+		return
+	}
 	s.Annotate("http.uri", request.RequestURI)
 
 	wrapped, statusCode := Wrap(writer)
@@ -60,5 +75,9 @@ func (t traceHandler) ServeHTTP(writer http.ResponseWriter, request *http.Reques
 	}
 	t.handler.ServeHTTP(wrapped, request.WithContext(s))
 
-	s.Annotate("http.responsecode", fmt.Sprint(statusCode()))
+	code := statusCode()
+	s.Annotate("http.responsecode", fmt.Sprint(code))
+	if code >= http.StatusInternalServerError {
+		s.SetStatus(monkit.StatusError, http.StatusText(code))
+	}
 }
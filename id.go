@@ -17,6 +17,7 @@ package monkit
 import (
 	crand "crypto/rand"
 	"encoding/binary"
+	"encoding/hex"
 	"math/rand"
 	"sync/atomic"
 
@@ -46,3 +47,67 @@ func NewId() int64 {
 	id := atomic.AddUint64(&idCounter, inc)
 	return int64(id >> 1)
 }
+
+type idGeneratorRef struct {
+	gen func() int64
+}
+
+// SetIdGenerator sets the func that generates the ids of new Spans and of the
+// Traces that Tasks start, so that they can embed a shard prefix or be
+// derived from an external correlation id. gen may be called concurrently
+// from many goroutines and must return ids that don't collide with each other
+// or with ids generated elsewhere in the same trace. Passing nil restores the
+// default of NewId. Traces created directly with NewTrace are not affected.
+func (r *Registry) SetIdGenerator(gen func() int64) {
+	if gen == nil {
+		storeIdGeneratorRef(&r.idGenerator, nil)
+		return
+	}
+	storeIdGeneratorRef(&r.idGenerator, &idGeneratorRef{gen: gen})
+}
+
+func (r *registryInternal) newId() int64 {
+	if gen := loadIdGeneratorRef(&r.idGenerator); gen != nil {
+		return gen.gen()
+	}
+	return NewId()
+}
+
+// TraceId is a 128-bit trace id, as used by distributed tracing systems such
+// as W3C Trace Context and OpenTelemetry. The bytes are in big-endian order,
+// so the low 64 bits are the last 8 bytes.
+type TraceId [16]byte
+
+// TraceIdFromInt64 returns the TraceId with the given low 64 bits and zeroed
+// high 64 bits.
+func TraceIdFromInt64(low int64) (rv TraceId) {
+	binary.BigEndian.PutUint64(rv[8:], uint64(low))
+	return rv
+}
+
+// NewId128 returns a random 128-bit trace id. See NewTrace128.
+func NewId128() (rv TraceId) {
+	binary.BigEndian.PutUint64(rv[:8], uint64(NewId()))
+	binary.BigEndian.PutUint64(rv[8:], uint64(NewId()))
+	return rv
+}
+
+// High returns the high 64 bits of the trace id.
+func (id TraceId) High() int64 {
+	return int64(binary.BigEndian.Uint64(id[:8]))
+}
+
+// Low returns the low 64 bits of the trace id. This is what Trace.Id returns.
+func (id TraceId) Low() int64 {
+	return int64(binary.BigEndian.Uint64(id[8:]))
+}
+
+// IsZero returns true if all bits of the trace id are zero.
+func (id TraceId) IsZero() bool {
+	return id == TraceId{}
+}
+
+// String returns the trace id as 32 lowercase hex characters.
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+// indexKey is an annotation name and value pair in the annotation index.
+type indexKey struct {
+	name, value string
+}
+
+// IndexAnnotation adds the annotation with the given name to the index of
+// the recently completed traces the Registry keeps, so that
+// FindTracesByAnnotation can find the traces with a given value for it
+// without looking at every trace. Only indexed annotation names incur the
+// cost of maintaining the index, which is paid when a trace completes or is
+// evicted. The traces that are already kept are indexed right away. Like the
+// recent traces themselves, the index only covers traces that complete while
+// the Registry is keeping recent traces. See SetRecentTraceCapacity.
+func (r *Registry) IndexAnnotation(name string) {
+	r.recentMtx.Lock()
+	defer r.recentMtx.Unlock()
+	if r.indexed[name] {
+		return
+	}
+	if r.indexed == nil {
+		r.indexed = map[string]bool{}
+	}
+	r.indexed[name] = true
+	r.rebuildIndex()
+}
+
+// FindTracesByAnnotation returns the recently completed traces that have a
+// Span with the given annotation, most recent first. The annotation name must
+// have been indexed with IndexAnnotation; otherwise, or if no trace matches,
+// nil is returned.
+func (r *Registry) FindTracesByAnnotation(name, value string) []*Trace {
+	r.recentMtx.Lock()
+	defer r.recentMtx.Unlock()
+	traces := r.index[indexKey{name: name, value: value}]
+	if len(traces) == 0 {
+		return nil
+	}
+	rv := make([]*Trace, 0, len(traces))
+	seen := make(map[*Trace]bool, len(traces))
+	for i := len(traces) - 1; i >= 0; i-- {
+		if t := traces[i]; !seen[t] {
+			seen[t] = true
+			rv = append(rv, t)
+		}
+	}
+	return rv
+}
+
+// indexKeys returns the distinct indexed annotations of the trace's finished
+// Spans. recentMtx must be held.
+func (r *Registry) indexKeys(t *Trace) (keys []indexKey) {
+	if len(r.indexed) == 0 {
+		return nil
+	}
+	seen := map[indexKey]bool{}
+	t.FinishedSpans(func(s *Span) {
+		for _, a := range s.Annotations() {
+			key := indexKey{name: a.Name, value: a.Value}
+			if r.indexed[a.Name] && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	})
+	return keys
+}
+
+// indexTrace adds the trace in the given slot of the recent traces to the
+// index. It must be newer than every trace already indexed. recentMtx must be
+// held.
+func (r *Registry) indexTrace(slot int) {
+	if len(r.indexed) == 0 {
+		return
+	}
+	t := r.recent[slot]
+	keys := r.indexKeys(t)
+	r.recentKeys[slot] = keys
+	if len(keys) > 0 && r.index == nil {
+		r.index = map[indexKey][]*Trace{}
+	}
+	for _, key := range keys {
+		r.index[key] = append(r.index[key], t)
+	}
+}
+
+// unindexTrace removes the trace in the given slot of the recent traces
+// from the index. It must be older than every other trace indexed, which is
+// always the case for the trace being evicted. recentMtx must be held.
+func (r *Registry) unindexTrace(slot int) {
+	if len(r.recentKeys) <= slot {
+		return
+	}
+	for _, key := range r.recentKeys[slot] {
+		if traces := r.index[key]; len(traces) > 1 {
+			traces[0] = nil
+			r.index[key] = traces[1:]
+		} else {
+			delete(r.index, key)
+		}
+	}
+	r.recentKeys[slot] = nil
+}
+
+// rebuildIndex indexes all of the recent traces from scratch. recentMtx must
+// be held.
+func (r *Registry) rebuildIndex() {
+	r.index = nil
+	r.recentKeys = nil
+	if len(r.indexed) == 0 {
+		return
+	}
+	r.recentKeys = make([][]indexKey, len(r.recent))
+	for i := r.recentLen - 1; i >= 0; i-- {
+		slot := r.recentNext - 1 - i
+		if slot < 0 {
+			slot += len(r.recent)
+		}
+		r.indexTrace(slot)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+// +build go1.23
+
+package monkit
+
+import (
+	"iter"
+)
+
+// ScopesSeq is like Scopes, but returns an iterator over the Registry's
+// Scopes, so that callers can range over them and stop early.
+func (r *Registry) ScopesSeq() iter.Seq[*Scope] {
+	return func(yield func(*Scope) bool) {
+		for _, s := range r.scopeList() {
+			if !yield(s) {
+				return
+			}
+		}
+	}
+}
+
+// FuncsSeq is like Funcs, but returns an iterator over all of the Registry's
+// Funcs.
+func (r *Registry) FuncsSeq() iter.Seq[*Func] {
+	return func(yield func(*Func) bool) {
+		for _, s := range r.scopeList() {
+			for _, f := range s.funcList() {
+				if !yield(f) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// RootSpansSeq is like RootSpans, but returns an iterator over the
+// Registry's root Spans.
+func (r *Registry) RootSpansSeq() iter.Seq[*Span] {
+	return func(yield func(*Span) bool) {
+		for _, s := range r.rootSpanList() {
+			if !yield(s) {
+				return
+			}
+		}
+	}
+}
+
+// StatsSeq is like Stats, but returns an iterator over the Registry's stats,
+// keyed by the series key and field as formatted by SeriesKey.WithField.
+// Stopping early stops the walk at the next Scope; the values of the current
+// Scope that remain are computed but not yielded.
+func (r *Registry) StatsSeq() iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		stopped := false
+		cb := func(key SeriesKey, field string, val float64) {
+			if !stopped && !yield(key.WithField(field), val) {
+				stopped = true
+			}
+		}
+		for _, t := range r.transformers {
+			cb = t.Transform(cb)
+		}
+		for _, s := range r.scopeList() {
+			s.ownStats(cb)
+			if stopped {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+// +build go1.23
+
+package monkit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegistrySeqs(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		mon := r.ScopeNamed(name)
+		mon.FuncNamed("f")
+		mon.Counter("count").Inc(1)
+	}
+
+	var scopes []string
+	for s := range r.ScopesSeq() {
+		scopes = append(scopes, s.Name())
+		if s.Name() == "b" {
+			break
+		}
+	}
+	if len(scopes) != 2 || scopes[0] != "a" || scopes[1] != "b" {
+		t.Fatalf("unexpected scopes: %v", scopes)
+	}
+
+	funcs := 0
+	for range r.FuncsSeq() {
+		funcs++
+	}
+	if funcs != 3 {
+		t.Fatalf("expected 3 funcs, got %d", funcs)
+	}
+
+	stats := 0
+	for name, val := range r.StatsSeq() {
+		if stats++; stats == 1 && (name == "" || val != val) {
+			t.Fatalf("unexpected first stat %q %v", name, val)
+		}
+		if stats == 5 {
+			break
+		}
+	}
+	if stats != 5 {
+		t.Fatalf("expected to stop after 5 stats, got %d", stats)
+	}
+
+	ctx := context.Background()
+	defer r.ScopeNamed("a").Task()(&ctx)(nil)
+	roots := 0
+	for s := range r.RootSpansSeq() {
+		if s != SpanFromCtx(ctx) {
+			t.Fatal("unexpected root span")
+		}
+		roots++
+	}
+	if roots != 1 {
+		t.Fatalf("expected 1 root span, got %d", roots)
+	}
+}
@@ -51,6 +51,7 @@ type meterBucket struct {
 //   }
 //
 type Meter struct {
+	scopeGate
 	mtx    sync.Mutex
 	total  int64
 	slices [ticksToKeep]meterBucket
@@ -75,9 +76,8 @@ func (e *Meter) Reset(new_total int64) {
 	e.mtx.Lock()
 	e.total = new_total
 	now := monotime.Now()
-	for _, slice := range e.slices {
-		slice.count = 0
-		slice.start = now
+	for i := range e.slices {
+		e.slices[i] = meterBucket{count: 0, start: now}
 	}
 	e.mtx.Unlock()
 }
@@ -91,15 +91,15 @@ func (e *Meter) SetTotal(total int64) {
 
 // Mark marks amount events occurring in the current time window.
 func (e *Meter) Mark(amount int) {
-	e.mtx.Lock()
-	e.slices[ticksToKeep-1].count += int64(amount)
-	e.mtx.Unlock()
+	e.Mark64(int64(amount))
 }
 
 // Mark64 marks amount events occurring in the current time window (int64 version).
 func (e *Meter) Mark64(amount int64) {
 	e.mtx.Lock()
-	e.slices[ticksToKeep-1].count += amount
+	if !e.off() {
+		e.slices[ticksToKeep-1].count += amount
+	}
 	e.mtx.Unlock()
 }
 
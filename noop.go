@@ -0,0 +1,75 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import "context"
+
+// NewNoopRegistry creates a Registry whose Scopes are permanently disabled
+// (see Scope.SetEnabled), for benchmarks and for builds that want monitoring
+// compiled down to as little as possible. Tasks from its Scopes don't create
+// Spans or Traces, allocate nothing, and cost about as much as a call through
+// a func value, and its Stats reports nothing. As with disabled Scopes,
+// SpanFromCtx returns nil within its Tasks. Counters, Vals and other
+// StatSources retrieved from its Scopes drop what they are given, but looking
+// them up still costs a map lookup, so keep them in variables rather than
+// looking them up on every use.
+//
+// Building with the monkit_noop build tag makes Default a no-op Registry, so
+// code instrumented through Package or ScopeNamed needs no changes:
+//
+//	go test -tags monkit_noop -bench .
+func NewNoopRegistry() *Registry {
+	r := NewRegistry()
+	r.noop = true
+	return r
+}
+
+// newNoopTask returns the Task that Scope.Task and its variants return on a
+// no-op Registry. It starts nothing, and since it is never told which
+// function it monitors, its Func is the Func of the function calling
+// Task.Func.
+func (s *Scope) newNoopTask(tags []SeriesTag) Task {
+	return Task(func(ctx *context.Context,
+		args ...interface{}) func(*error) {
+		if ctx == &taskSecret &&
+			taskArgs(s.FuncNamed(callerFunc(1), tags...), args) {
+			return nil
+		}
+		return disabledExit
+	})
+}
+
+// noopTaskNamed returns the Task that TaskNamed returns on a no-op Registry.
+// Tasks without SeriesTags are remembered by name, so that TaskNamed doesn't
+// allocate.
+func (s *Scope) noopTaskNamed(name string, tags []SeriesTag) Task {
+	if len(tags) > 0 {
+		return s.FuncNamed(name, tags...).Task
+	}
+	s.mtx.RLock()
+	task, ok := s.noopTasks[name]
+	s.mtx.RUnlock()
+	if ok {
+		return task
+	}
+	task = s.FuncNamed(name).Task
+	s.mtx.Lock()
+	if s.noopTasks == nil {
+		s.noopTasks = map[string]Task{}
+	}
+	s.noopTasks[name] = task
+	s.mtx.Unlock()
+	return task
+}
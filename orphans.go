@@ -0,0 +1,78 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"time"
+)
+
+// SetOrphanMaxAge configures how long an orphaned Span may stay listed with
+// the Registry's root Spans before it is considered leaked, for instance
+// because the goroutine running it was abandoned and it will never finish.
+// While maxAge is positive, orphans that were orphaned longer than maxAge ago
+// are removed and counted in the leaked_orphans Counter of the monkit package
+// Scope. Reaping is done lazily, whenever the root Spans are listed and, at
+// most once every maxAge/2, when a Span is orphaned, so it needs no
+// background goroutine. Reaped Spans are only forgotten by the Registry; they
+// may still finish normally. The default of 0 disables reaping.
+func (r *Registry) SetOrphanMaxAge(maxAge time.Duration) {
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	var leaked *Counter
+	if maxAge > 0 {
+		leaked = r.ScopeNamed(selfScope).Counter("leaked_orphans")
+	}
+
+	r.orphanMtx.Lock()
+	defer r.orphanMtx.Unlock()
+	r.orphanMaxAge = maxAge
+	r.leakedOrphans = leaked
+}
+
+// reapOrphans removes orphans older than the configured max age and returns
+// how many were removed.
+func (r *Registry) reapOrphans() (reaped int) {
+	r.orphanMtx.Lock()
+	defer r.orphanMtx.Unlock()
+	return r.reapOrphansLocked(r.now())
+}
+
+// maybeReapOrphansLocked is like reapOrphansLocked, but only reaps if the
+// last reap was at least half the max age ago, so that orphaning Spans stays
+// cheap. r.orphanMtx must be held.
+func (r *Registry) maybeReapOrphansLocked(now time.Time) {
+	if r.orphanMaxAge > 0 && now.Sub(r.lastOrphanReap) >= r.orphanMaxAge/2 {
+		r.reapOrphansLocked(now)
+	}
+}
+
+// reapOrphansLocked is like reapOrphans. r.orphanMtx must be held.
+func (r *Registry) reapOrphansLocked(now time.Time) (reaped int) {
+	if r.orphanMaxAge <= 0 {
+		return 0
+	}
+	r.lastOrphanReap = now
+	for s, orphanedAt := range r.orphans {
+		if now.Sub(orphanedAt) > r.orphanMaxAge {
+			delete(r.orphans, s)
+			reaped++
+		}
+	}
+	if reaped > 0 {
+		r.leakedOrphans.Inc(int64(reaped))
+	}
+	return reaped
+}
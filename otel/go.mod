@@ -0,0 +1,24 @@
+module github.com/spacemonkeygo/monkit/v3/otel
+
+// The OpenTelemetry SDK requires go 1.25. Only users of this package need
+// it; the monkit module itself still supports go 1.13.
+go 1.25.0
+
+require (
+	github.com/spacemonkeygo/monkit/v3 v3.1.0
+	go.opentelemetry.io/otel v1.44.0
+	go.opentelemetry.io/otel/sdk v1.44.0
+	go.opentelemetry.io/otel/trace v1.44.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	go.opentelemetry.io/otel/metric v1.44.0 // indirect
+	golang.org/x/sys v0.45.0 // indirect
+)
+
+replace github.com/spacemonkeygo/monkit/v3 => ../
@@ -0,0 +1,219 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otel exports monkit traces to OpenTelemetry span exporters.
+package otel // import "github.com/spacemonkeygo/monkit/v3/otel"
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	otelglobal "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+const (
+	// instrumentationName is reported as the instrumentation scope of all
+	// exported spans.
+	instrumentationName = "github.com/spacemonkeygo/monkit/v3"
+
+	// queueSize is how many batches of spans can be waiting to be exported
+	// before new batches are dropped.
+	queueSize = 64
+)
+
+// ObserveForExport watches all new traces on the registry and exports their
+// spans to the given OpenTelemetry exporter. Spans are batched per trace and
+// handed to the exporter once all of the trace's spans have finished. Exporting
+// happens on a separate goroutine so slow exporters don't hold up traced code;
+// if the exporter falls too far behind, batches are dropped.
+//
+// Func full names become span names, annotations become attributes, and monkit
+// ids become OpenTelemetry ids: 128-bit monkit trace ids map directly, 64-bit
+// monkit trace ids are stored in the low 8 bytes of the OpenTelemetry trace
+// id, and span ids map directly.
+// Orphaned spans keep their original parent. Spans with a remote parent have
+// their parent marked as remote. Span links become OpenTelemetry links to
+// remote span contexts, span events become OpenTelemetry events, and span
+// statuses (see monkit.Span.Status) become OpenTelemetry statuses.
+//
+// The returned cancel func stops observing traces, flushes any spans that
+// have been collected so far, and waits for pending exports to finish. It does
+// not shut down the exporter.
+func ObserveForExport(r *monkit.Registry, exporter sdktrace.SpanExporter) (
+	cancel func()) {
+	e := newTraceExporter(exporter)
+	stop := r.ObserveFinishedTraces(e.export)
+	return func() {
+		stop()
+		e.close()
+	}
+}
+
+type traceExporter struct {
+	exporter sdktrace.SpanExporter
+	batches  chan []sdktrace.ReadOnlySpan
+	done     chan struct{}
+
+	mtx    sync.Mutex
+	closed bool
+}
+
+func newTraceExporter(exporter sdktrace.SpanExporter) *traceExporter {
+	e := &traceExporter{
+		exporter: exporter,
+		batches:  make(chan []sdktrace.ReadOnlySpan, queueSize),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *traceExporter) run() {
+	defer close(e.done)
+	for batch := range e.batches {
+		err := e.exporter.ExportSpans(context.Background(), batch)
+		if err != nil {
+			otelglobal.Handle(err)
+		}
+	}
+}
+
+// export queues the spans of a finished trace for export.
+func (e *traceExporter) export(t *monkit.Trace, spans []*monkit.FinishedSpan) {
+	batch := make([]sdktrace.ReadOnlySpan, 0, len(spans))
+	for _, s := range spans {
+		batch = append(batch, convertSpan(s.Span, s.Finish))
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.batches <- batch:
+	default:
+	}
+}
+
+func (e *traceExporter) close() {
+	e.mtx.Lock()
+	if e.closed {
+		e.mtx.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.batches)
+	e.mtx.Unlock()
+	<-e.done
+}
+
+// TraceID converts a monkit trace id to an OpenTelemetry trace id.
+func TraceID(id int64) (rv trace.TraceID) {
+	binary.BigEndian.PutUint64(rv[8:], uint64(id))
+	return rv
+}
+
+// SpanID converts a monkit span id to an OpenTelemetry span id.
+func SpanID(id int64) (rv trace.SpanID) {
+	binary.BigEndian.PutUint64(rv[:], uint64(id))
+	return rv
+}
+
+func convertSpan(s *monkit.Span, finish time.Time) sdktrace.ReadOnlySpan {
+	traceId := trace.TraceID(s.Trace().Id128())
+	span := &readOnlySpan{
+		name: s.Func().FullName(),
+		spanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceId,
+			SpanID:     SpanID(s.Id()),
+			TraceFlags: trace.FlagsSampled,
+		}),
+		start: s.WallStart(),
+		end:   s.WallTime(finish),
+	}
+	if parentId, ok := s.ParentId(); ok {
+		span.parent = trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceId,
+			SpanID:     SpanID(parentId),
+			TraceFlags: trace.FlagsSampled,
+			Remote:     s.Parent() == nil,
+		})
+	}
+
+	if args := s.Args(); len(args) > 0 {
+		span.attributes = append(span.attributes,
+			attribute.StringSlice("monkit.args", args))
+	}
+	if s.Orphaned() {
+		span.attributes = append(span.attributes,
+			attribute.Bool("monkit.orphaned", true))
+	}
+	for _, annotation := range s.Annotations() {
+		span.attributes = append(span.attributes, convertAnnotation(annotation))
+	}
+	for _, event := range s.Events() {
+		span.events = append(span.events, sdktrace.Event{
+			Name: event.Name,
+			Time: s.WallTime(event.Time),
+		})
+	}
+	for _, link := range s.Links() {
+		span.links = append(span.links, sdktrace.Link{
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID: trace.TraceID(link.TraceId),
+				SpanID:  SpanID(link.SpanId),
+				Remote:  true,
+			}),
+		})
+	}
+
+	switch code, message := s.Status(); code {
+	case monkit.StatusOK:
+		span.status = sdktrace.Status{Code: codes.Ok}
+	case monkit.StatusError:
+		span.status = sdktrace.Status{Code: codes.Error, Description: message}
+	}
+
+	return span
+}
+
+func convertAnnotation(a monkit.Annotation) attribute.KeyValue {
+	switch val := a.Raw.(type) {
+	case bool:
+		return attribute.Bool(a.Name, val)
+	case int:
+		return attribute.Int(a.Name, val)
+	case int32:
+		return attribute.Int64(a.Name, int64(val))
+	case int64:
+		return attribute.Int64(a.Name, val)
+	case float32:
+		return attribute.Float64(a.Name, float64(val))
+	case float64:
+		return attribute.Float64(a.Name, val)
+	case fmt.Stringer:
+		return attribute.String(a.Name, val.String())
+	}
+	return attribute.String(a.Name, a.Value)
+}
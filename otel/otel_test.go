@@ -0,0 +1,89 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestObserveForExport(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("test")
+	exporter := tracetest.NewInMemoryExporter()
+	cancel := ObserveForExport(r, exporter)
+
+	var traceId int64
+	linked := monkit.NewId128()
+	func() {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		monkit.SpanFromCtx(ctx).SetStatus(monkit.StatusOK, "")
+		traceId = monkit.SpanFromCtx(ctx).Trace().Id()
+		func(ctx context.Context) (err error) {
+			defer mon.Task()(&ctx)(&err)
+			monkit.SpanFromCtx(ctx).AnnotateValue("bytes", int64(1024))
+			monkit.SpanFromCtx(ctx).AddLink(linked, 8)
+			monkit.SpanFromCtx(ctx).AddEvent("sent query")
+			return errors.New("oops")
+		}(ctx)
+	}()
+	cancel()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	child, root := spans[0], spans[1]
+	if root.Parent.IsValid() {
+		t.Fatalf("expected root span to have no parent")
+	}
+	if child.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Fatalf("child parent mismatch")
+	}
+	if child.SpanContext.TraceID() != TraceID(traceId) ||
+		root.SpanContext.TraceID() != TraceID(traceId) {
+		t.Fatalf("trace id mismatch")
+	}
+	if child.Status.Code != codes.Error || child.Status.Description != "oops" {
+		t.Fatalf("unexpected status: %v", child.Status)
+	}
+	if root.Status.Code != codes.Ok {
+		t.Fatalf("unexpected root status: %v", root.Status)
+	}
+	attrs := map[string]attribute.Value{}
+	for _, attr := range child.Attributes {
+		attrs[string(attr.Key)] = attr.Value
+	}
+	if attrs["bytes"].AsInt64() != 1024 || attrs["error"].AsString() != "oops" {
+		t.Fatalf("unexpected attributes: %v", child.Attributes)
+	}
+	if len(child.Links) != 1 ||
+		child.Links[0].SpanContext.TraceID() != trace.TraceID(linked) ||
+		child.Links[0].SpanContext.SpanID() != SpanID(8) {
+		t.Fatalf("unexpected links: %v", child.Links)
+	}
+	if len(child.Events) != 1 || child.Events[0].Name != "sent query" {
+		t.Fatalf("unexpected events: %v", child.Events)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// readOnlySpan is a finished monkit span converted for export. It implements
+// every method of sdktrace.ReadOnlySpan itself; the embedded interface is
+// always nil and only provides the interface's unexported method, which the
+// SDK uses to keep other packages from implementing it.
+type readOnlySpan struct {
+	sdktrace.ReadOnlySpan
+
+	name        string
+	spanContext trace.SpanContext
+	parent      trace.SpanContext
+	start, end  time.Time
+	attributes  []attribute.KeyValue
+	links       []sdktrace.Link
+	events      []sdktrace.Event
+	status      sdktrace.Status
+}
+
+var _ sdktrace.ReadOnlySpan = (*readOnlySpan)(nil)
+
+func (s *readOnlySpan) Name() string                     { return s.name }
+func (s *readOnlySpan) SpanContext() trace.SpanContext   { return s.spanContext }
+func (s *readOnlySpan) Parent() trace.SpanContext        { return s.parent }
+func (s *readOnlySpan) SpanKind() trace.SpanKind         { return trace.SpanKindInternal }
+func (s *readOnlySpan) StartTime() time.Time             { return s.start }
+func (s *readOnlySpan) EndTime() time.Time               { return s.end }
+func (s *readOnlySpan) Attributes() []attribute.KeyValue { return s.attributes }
+func (s *readOnlySpan) Links() []sdktrace.Link           { return s.links }
+func (s *readOnlySpan) Events() []sdktrace.Event         { return s.events }
+func (s *readOnlySpan) Status() sdktrace.Status          { return s.status }
+func (s *readOnlySpan) Resource() *resource.Resource     { return resource.Empty() }
+func (s *readOnlySpan) DroppedAttributes() int           { return 0 }
+func (s *readOnlySpan) DroppedLinks() int                { return 0 }
+func (s *readOnlySpan) DroppedEvents() int               { return 0 }
+
+// ChildSpanCount is always 0, since monkit stops tracking the children of a
+// span once they finish.
+func (s *readOnlySpan) ChildSpanCount() int { return 0 }
+
+func (s *readOnlySpan) InstrumentationScope() instrumentation.Scope {
+	return instrumentation.Scope{Name: instrumentationName}
+}
+
+// InstrumentationLibrary implements the deprecated method of
+// sdktrace.ReadOnlySpan.
+func (s *readOnlySpan) InstrumentationLibrary() instrumentation.Library {
+	return s.InstrumentationScope()
+}
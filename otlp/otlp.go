@@ -0,0 +1,286 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlp exports monkit traces to an OpenTelemetry collector using
+// OTLP over HTTP with protobuf encoding. Unlike the otel subpackage, it
+// doesn't depend on the OpenTelemetry SDK.
+package otlp // import "github.com/spacemonkeygo/monkit/v3/otlp"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// instrumentationName is reported as the instrumentation scope of all
+// exported spans.
+const instrumentationName = "github.com/spacemonkeygo/monkit/v3"
+
+// Exporter configures how traces are exported. The zero value of every field
+// but Endpoint picks a reasonable default.
+type Exporter struct {
+	// Endpoint is the URL spans are POSTed to, such as
+	// "http://localhost:4318/v1/traces".
+	Endpoint string
+
+	// ServiceName is reported as the service.name resource attribute. It
+	// defaults to "unknown_service:" followed by the executable's name.
+	ServiceName string
+
+	// Client sends the requests. It defaults to a client with a 10 second
+	// timeout.
+	Client *http.Client
+
+	// BatchSize is the most spans sent in one request. It defaults to 512.
+	BatchSize int
+
+	// FlushInterval is the longest spans wait to be sent in a batch that
+	// isn't full. It defaults to 5 seconds.
+	FlushInterval time.Duration
+
+	// QueueSize is how many finished spans can wait to be sent before new
+	// ones are dropped. It defaults to 8 times BatchSize.
+	QueueSize int
+
+	// MaxRetries is how many times a failed request is retried, with
+	// exponential backoff starting at RetryBackoff, before its spans are
+	// dropped. Only network errors and the status codes the OTLP
+	// specification calls retryable are retried. MaxRetries defaults to 5,
+	// and RetryBackoff to 1 second. Requests are sent, and retried, in the
+	// background, so new batches go out while others back off. At most
+	// QueueSize/BatchSize batches are in flight at once; further batches are
+	// dropped until one of them is done.
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// OnError is called with errors from sending spans, including dropped
+	// batches. It defaults to logging with the standard log package.
+	OnError func(error)
+}
+
+// Observe starts exporting all new traces of r, as they complete, until the
+// returned stop func is called. stop sends the spans collected so far and
+// waits for pending requests to finish, including their retries.
+func (e Exporter) Observe(r *monkit.Registry) (stop func()) {
+	x := newExporter(e)
+	cancel := r.ObserveFinishedTraces(x.export)
+	return func() {
+		cancel()
+		x.close()
+	}
+}
+
+func (e *Exporter) setDefaults() {
+	if e.ServiceName == "" {
+		e.ServiceName = "unknown_service:" + filepath.Base(os.Args[0])
+	}
+	if e.Client == nil {
+		e.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if e.BatchSize <= 0 {
+		e.BatchSize = 512
+	}
+	if e.FlushInterval <= 0 {
+		e.FlushInterval = 5 * time.Second
+	}
+	if e.QueueSize <= 0 {
+		e.QueueSize = 8 * e.BatchSize
+	}
+	if e.MaxRetries <= 0 {
+		e.MaxRetries = 5
+	}
+	if e.RetryBackoff <= 0 {
+		e.RetryBackoff = time.Second
+	}
+	if e.OnError == nil {
+		e.OnError = func(err error) { log.Printf("monkit/otlp: %v", err) }
+	}
+}
+
+type exporter struct {
+	config  Exporter
+	spans   chan []byte
+	sending chan struct{} // holds a token per batch in flight
+	sends   sync.WaitGroup
+	done    chan struct{}
+
+	mtx    sync.Mutex
+	closed bool
+}
+
+func newExporter(config Exporter) *exporter {
+	config.setDefaults()
+	inFlight := config.QueueSize / config.BatchSize
+	if inFlight < 1 {
+		inFlight = 1
+	}
+	x := &exporter{
+		config:  config,
+		spans:   make(chan []byte, config.QueueSize),
+		sending: make(chan struct{}, inFlight),
+		done:    make(chan struct{}),
+	}
+	go x.run()
+	return x
+}
+
+// export queues the spans of a finished trace. Spans are held back until
+// their whole trace completes, so traces are exported together.
+func (x *exporter) export(t *monkit.Trace, spans []*monkit.FinishedSpan) {
+	encoded := make([][]byte, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, encodeSpan(s.Span, s.Finish))
+	}
+
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+	if x.closed {
+		return
+	}
+	x.queue(encoded)
+}
+
+// queue hands spans to the sending goroutine. x.mtx must be held.
+func (x *exporter) queue(spans [][]byte) {
+	dropped := 0
+	for _, span := range spans {
+		select {
+		case x.spans <- span:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		x.config.OnError(fmt.Errorf("queue full, dropped %d spans", dropped))
+	}
+}
+
+func (x *exporter) close() {
+	x.mtx.Lock()
+	if x.closed {
+		x.mtx.Unlock()
+		return
+	}
+	x.closed = true
+	close(x.spans)
+	x.mtx.Unlock()
+	<-x.done
+}
+
+func (x *exporter) run() {
+	defer close(x.done)
+	defer x.sends.Wait()
+	ticker := time.NewTicker(x.config.FlushInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case span, ok := <-x.spans:
+			if !ok {
+				if len(batch) > 0 {
+					// wait for room rather than drop the last batch.
+					x.sending <- struct{}{}
+					x.startSend(batch)
+				}
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) < x.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		x.queueSend(batch)
+		batch = nil
+	}
+}
+
+// queueSend sends batch in the background, unless too many batches are
+// already in flight, in which case it is dropped. It never blocks, so a
+// batch that is backing off doesn't hold up the spans behind it.
+func (x *exporter) queueSend(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+	select {
+	case x.sending <- struct{}{}:
+		x.startSend(batch)
+	default:
+		x.config.OnError(fmt.Errorf("%d batches in flight, dropped %d spans",
+			cap(x.sending), len(batch)))
+	}
+}
+
+// startSend sends batch in a new goroutine. A token must have been put in
+// x.sending for it; it is taken out once the batch is done.
+func (x *exporter) startSend(batch [][]byte) {
+	x.sends.Add(1)
+	go func() {
+		defer x.sends.Done()
+		defer func() { <-x.sending }()
+		x.send(batch)
+	}()
+}
+
+// send posts a batch of spans, retrying with exponential backoff.
+func (x *exporter) send(batch [][]byte) {
+	body := encodeRequest(x.config.ServiceName, batch)
+	backoff := x.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := x.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= x.config.MaxRetries {
+			x.config.OnError(fmt.Errorf("dropped %d spans: %v", len(batch), err))
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (x *exporter) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, x.config.Endpoint,
+		bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := x.config.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		retry = true
+	}
+	return retry, fmt.Errorf("unexpected status: %s", resp.Status)
+}
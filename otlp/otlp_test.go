@@ -0,0 +1,253 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// message is a decoded protobuf message, mapping field numbers to their raw
+// values: the bytes of length-delimited fields, and the little-endian bytes
+// of fixed64 fields and varints.
+type message map[int][][]byte
+
+func decode(t *testing.T, b []byte) message {
+	t.Helper()
+	m := message{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatal("bad tag")
+		}
+		b = b[n:]
+		var val []byte
+		switch tag & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatal("bad varint")
+			}
+			val = make([]byte, 8)
+			binary.LittleEndian.PutUint64(val, v)
+			b = b[n:]
+		case wireFixed64:
+			val, b = b[:8], b[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				t.Fatal("bad length")
+			}
+			val, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		m[int(tag>>3)] = append(m[int(tag>>3)], val)
+	}
+	return m
+}
+
+func (m message) string(field int) string {
+	if len(m[field]) == 0 {
+		return ""
+	}
+	return string(m[field][0])
+}
+
+func TestExporter(t *testing.T) {
+	var mtx sync.Mutex
+	var requests int
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			requests++
+			if requests == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if ct := req.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+				t.Errorf("unexpected content type: %q", ct)
+			}
+			body, _ = ioutil.ReadAll(req.Body)
+		}))
+	defer server.Close()
+
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("test")
+	stop := Exporter{
+		Endpoint:     server.URL,
+		ServiceName:  "svc",
+		RetryBackoff: time.Millisecond,
+	}.Observe(r)
+
+	func() {
+		ctx := context.Background()
+		defer mon.TaskNamed("root")(&ctx)(nil)
+		func(ctx context.Context) (err error) {
+			defer mon.TaskNamed("child")(&ctx)(&err)
+			monkit.SpanFromCtx(ctx).AnnotateValue("bytes", int64(1024))
+			monkit.SpanFromCtx(ctx).AddEvent("sent query")
+			return errors.New("oops")
+		}(ctx)
+	}()
+	stop()
+
+	if requests != 2 {
+		t.Fatalf("expected a retry, got %d requests", requests)
+	}
+	resourceSpans := decode(t, decode(t, body)[1][0])
+	resource := decode(t, resourceSpans[1][0])
+	attr := decode(t, resource[1][0])
+	if attr.string(1) != "service.name" || decode(t, attr[2][0]).string(1) != "svc" {
+		t.Fatalf("unexpected resource attribute")
+	}
+	scopeSpans := decode(t, resourceSpans[2][0])
+	if decode(t, scopeSpans[1][0]).string(1) != instrumentationName {
+		t.Fatalf("unexpected instrumentation scope")
+	}
+	if len(scopeSpans[2]) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(scopeSpans[2]))
+	}
+	child, root := decode(t, scopeSpans[2][0]), decode(t, scopeSpans[2][1])
+	if child.string(spanName) != "test.child" || root.string(spanName) != "test.root" {
+		t.Fatalf("unexpected names: %q, %q", child.string(spanName), root.string(spanName))
+	}
+	if child.string(spanParentSpanId) != root.string(spanSpanId) ||
+		len(root[spanParentSpanId]) != 0 {
+		t.Fatalf("unexpected parents")
+	}
+	if child.string(spanTraceId) != root.string(spanTraceId) ||
+		len(child[spanTraceId][0]) != 16 {
+		t.Fatalf("unexpected trace ids")
+	}
+	if decode(t, child[spanStatus][0]).string(2) != "oops" || len(root[spanStatus]) != 0 {
+		t.Fatalf("unexpected status")
+	}
+	found := false
+	for _, raw := range child[spanAttributes] {
+		kv := decode(t, raw)
+		if kv.string(1) == "bytes" {
+			v := decode(t, kv[2][0])[3][0]
+			found = binary.LittleEndian.Uint64(v) == 1024
+		}
+	}
+	if !found {
+		t.Fatalf("expected the annotation as an integer attribute")
+	}
+	if len(child[spanEvents]) != 1 ||
+		decode(t, child[spanEvents][0]).string(2) != "sent query" {
+		t.Fatalf("unexpected events")
+	}
+}
+
+// runTraces runs n single-span traces on mon.
+func runTraces(mon *monkit.Scope, n int) {
+	for i := 0; i < n; i++ {
+		ctx := context.Background()
+		mon.TaskNamed("root")(&ctx)(nil)
+	}
+}
+
+func TestExporterSendsWhileBlocked(t *testing.T) {
+	first, second := make(chan struct{}), make(chan struct{})
+	var mtx sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			mtx.Lock()
+			requests++
+			n := requests
+			mtx.Unlock()
+			switch n {
+			case 1:
+				close(first)
+				// the second batch must go out while the first is stuck.
+				select {
+				case <-second:
+				case <-time.After(10 * time.Second):
+					t.Error("second batch held up by the first")
+				}
+			case 2:
+				close(second)
+			}
+		}))
+	defer server.Close()
+
+	r := monkit.NewRegistry()
+	stop := Exporter{
+		Endpoint:  server.URL,
+		BatchSize: 1,
+		QueueSize: 2,
+	}.Observe(r)
+	runTraces(r.ScopeNamed("test"), 1)
+	<-first
+	runTraces(r.ScopeNamed("test"), 1)
+	stop()
+
+	if requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestExporterDropsWhenBusy(t *testing.T) {
+	first, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			once.Do(func() {
+				close(first)
+				<-release
+			})
+		}))
+	defer server.Close()
+	var releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	defer unblock()
+
+	errs := make(chan error, 10)
+	r := monkit.NewRegistry()
+	stop := Exporter{
+		Endpoint:  server.URL,
+		BatchSize: 1,
+		QueueSize: 1,
+		OnError:   func(err error) { errs <- err },
+	}.Observe(r)
+	runTraces(r.ScopeNamed("test"), 1)
+	<-first
+	runTraces(r.ScopeNamed("test"), 1)
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "dropped 1 spans") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the batch to be dropped while the first is in flight")
+	}
+	unblock()
+	stop()
+}
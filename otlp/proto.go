@@ -0,0 +1,191 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// This file encodes the few OTLP protobuf messages the exporter needs by
+// hand, so the package doesn't depend on a protobuf library. Field numbers
+// are from opentelemetry/proto/trace/v1/trace.proto and
+// opentelemetry/proto/common/v1/common.proto.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// field numbers of Span
+const (
+	spanTraceId      = 1
+	spanSpanId       = 2
+	spanParentSpanId = 4
+	spanName         = 5
+	spanKind         = 6
+	spanStartTime    = 7
+	spanEndTime      = 8
+	spanAttributes   = 9
+	spanEvents       = 11
+	spanLinks        = 13
+	spanStatus       = 15
+
+	spanKindInternal = 1
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendTag(b []byte, field, wire int) []byte {
+	return appendVarint(b, uint64(field<<3|wire))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	return appendVarint(appendTag(b, field, wireVarint), v)
+}
+
+func appendFixed64Field(b []byte, field int, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(appendTag(b, field, wireFixed64), buf[:]...)
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendVarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendStringField(b []byte, field int, v string) []byte {
+	b = appendVarint(appendTag(b, field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func spanId(id int64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(id))
+	return buf[:]
+}
+
+func unixNano(t time.Time) uint64 { return uint64(t.UnixNano()) }
+
+// appendKeyValue appends a KeyValue message with an AnyValue of the type
+// matching val.
+func appendKeyValue(b []byte, field int, key string, val interface{}) []byte {
+	var value []byte
+	switch val := val.(type) {
+	case string:
+		value = appendStringField(value, 1, val)
+	case bool:
+		v := uint64(0)
+		if val {
+			v = 1
+		}
+		value = appendVarintField(value, 2, v)
+	case int:
+		value = appendVarintField(value, 3, uint64(val))
+	case int32:
+		value = appendVarintField(value, 3, uint64(val))
+	case int64:
+		value = appendVarintField(value, 3, uint64(val))
+	case float32:
+		value = appendFixed64Field(value, 4, math.Float64bits(float64(val)))
+	case float64:
+		value = appendFixed64Field(value, 4, math.Float64bits(val))
+	case []string:
+		var array []byte
+		for _, s := range val {
+			array = appendBytesField(array, 1, appendStringField(nil, 1, s))
+		}
+		value = appendBytesField(value, 5, array)
+	case fmt.Stringer:
+		value = appendStringField(value, 1, val.String())
+	default:
+		value = appendStringField(value, 1, fmt.Sprint(val))
+	}
+	kv := appendStringField(nil, 1, key)
+	kv = appendBytesField(kv, 2, value)
+	return appendBytesField(b, field, kv)
+}
+
+// encodeSpan encodes a finished monkit Span as an OTLP Span message.
+func encodeSpan(s *monkit.Span, finish time.Time) []byte {
+	tid := s.Trace().Id128()
+	b := appendBytesField(nil, spanTraceId, tid[:])
+	b = appendBytesField(b, spanSpanId, spanId(s.Id()))
+	if parentId, ok := s.ParentId(); ok {
+		b = appendBytesField(b, spanParentSpanId, spanId(parentId))
+	}
+	b = appendStringField(b, spanName, s.Func().FullName())
+	b = appendVarintField(b, spanKind, spanKindInternal)
+	b = appendFixed64Field(b, spanStartTime, unixNano(s.WallStart()))
+	b = appendFixed64Field(b, spanEndTime, unixNano(s.WallTime(finish)))
+
+	if args := s.Args(); len(args) > 0 {
+		b = appendKeyValue(b, spanAttributes, "monkit.args", args)
+	}
+	if s.Orphaned() {
+		b = appendKeyValue(b, spanAttributes, "monkit.orphaned", true)
+	}
+	for _, annotation := range s.Annotations() {
+		b = appendKeyValue(b, spanAttributes, annotation.Name,
+			annotation.Interface())
+	}
+	for _, event := range s.Events() {
+		e := appendFixed64Field(nil, 1, unixNano(s.WallTime(event.Time)))
+		e = appendStringField(e, 2, event.Name)
+		b = appendBytesField(b, spanEvents, e)
+	}
+	for _, link := range s.Links() {
+		l := appendBytesField(nil, 1, link.TraceId[:])
+		l = appendBytesField(l, 2, spanId(link.SpanId))
+		b = appendBytesField(b, spanLinks, l)
+	}
+
+	code, message := s.Status()
+	if code == monkit.StatusUnset {
+		return b
+	}
+	// monkit status codes have the same values as OTLP's
+	var status []byte
+	if code == monkit.StatusError {
+		status = appendStringField(status, 2, message)
+	}
+	status = appendVarintField(status, 3, uint64(code))
+	return appendBytesField(b, spanStatus, status)
+}
+
+// encodeRequest encodes an ExportTraceServiceRequest holding the given
+// encoded Spans, all from one resource and instrumentation scope.
+func encodeRequest(serviceName string, spans [][]byte) []byte {
+	resource := appendKeyValue(nil, 1, "service.name", serviceName)
+	scope := appendStringField(nil, 1, instrumentationName)
+
+	scopeSpans := appendBytesField(nil, 1, scope)
+	for _, span := range spans {
+		scopeSpans = appendBytesField(scopeSpans, 2, span)
+	}
+
+	resourceSpans := appendBytesField(nil, 1, resource)
+	resourceSpans = appendBytesField(resourceSpans, 2, scopeSpans)
+	return appendBytesField(nil, 1, resourceSpans)
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package control serves HTTP endpoints that change how a monkit Registry
+// observes the running process, so operators can adjust it without
+// redeploying. All endpoints only accept POST requests, take their arguments
+// as form values, and reply with a JSON object describing the new state:
+//
+//   POST /sampler?rate=0.01       - sample traces at the given rate, using
+//                                   monkit.SampleTraceId. A rate of 1
+//                                   removes the sampler.
+//   POST /recent?capacity=100&seconds=60
+//                                 - keep up to capacity recent traces for the
+//                                   given number of seconds, after which the
+//                                   previous capacity is restored.
+//   POST /reset?scope=name        - reset the stats of the named scope.
+//
+// Every request must first be allowed by the Handler's authorize callback.
+package control // import "github.com/spacemonkeygo/monkit/v3/present/control"
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// Handler is an http.Handler serving the control endpoints for a Registry.
+type Handler struct {
+	registry  *monkit.Registry
+	authorize func(req *http.Request) bool
+
+	mtx       sync.Mutex
+	restore   *time.Timer
+	restoreTo int
+}
+
+// NewHandler returns a Handler that controls r. authorize is called for every
+// request before anything else, and requests it returns false for are
+// rejected with 403 Forbidden. If authorize is nil, all requests are
+// rejected.
+func NewHandler(r *monkit.Registry,
+	authorize func(req *http.Request) bool) *Handler {
+	return &Handler{registry: r, authorize: authorize}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.authorize == nil || !h.authorize(req) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result interface{}
+	var err error
+	switch strings.Trim(req.URL.Path, "/") {
+	case "sampler":
+		result, err = h.setSampler(req)
+	case "recent":
+		result, err = h.captureRecent(req)
+	case "reset":
+		result, err = h.resetScope(req)
+	default:
+		http.Error(w, "not found: expected one of /sampler, /recent, /reset",
+			http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusCode(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) setSampler(req *http.Request) (interface{}, error) {
+	rate, err := strconv.ParseFloat(req.FormValue("rate"), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return nil, badRequest("rate must be a number between 0 and 1")
+	}
+	if rate == 1 {
+		h.registry.SetSampler(nil)
+	} else {
+		h.registry.SetSampler(func(t *monkit.Trace) bool {
+			return monkit.SampleTraceId(t.Id(), rate)
+		})
+	}
+	return map[string]interface{}{"rate": rate}, nil
+}
+
+func (h *Handler) captureRecent(req *http.Request) (interface{}, error) {
+	capacity, err := strconv.Atoi(req.FormValue("capacity"))
+	if err != nil || capacity <= 0 {
+		return nil, badRequest("capacity must be a positive integer")
+	}
+	seconds, err := strconv.ParseFloat(req.FormValue("seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return nil, badRequest("seconds must be a positive number")
+	}
+	duration := time.Duration(seconds * float64(time.Second))
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	// a capture that is already running is extended, and still restores the
+	// capacity from before it started. h.restore is only cleared once the
+	// capacity was restored, so this holds even if its timer already fired
+	// and is waiting for h.mtx.
+	if h.restore != nil {
+		h.restore.Stop()
+	} else {
+		h.restoreTo = h.registry.RecentTraceCapacity()
+	}
+	h.registry.SetRecentTraceCapacity(capacity)
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		h.mtx.Lock()
+		defer h.mtx.Unlock()
+		if h.restore == timer {
+			h.registry.SetRecentTraceCapacity(h.restoreTo)
+			h.restore = nil
+		}
+	})
+	h.restore = timer
+	return map[string]interface{}{
+		"capacity": capacity,
+		"until":    time.Now().Add(duration).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (h *Handler) resetScope(req *http.Request) (interface{}, error) {
+	name := req.FormValue("scope")
+	var found *monkit.Scope
+	h.registry.Scopes(func(s *monkit.Scope) {
+		if s.Name() == name {
+			found = s
+		}
+	})
+	if found == nil {
+		return nil, requestError{code: http.StatusNotFound,
+			msg: "scope not found: " + strconv.Quote(name)}
+	}
+	found.Reset()
+	return map[string]interface{}{"reset": name}, nil
+}
+
+type requestError struct {
+	code int
+	msg  string
+}
+
+func (e requestError) Error() string { return e.msg }
+
+func badRequest(msg string) error {
+	return requestError{code: http.StatusBadRequest, msg: msg}
+}
+
+func statusCode(err error) int {
+	if rerr, ok := err.(requestError); ok {
+		return rerr.code
+	}
+	return http.StatusInternalServerError
+}
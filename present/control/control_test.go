@@ -0,0 +1,119 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func post(t *testing.T, h http.Handler, path string,
+	form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	r := monkit.NewRegistry()
+	h := NewHandler(r, func(req *http.Request) bool {
+		return req.Header.Get("Authorization") == "secret"
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/reset?scope=test", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected unauthorized requests to be rejected, got %d", w.Code)
+	}
+
+	r.ScopeNamed("test").Counter("hits").Inc(3)
+	if w := post(t, h, "/reset", url.Values{"scope": {"test"}}); w.Code != http.StatusOK {
+		t.Fatalf("unexpected reset response: %d %s", w.Code, w.Body)
+	}
+	if v := r.ScopeNamed("test").Counter("hits").Current(); v != 0 {
+		t.Fatalf("expected the scope to be reset, got %d", v)
+	}
+	if w := post(t, h, "/reset", url.Values{"scope": {"missing"}}); w.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown scopes not to be found, got %d", w.Code)
+	}
+
+	if w := post(t, h, "/sampler", url.Values{"rate": {"2"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid rates to be rejected, got %d", w.Code)
+	}
+	if w := post(t, h, "/sampler", url.Values{"rate": {"0"}}); w.Code != http.StatusOK {
+		t.Fatalf("unexpected sampler response: %d %s", w.Code, w.Body)
+	}
+	observed := 0
+	defer r.ObserveTraces(func(*monkit.Trace) { observed++ })()
+	r.ScopeNamed("test").Func().ResetTrace(nil)(nil)
+	if observed != 0 {
+		t.Fatalf("expected no traces to be sampled at rate 0")
+	}
+
+	w = post(t, h, "/recent", url.Values{"capacity": {"10"}, "seconds": {"0.05"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected recent response: %d %s", w.Code, w.Body)
+	}
+	if c := r.RecentTraceCapacity(); c != 10 {
+		t.Fatalf("expected capacity 10, got %d", c)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for r.RecentTraceCapacity() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the capacity to be restored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCaptureRecentAfterRestoreFired(t *testing.T) {
+	r := monkit.NewRegistry()
+	original := r.RecentTraceCapacity()
+	h := NewHandler(r, func(req *http.Request) bool { return true })
+
+	w := post(t, h, "/recent", url.Values{"capacity": {"10"}, "seconds": {"60"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected recent response: %d %s", w.Code, w.Body)
+	}
+	// once stopped, the timer looks to the next capture like it fired and its
+	// restore is waiting for the lock.
+	h.mtx.Lock()
+	h.restore.Stop()
+	h.mtx.Unlock()
+
+	w = post(t, h, "/recent", url.Values{"capacity": {"20"}, "seconds": {"0.01"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected recent response: %d %s", w.Code, w.Body)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for r.RecentTraceCapacity() == 20 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if c := r.RecentTraceCapacity(); c != original {
+		t.Fatalf("expected the capacity from before both captures, %d, got %d",
+			original, c)
+	}
+}
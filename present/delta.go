@@ -0,0 +1,94 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// NewDeltaSource returns a StatSource that reports how much each of the
+// Registry's stats changed since the previous scrape, which is handy for
+// pushing to systems that want rates precomputed. Every stat is emitted with
+// ".delta" appended to its field name. When a value went down, as happens
+// when a counter is reset, the new value itself is emitted instead of a
+// negative delta. Stats seen for the first time have no previous value and
+// are left out, as are NaN values.
+//
+// The Registry is scraped at most once per interval; scrapes within the
+// interval report the deltas of the last scrape again, so several consumers
+// can share one delta source. An interval of 0 scrapes on every call.
+func NewDeltaSource(r *monkit.Registry, interval time.Duration) monkit.StatSource {
+	return &deltaSource{r: r, interval: interval}
+}
+
+type deltaSource struct {
+	r        *monkit.Registry
+	interval time.Duration
+
+	mtx      sync.Mutex
+	scraped  time.Time
+	previous map[string]float64
+	deltas   []delta
+}
+
+type delta struct {
+	key   monkit.SeriesKey
+	field string
+	val   float64
+}
+
+// Stats implements monkit.StatSource.
+func (d *deltaSource) Stats(cb func(key monkit.SeriesKey, field string, val float64)) {
+	d.mtx.Lock()
+	now := time.Now()
+	if d.previous == nil || now.Sub(d.scraped) >= d.interval {
+		d.scrape()
+		d.scraped = now
+	}
+	deltas := d.deltas
+	d.mtx.Unlock()
+
+	for _, delta := range deltas {
+		cb(delta.key, delta.field, delta.val)
+	}
+}
+
+// scrape walks the Registry and recomputes the deltas. d.mtx must be held.
+func (d *deltaSource) scrape() {
+	current := make(map[string]float64, len(d.previous))
+	var deltas []delta
+	d.r.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		if math.IsNaN(val) {
+			return
+		}
+		name := key.WithField(field)
+		current[name] = val
+		prev, ok := d.previous[name]
+		if !ok {
+			return
+		}
+		change := val - prev
+		if change < 0 {
+			change = val
+		}
+		deltas = append(deltas, delta{key: key, field: field + ".delta", val: change})
+	})
+	d.previous = current
+	d.deltas = deltas
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// collectDeltas returns the stats source reports, by full name.
+func collectDeltas(source monkit.StatSource) map[string]float64 {
+	stats := map[string]float64{}
+	source.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		stats[key.WithField(field)] = val
+	})
+	return stats
+}
+
+func TestDeltaSource(t *testing.T) {
+	vals := map[string]float64{"requests": 10, "latency": math.NaN()}
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			for name, val := range vals {
+				cb(monkit.NewSeriesKey(name), "value", val)
+			}
+		}))
+	source := NewDeltaSource(r, 0)
+
+	if stats := collectDeltas(source); len(stats) != 0 {
+		t.Fatalf("expected no deltas on the first scrape, got %v", stats)
+	}
+
+	vals["requests"] = 15
+	vals["latency"] = 2
+	stats := collectDeltas(source)
+	if len(stats) != 1 || stats["requests,scope=test value.delta"] != 5 {
+		t.Fatalf("expected only the requests delta, got %v", stats)
+	}
+
+	vals["requests"] = 20
+	vals["latency"] = 3
+	stats = collectDeltas(source)
+	if stats["requests,scope=test value.delta"] != 5 ||
+		stats["latency,scope=test value.delta"] != 1 {
+		t.Fatalf("unexpected deltas: %v", stats)
+	}
+}
+
+func TestDeltaSourceReset(t *testing.T) {
+	requests := 100.0
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			cb(monkit.NewSeriesKey("requests"), "value", requests)
+		}))
+	source := NewDeltaSource(r, 0)
+	collectDeltas(source)
+
+	// a counter reset reports the new value rather than a negative delta
+	requests = 3
+	stats := collectDeltas(source)
+	if delta := stats["requests,scope=test value.delta"]; delta != 3 {
+		t.Fatalf("expected the reset value 3, got %v", delta)
+	}
+
+	// and deltas are taken from the reset value afterwards
+	requests = 10
+	stats = collectDeltas(source)
+	if delta := stats["requests,scope=test value.delta"]; delta != 7 {
+		t.Fatalf("expected a delta of 7 after the reset, got %v", delta)
+	}
+
+	// a reset to zero reports zero
+	requests = 0
+	stats = collectDeltas(source)
+	if delta, ok := stats["requests,scope=test value.delta"]; !ok || delta != 0 {
+		t.Fatalf("expected a delta of 0 after resetting to 0, got %v", stats)
+	}
+}
+
+func TestDeltaSourceInterval(t *testing.T) {
+	requests := 1.0
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			cb(monkit.NewSeriesKey("requests"), "value", requests)
+		}))
+	source := NewDeltaSource(r, time.Hour)
+	collectDeltas(source)
+
+	// within the interval, the last scrape is reported again
+	requests = 5
+	if stats := collectDeltas(source); len(stats) != 0 {
+		t.Fatalf("expected the first scrape's deltas again, got %v", stats)
+	}
+}
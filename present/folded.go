@@ -0,0 +1,144 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+	"github.com/spacemonkeygo/monkit/v3/collect"
+)
+
+// FoldedStacks writes the finished spans of t to w in the folded stack format
+// used by flame graph tools such as Brendan Gregg's flamegraph.pl. Every line
+// is a stack of semicolon separated full func names, from the trace's root
+// span down, followed by the self time spent in the last func of the stack in
+// microseconds. Self time is a span's duration minus the time covered by its
+// children, so concurrent children are only subtracted once. Identical stacks
+// are summed.
+//
+// Spans are only recorded on a Trace while its Registry is keeping recent
+// traces, see Registry.SetRecentTraceCapacity and Trace.FinishedSpans. To
+// collect folded stacks for every trace as it completes, use
+// NewFoldedStacksWriter instead.
+func FoldedStacks(t *monkit.Trace, w io.Writer) error {
+	var spans []*collect.FinishedSpan
+	t.FinishedSpans(func(s *monkit.Span) {
+		finish, _ := s.FinishTime()
+		err, panicked := s.Outcome()
+		spans = append(spans, &collect.FinishedSpan{
+			Span: s, Err: err, Panicked: panicked, Finish: finish})
+	})
+	_, err := w.Write(formatFoldedStacks(spans))
+	return err
+}
+
+// NewFoldedStacksWriter returns a func suitable for Registry.ObserveTraces
+// that writes the folded stacks of every trace, once all of its spans have
+// finished, to w. Writing the stacks of many traces to the same file
+// accumulates them for a single flame graph. See FoldedStacks and
+// NewTraceWriterWithOptions.
+func NewFoldedStacksWriter(w io.Writer, opts TraceWriterOptions) func(
+	*monkit.Trace) {
+	tw := &traceWriter{w: w, opts: opts, format: func(t *monkit.Trace,
+		spans []*collect.FinishedSpan) ([]byte, error) {
+		return formatFoldedStacks(spans), nil
+	}}
+	return tw.observe
+}
+
+type foldedSpan struct {
+	span     *collect.FinishedSpan
+	children []*foldedSpan
+}
+
+func formatFoldedStacks(spans []*collect.FinishedSpan) []byte {
+	collect.StartTimeSorter(spans).Sort()
+
+	nodes := make(map[int64]*foldedSpan, len(spans))
+	for _, s := range spans {
+		nodes[s.Span.Id()] = &foldedSpan{span: s}
+	}
+	var roots []*foldedSpan
+	for _, s := range spans {
+		node := nodes[s.Span.Id()]
+		if parentId, ok := s.Span.ParentId(); ok && nodes[parentId] != nil {
+			parent := nodes[parentId]
+			parent.children = append(parent.children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	selfTimes := map[string]time.Duration{}
+	var walk func(node *foldedSpan, stack string)
+	walk = func(node *foldedSpan, stack string) {
+		name := strings.Replace(node.span.Span.Func().FullName(), ";", ":", -1)
+		if stack != "" {
+			name = stack + ";" + name
+		}
+		selfTimes[name] += node.selfTime()
+		for _, child := range node.children {
+			walk(child, name)
+		}
+	}
+	for _, root := range roots {
+		walk(root, "")
+	}
+
+	stacks := make([]string, 0, len(selfTimes))
+	for stack := range selfTimes {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	var buf bytes.Buffer
+	for _, stack := range stacks {
+		micros := selfTimes[stack].Microseconds()
+		if micros <= 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %d\n", stack, micros)
+	}
+	return buf.Bytes()
+}
+
+// selfTime returns the span's duration minus the union of its children's
+// durations, clipped to the span. Children are sorted by start time.
+func (node *foldedSpan) selfTime() time.Duration {
+	start, finish := node.span.Span.Start(), node.span.Finish
+	self := finish.Sub(start)
+	covered := start
+	for _, child := range node.children {
+		childStart, childFinish := child.span.Span.Start(), child.span.Finish
+		if childStart.Before(covered) {
+			childStart = covered
+		}
+		if childFinish.After(finish) {
+			childFinish = finish
+		}
+		if !childFinish.After(childStart) {
+			continue
+		}
+		self -= childFinish.Sub(childStart)
+		covered = childFinish
+	}
+	return self
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestFoldedStacks(t *testing.T) {
+	r := monkit.NewRegistry()
+	r.SetRecentTraceCapacity(1)
+	mon := r.ScopeNamed("test")
+
+	now := time.Unix(1000, 0)
+	r.SetClock(func() time.Time { return now })
+	start := now
+	at := func(ms int) {
+		now = start.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	var buf bytes.Buffer
+	defer r.ObserveTraces(NewFoldedStacksWriter(&buf, TraceWriterOptions{}))()
+
+	// root runs from 0 to 100ms. child a runs from 10 to 40ms with leaf from
+	// 20 to 30ms, and child b runs concurrently with a from 30 to 60ms.
+	ctx := context.Background()
+	finishRoot := mon.TaskNamed("root")(&ctx)
+	trace := monkit.SpanFromCtx(ctx).Trace()
+	at(10)
+	ctxA := ctx
+	finishA := mon.TaskNamed("a")(&ctxA)
+	at(20)
+	ctxLeaf := ctxA
+	finishLeaf := mon.TaskNamed("leaf")(&ctxLeaf)
+	at(30)
+	finishLeaf(nil)
+	ctxB := ctx
+	finishB := mon.TaskNamed("b")(&ctxB)
+	at(40)
+	finishA(nil)
+	at(60)
+	finishB(nil)
+	at(100)
+	finishRoot(nil)
+
+	// the root's self time only subtracts the overlap of a and b once.
+	expected := "test.root 50000\n" +
+		"test.root;test.a 20000\n" +
+		"test.root;test.a;test.leaf 10000\n" +
+		"test.root;test.b 30000\n"
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	var direct bytes.Buffer
+	if err := FoldedStacks(trace, &direct); err != nil {
+		t.Fatal(err)
+	}
+	if direct.String() != expected {
+		t.Fatalf("expected FoldedStacks to match the writer, got:\n%s",
+			direct.String())
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphite pushes monkit statistics to Graphite (Carbon) using its
+// plaintext protocol.
+//
+// Every measurement and field pair becomes a metric path of the form
+// prefix.measurement.field, and series tags become Graphite tags, as in
+//
+//   myapp.function.successes;name=MyFunc;scope=main 42 1700000000
+//
+// Characters Graphite doesn't allow in paths or tags are replaced with
+// underscores. NaN and infinite values are skipped.
+package graphite // import "github.com/spacemonkeygo/monkit/v3/present/graphite"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// dialTimeout bounds how long connecting to Carbon may take.
+const dialTimeout = 10 * time.Second
+
+// Pusher pushes monkit statistics to a Carbon server over TCP. It keeps its
+// connection open between pushes and reconnects when the connection fails.
+// A Pusher is safe for concurrent use.
+type Pusher struct {
+	addr   string
+	prefix string
+
+	mtx  sync.Mutex
+	conn net.Conn
+}
+
+// NewPusher returns a Pusher that sends to the Carbon server at addr, such as
+// "localhost:2003". If prefix is not empty, it is prepended to every metric
+// path, separated by a dot.
+func NewPusher(addr, prefix string) *Pusher {
+	return &Pusher{addr: addr, prefix: strings.TrimSuffix(prefix, ".")}
+}
+
+// Push writes every stat of the Registry to Carbon, timestamped with the
+// current time. If writing to an existing connection fails, Push reconnects
+// and tries once more.
+func (p *Pusher) Push(r *monkit.Registry) error {
+	data := p.format(r, time.Now())
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.conn != nil {
+		if _, err := p.conn.Write(data); err == nil {
+			return nil
+		}
+		p.closeConn()
+	}
+	conn, err := net.DialTimeout("tcp", p.addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	p.conn = conn
+	if _, err := p.conn.Write(data); err != nil {
+		p.closeConn()
+		return err
+	}
+	return nil
+}
+
+// Run pushes the Registry's stats every interval until ctx is canceled, and
+// then closes the Pusher. Failed pushes are retried at the next interval;
+// onError, if not nil, is called with their errors.
+func (p *Pusher) Run(ctx context.Context, r *monkit.Registry,
+	interval time.Duration, onError func(error)) error {
+	defer p.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := p.Push(r); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Close closes the Pusher's connection, if any. The Pusher can still be
+// used afterwards, it will reconnect.
+func (p *Pusher) Close() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.closeConn()
+}
+
+// closeConn closes the connection. p.mtx must be held.
+func (p *Pusher) closeConn() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// Push opens a connection to the Carbon server at addr, writes every stat
+// of the Registry, and closes the connection. See Pusher for pushing
+// repeatedly or with a prefix.
+func Push(r *monkit.Registry, addr string) error {
+	p := NewPusher(addr, "")
+	defer p.Close()
+	return p.Push(r)
+}
+
+// Run pushes the Registry's stats to the Carbon server at addr every interval
+// until ctx is canceled, reconnecting as needed. Push errors are ignored; use
+// a Pusher to observe them.
+func Run(ctx context.Context, r *monkit.Registry, addr string,
+	interval time.Duration) error {
+	return NewPusher(addr, "").Run(ctx, r, interval, nil)
+}
+
+func (p *Pusher) format(r *monkit.Registry, now time.Time) []byte {
+	var buf bytes.Buffer
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	r.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return
+		}
+		buf.WriteString(p.path(key, field))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(val, 'f', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		buf.WriteByte('\n')
+	})
+	return buf.Bytes()
+}
+
+// path returns the Graphite metric path for the series and field, including
+// its tags.
+func (p *Pusher) path(key monkit.SeriesKey, field string) string {
+	var b strings.Builder
+	if p.prefix != "" {
+		b.WriteString(sanitize(p.prefix, true))
+		b.WriteByte('.')
+	}
+	b.WriteString(sanitize(key.Measurement, true))
+	b.WriteByte('.')
+	b.WriteString(sanitize(field, true))
+
+	tags := key.Tags.All()
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := sanitize(tags[name], true)
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ";%s=%s", sanitize(name, false), value)
+	}
+	return b.String()
+}
+
+// sanitize replaces every character that isn't safe in a Graphite path
+// component or tag with an underscore. Dots are kept if allowDots is true.
+func sanitize(s string, allowDots bool) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '_', r == '-':
+			return r
+		case r == '.' && allowDots:
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestPush(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	lines := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	r := monkit.NewRegistry()
+	r.ScopeNamed("my/pkg").Counter("beans").Inc(3)
+
+	p := NewPusher(l.Addr().String(), "app.")
+	defer p.Close()
+	for i := 0; i < 2; i++ {
+		if err := p.Push(r); err != nil {
+			t.Fatal(err)
+		}
+		// drop the connection after the first push to force a reconnect.
+		if i == 0 {
+			p.mtx.Lock()
+			p.conn.Close()
+			p.mtx.Unlock()
+		}
+	}
+
+	seen := 0
+	for seen < 2 {
+		line := <-lines
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			t.Fatalf("unexpected line %q", line)
+		}
+		if fields[0] == "app.beans.value;scope=my_pkg" {
+			if fields[1] != "3" {
+				t.Fatalf("unexpected value in %q", line)
+			}
+			seen++
+		}
+	}
+}
@@ -16,6 +16,8 @@ package present
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/spacemonkeygo/monkit/v3"
 )
@@ -27,12 +29,19 @@ type handler struct {
 // HTTP makes an http.Handler out of a Registry. It serves paths using this
 // package's FromRequest request router. Usually HTTP is called with the
 // Default registry.
+//
+// Paths that don't name a format, such as /stats or /funcs, are served in the
+// format the request's Accept header prefers: JSON for application/json, CSV
+// for text/csv, dot for text/vnd.graphviz, SVG for image/svg+xml, and text
+// otherwise. /trace defaults to JSON. Paths that do name a format ignore the
+// Accept header.
 func HTTP(r *monkit.Registry) http.Handler {
 	return handler{Registry: r}
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	p, contentType, err := FromRequest(h.Registry, req.URL.Path, req.URL.Query())
+	path := negotiate(req.URL.Path, req.Header.Get("Accept"))
+	p, contentType, err := FromRequest(h.Registry, path, req.URL.Query())
 	if err != nil {
 		http.Error(w, err.Error(), getStatusCode(err, 500))
 		return
@@ -40,3 +49,67 @@ func (h handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", contentType)
 	p(w)
 }
+
+// formats maps the media types understood by negotiate to FromRequest path
+// suffixes.
+var formats = map[string]string{
+	"application/json":  "json",
+	"text/plain":        "text",
+	"text/csv":          "csv",
+	"text/vnd.graphviz": "dot",
+	"image/svg+xml":     "svg",
+}
+
+// negotiate appends the format preferred by accept to paths that don't name
+// one already.
+func negotiate(path, accept string) string {
+	first, rest := shift(path)
+	if second, _ := shift(rest); second != "" {
+		return path
+	}
+	var supported map[string]bool
+	switch first {
+	case "ps", "spans", "funcs":
+		supported = map[string]bool{"json": true, "text": true, "dot": true}
+	case "stats":
+		supported = map[string]bool{"json": true, "text": true, "csv": true}
+	case "trace":
+		supported = map[string]bool{"json": true, "svg": true}
+	default:
+		return path
+	}
+	format := preferredFormat(accept, supported)
+	if format == "" {
+		if first != "trace" {
+			return path
+		}
+		format = "json"
+	}
+	return "/" + first + "/" + format
+}
+
+// preferredFormat returns the supported format with the highest quality in
+// the given Accept header value, or the empty string if there is none.
+func preferredFormat(accept string, supported map[string]bool) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		format, ok := formats[strings.ToLower(strings.TrimSpace(params[0]))]
+		if !ok || !supported[format] {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestHTTPAcceptNegotiation(t *testing.T) {
+	r := monkit.NewRegistry()
+	r.ScopeNamed("test").Counter("requests").Inc(1)
+	server := httptest.NewServer(HTTP(r))
+	defer server.Close()
+
+	for _, test := range []struct {
+		path, accept string
+		contentType  string
+		bodyPrefix   string
+	}{
+		// each supported media type
+		{"/stats", "application/json", "application/json", "["},
+		{"/stats", "text/csv", "text/csv", "name,value\n"},
+		{"/stats", "text/plain", "text/plain", "requests,scope=test "},
+		{"/funcs", "text/vnd.graphviz", "text/plain", "digraph G {"},
+		{"/funcs", "application/json", "application/json", "["},
+		{"/ps", "text/vnd.graphviz", "text/plain", "digraph G {"},
+		{"/ps", "application/json", "application/json", "["},
+
+		// quality values and parameters
+		{"/stats", "text/plain;q=0.5, application/json;q=0.9",
+			"application/json", "["},
+		{"/stats", "text/csv; charset=utf-8", "text/csv", "name,value\n"},
+		{"/stats", "TEXT/CSV", "text/csv", "name,value\n"},
+
+		// unsupported or missing preferences fall back to text
+		{"/stats", "", "text/plain", "requests,scope=test "},
+		{"/stats", "*/*", "text/plain", "requests,scope=test "},
+		{"/stats", "text/vnd.graphviz", "text/plain", "requests,scope=test "},
+		{"/funcs", "text/csv", "text/plain", ""},
+
+		// paths naming a format ignore Accept
+		{"/stats/csv", "application/json", "text/csv", "name,value\n"},
+		{"/stats/json", "text/csv", "application/json", "["},
+	} {
+		req, err := http.NewRequest("GET", server.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s with %q: unexpected status %d", test.path, test.accept,
+				resp.StatusCode)
+		}
+		contentType := resp.Header.Get("Content-Type")
+		if !strings.HasPrefix(contentType, test.contentType) {
+			t.Fatalf("%s with %q: expected %s, got %s", test.path, test.accept,
+				test.contentType, contentType)
+		}
+		if !strings.HasPrefix(string(body), test.bodyPrefix) {
+			t.Fatalf("%s with %q: expected body starting with %q, got %q",
+				test.path, test.accept, test.bodyPrefix, body)
+		}
+	}
+}
+
+func TestNegotiateTrace(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"":                              "/trace/json",
+		"text/plain":                    "/trace/json",
+		"image/svg+xml":                 "/trace/svg",
+		"image/svg+xml;q=0.1, text/csv": "/trace/svg",
+	} {
+		if path := negotiate("/trace", accept); path != expected {
+			t.Fatalf("with %q: expected %s, got %s", accept, expected, path)
+		}
+	}
+	if path := negotiate("/trace/remote", "image/svg+xml"); path != "/trace/remote" {
+		t.Fatalf("expected paths naming a format to be kept, got %s", path)
+	}
+}
+
+func TestHTTPNotFound(t *testing.T) {
+	server := httptest.NewServer(HTTP(monkit.NewRegistry()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "path not found: /nope") {
+		t.Fatalf("expected the path in the body, got %q", body)
+	}
+	for _, endpoint := range endpoints {
+		if !strings.Contains(string(body), endpoint) {
+			t.Fatalf("expected %s to be listed, got %q", endpoint, body)
+		}
+	}
+}
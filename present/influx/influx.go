@@ -0,0 +1,202 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package influx writes monkit statistics in the InfluxDB line protocol and
+// pushes them to InfluxDB over HTTP.
+//
+// Every series becomes one line, with the series measurement as the
+// measurement, its tags as tags, and all of its fields, including the
+// reservoir percentiles of distributions such as r50 and r99, as float
+// fields, as in
+//
+//	function,name=MyFunc,scope=main successes=42,errors=1 1700000000000000000
+//
+// Commas, spaces, equal signs and backslashes in measurements, tag keys, tag
+// values and field keys are escaped as the line protocol specification
+// requires. Newlines can't be escaped and are replaced with spaces. Tags with
+// an empty key or value and NaN and infinite values are skipped. Timestamps
+// are in nanoseconds.
+package influx // import "github.com/spacemonkeygo/monkit/v3/present/influx"
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+var (
+	// measurementEscaper escapes measurements, which can't hold unescaped
+	// commas or spaces.
+	measurementEscaper = strings.NewReplacer(
+		`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+
+	// keyEscaper escapes tag keys, tag values and field keys, which can't
+	// hold unescaped commas, equal signs or spaces.
+	keyEscaper = strings.NewReplacer(
+		`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+)
+
+// line is a series and its fields, formatted so far.
+type line struct {
+	series []byte
+	fields []byte
+}
+
+// WriteLines writes every stat of the Registry to w in the line protocol,
+// timestamped with now.
+func WriteLines(r *monkit.Registry, w io.Writer, now time.Time) error {
+	var lines []*line
+	bySeries := map[string]*line{}
+	r.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		if key.Measurement == "" || field == "" ||
+			math.IsNaN(val) || math.IsInf(val, 0) {
+			return
+		}
+		series := formatSeries(key)
+		l, ok := bySeries[series]
+		if !ok {
+			l = &line{series: []byte(series)}
+			bySeries[series] = l
+			lines = append(lines, l)
+		}
+		if len(l.fields) > 0 {
+			l.fields = append(l.fields, ',')
+		}
+		l.fields = append(l.fields, keyEscaper.Replace(field)...)
+		l.fields = append(l.fields, '=')
+		l.fields = strconv.AppendFloat(l.fields, val, 'g', -1, 64)
+	})
+
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+	bw := bufio.NewWriter(w)
+	for _, l := range lines {
+		_, _ = bw.Write(l.series)
+		_ = bw.WriteByte(' ')
+		_, _ = bw.Write(l.fields)
+		_ = bw.WriteByte(' ')
+		_, _ = bw.WriteString(timestamp)
+		_ = bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// formatSeries returns the escaped measurement and tags of key, with the tags
+// sorted by key as InfluxDB recommends.
+func formatSeries(key monkit.SeriesKey) string {
+	tags := key.Tags.All()
+	names := make([]string, 0, len(tags))
+	for name, val := range tags {
+		if name != "" && val != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(key.Measurement))
+	for _, name := range names {
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(name))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(tags[name]))
+	}
+	return b.String()
+}
+
+// Options configures a Pusher.
+type Options struct {
+	// Token, if not empty, is sent in the Authorization header as an
+	// InfluxDB API token.
+	Token string
+
+	// Client sends the requests. It defaults to a client with a 10 second
+	// timeout.
+	Client *http.Client
+}
+
+// Pusher pushes monkit statistics to InfluxDB over HTTP. A Pusher is safe for
+// concurrent use.
+type Pusher struct {
+	url  string
+	opts Options
+}
+
+// NewPusher returns a Pusher that POSTs to the given InfluxDB write URL, such
+// as "http://localhost:8086/api/v2/write?org=myorg&bucket=mybucket" for
+// InfluxDB 2 or "http://localhost:8086/write?db=mydb" for InfluxDB 1. The URL
+// must not set a precision other than the default of nanoseconds.
+func NewPusher(url string, opts Options) *Pusher {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Pusher{url: url, opts: opts}
+}
+
+// Push writes every stat of the Registry to InfluxDB, timestamped with the
+// current time.
+func (p *Pusher) Push(r *monkit.Registry) error {
+	var body bytes.Buffer
+	if err := WriteLines(r, &body, time.Now()); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if p.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+p.opts.Token)
+	}
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %s: %s", resp.Status,
+			bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Run pushes the Registry's stats every interval until ctx is canceled.
+// Failed pushes are retried at the next interval; onError, if not nil, is
+// called with their errors.
+func (p *Pusher) Run(ctx context.Context, r *monkit.Registry,
+	interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := p.Push(r); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
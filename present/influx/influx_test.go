@@ -0,0 +1,98 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestWriteLines(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("my pkg")
+	mon.Counter("a,b c", monkit.NewSeriesTag("k=1", `v\ v`),
+		monkit.NewSeriesTag("empty", "")).Inc(3)
+	mon.FloatVal("size").Observe(1.5)
+
+	var buf bytes.Buffer
+	if err := WriteLines(r, &buf, time.Unix(0, 42)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per series, got %q", lines)
+	}
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, `a\,b\ c,`):
+			expected := `a\,b\ c,k\=1=v\\\ v,scope=my\ pkg high=3,low=3,value=3 42`
+			if line != expected {
+				t.Fatalf("expected %q, got %q", expected, line)
+			}
+		case strings.HasPrefix(line, `size,scope=my\ pkg `):
+			for _, field := range []string{"count=1", "r50=1.5", "sum=1.5"} {
+				if !strings.Contains(line, field) {
+					t.Fatalf("expected %s in %q", field, line)
+				}
+			}
+			if !strings.HasSuffix(line, " 42") {
+				t.Fatalf("unexpected timestamp in %q", line)
+			}
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	var body []byte
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			body, _ = ioutil.ReadAll(req.Body)
+			auth = req.Header.Get("Authorization")
+			if req.URL.Query().Get("bucket") != "b" {
+				http.Error(w, "bucket not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	defer srv.Close()
+
+	r := monkit.NewRegistry()
+	r.ScopeNamed("test").Counter("beans").Inc(3)
+
+	p := NewPusher(srv.URL+"/api/v2/write?org=o&bucket=b", Options{Token: "t"})
+	if err := p.Push(r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(body), "beans,scope=test ") ||
+		!strings.Contains(string(body), "value=3") || auth != "Token t" {
+		t.Fatalf("unexpected request: %q %q", body, auth)
+	}
+
+	p = NewPusher(srv.URL+"/api/v2/write?org=o&bucket=x", Options{})
+	if err := p.Push(r); err == nil ||
+		!strings.Contains(err.Error(), "bucket not found") {
+		t.Fatalf("expected the server's error, got %v", err)
+	}
+}
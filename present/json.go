@@ -35,10 +35,15 @@ func formatSpan(s *monkit.Span) interface{} {
 		Trace struct {
 			Id int64 `json:"id"`
 		} `json:"trace"`
-		Start       int64      `json:"start"`
-		Orphaned    bool       `json:"orphaned"`
-		Args        []string   `json:"args"`
-		Annotations [][]string `json:"annotations"`
+		Start       int64           `json:"start"`
+		Orphaned    bool            `json:"orphaned"`
+		Level       string          `json:"level"`
+		Status      string          `json:"status,omitempty"`
+		StatusMsg   string          `json:"status_message,omitempty"`
+		Args        []string        `json:"args"`
+		Annotations [][]interface{} `json:"annotations"`
+		Links       []spanLink      `json:"links,omitempty"`
+		Events      []spanEvent     `json:"events,omitempty"`
 	}{}
 	js.Id = s.Id()
 	if parent_id, ok := s.ParentId(); ok {
@@ -47,17 +52,130 @@ func formatSpan(s *monkit.Span) interface{} {
 	js.Func.Package = s.Func().Scope().Name()
 	js.Func.Name = s.Func().ShortName()
 	js.Trace.Id = s.Trace().Id()
-	js.Start = s.Start().UnixNano()
+	js.Start = s.WallStart().UnixNano()
 	js.Orphaned = s.Orphaned()
+	js.Level = s.Level().String()
+	js.Status, js.StatusMsg = formatStatus(s)
 	js.Args = make([]string, 0, len(s.Args()))
 	for _, arg := range s.Args() {
 		js.Args = append(js.Args, fmt.Sprintf("%#v", arg))
 	}
-	js.Annotations = make([][]string, 0, len(s.Annotations()))
-	for _, annotation := range s.Annotations() {
-		js.Annotations = append(js.Annotations,
-			[]string{annotation.Name, annotation.Value})
+	js.Annotations = formatAnnotations(s.Annotations())
+	js.Links = formatLinks(s.Links())
+	js.Events = formatEvents(s)
+	return js
+}
+
+// spanLink holds the low 64 bits of the linked trace id in TraceId, like
+// the trace_id of a trace, and the high 64 bits, if any, in TraceIdHigh.
+type spanLink struct {
+	TraceId     int64 `json:"trace_id"`
+	TraceIdHigh int64 `json:"trace_id_high,omitempty"`
+	SpanId      int64 `json:"span_id"`
+}
+
+func formatLinks(links []monkit.Link) []spanLink {
+	if len(links) == 0 {
+		return nil
+	}
+	rv := make([]spanLink, 0, len(links))
+	for _, link := range links {
+		rv = append(rv, spanLink{TraceId: link.TraceId.Low(),
+			TraceIdHigh: link.TraceId.High(), SpanId: link.SpanId})
+	}
+	return rv
+}
+
+type spanEvent struct {
+	Name string `json:"name"`
+	Time int64  `json:"time"`
+}
+
+// formatEvents formats the Span's Events with wall-clock times. See
+// monkit.Span.WallTime.
+func formatEvents(s *monkit.Span) []spanEvent {
+	events := s.Events()
+	if len(events) == 0 {
+		return nil
+	}
+	rv := make([]spanEvent, 0, len(events))
+	for _, event := range events {
+		rv = append(rv, spanEvent{Name: event.Name,
+			Time: s.WallTime(event.Time).UnixNano()})
 	}
+	return rv
+}
+
+type spanTree struct {
+	Id       int64  `json:"id"`
+	ParentId *int64 `json:"parent_id,omitempty"`
+	Func     struct {
+		Package string `json:"package"`
+		Name    string `json:"name"`
+	} `json:"func"`
+	Trace struct {
+		Id int64 `json:"id"`
+	} `json:"trace"`
+	Start       int64           `json:"start"`
+	Elapsed     int64           `json:"elapsed"`
+	Orphaned    bool            `json:"orphaned"`
+	Level       string          `json:"level"`
+	Status      string          `json:"status,omitempty"`
+	StatusMsg   string          `json:"status_message,omitempty"`
+	Args        []string        `json:"args"`
+	Annotations [][]interface{} `json:"annotations"`
+	Links       []spanLink      `json:"links,omitempty"`
+	Events      []spanEvent     `json:"events,omitempty"`
+	Children    []*spanTree     `json:"children"`
+	Dropped     int64           `json:"dropped_children,omitempty"`
+}
+
+// formatSpanTree formats s and all of its descendants. Like the Registry's
+// span walks, it uses an explicit stack rather than recursion, so deep traces
+// can't exhaust the goroutine stack.
+func formatSpanTree(s *monkit.Span) *spanTree {
+	type pending struct {
+		span *monkit.Span
+		tree *spanTree
+	}
+	root := formatSpanNode(s)
+	stack := []pending{{span: s, tree: root}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		p.span.Children(func(child *monkit.Span) {
+			tree := formatSpanNode(child)
+			p.tree.Children = append(p.tree.Children, tree)
+			stack = append(stack, pending{span: child, tree: tree})
+		})
+	}
+	return root
+}
+
+// formatSpanNode formats s without its children.
+func formatSpanNode(s *monkit.Span) *spanTree {
+	js := &spanTree{}
+	js.Id = s.Id()
+	if parent_id, ok := s.ParentId(); ok {
+		js.ParentId = &parent_id
+	}
+	js.Func.Package = s.Func().Scope().Name()
+	js.Func.Name = s.Func().ShortName()
+	js.Trace.Id = s.Trace().Id()
+	js.Start = s.WallStart().UnixNano()
+	js.Elapsed = s.Duration().Nanoseconds()
+	js.Orphaned = s.Orphaned()
+	js.Level = s.Level().String()
+	js.Status, js.StatusMsg = formatStatus(s)
+	js.Args = make([]string, 0, len(s.Args()))
+	for _, arg := range s.Args() {
+		js.Args = append(js.Args, fmt.Sprintf("%#v", arg))
+	}
+	js.Annotations = formatAnnotations(s.Annotations())
+	js.Links = formatLinks(s.Links())
+	js.Events = formatEvents(s)
+	js.Children = []*spanTree{}
+	js.Dropped = s.DroppedChildren()
 	return js
 }
 
@@ -72,13 +190,15 @@ func formatFinishedSpan(s *collect.FinishedSpan) interface{} {
 		Trace struct {
 			Id int64 `json:"id"`
 		} `json:"trace"`
-		Start       int64      `json:"start"`
-		Finish      int64      `json:"finish"`
-		Orphaned    bool       `json:"orphaned"`
-		Err         string     `json:"err"`
-		Panicked    bool       `json:"panicked"`
-		Args        []string   `json:"args"`
-		Annotations [][]string `json:"annotations"`
+		Start       int64           `json:"start"`
+		Finish      int64           `json:"finish"`
+		Orphaned    bool            `json:"orphaned"`
+		Err         string          `json:"err"`
+		Panicked    bool            `json:"panicked"`
+		Status      string          `json:"status,omitempty"`
+		StatusMsg   string          `json:"status_message,omitempty"`
+		Args        []string        `json:"args"`
+		Annotations [][]interface{} `json:"annotations"`
 	}{}
 	js.Id = s.Span.Id()
 	if parent_id, ok := s.Span.ParentId(); ok {
@@ -87,26 +207,50 @@ func formatFinishedSpan(s *collect.FinishedSpan) interface{} {
 	js.Func.Package = s.Span.Func().Scope().Name()
 	js.Func.Name = s.Span.Func().ShortName()
 	js.Trace.Id = s.Span.Trace().Id()
-	js.Start = s.Span.Start().UnixNano()
-	js.Finish = s.Finish.UnixNano()
+	js.Start = s.Span.WallStart().UnixNano()
+	js.Finish = s.Span.WallTime(s.Finish).UnixNano()
 	js.Orphaned = s.Span.Orphaned()
 	if s.Err != nil {
 		errstr := s.Err.Error()
 		js.Err = errstr
 	}
 	js.Panicked = s.Panicked
+	js.Status, js.StatusMsg = formatStatus(s.Span)
 	js.Args = make([]string, 0, len(s.Span.Args()))
 	for _, arg := range s.Span.Args() {
 		js.Args = append(js.Args, fmt.Sprintf("%#v", arg))
 	}
-	js.Annotations = make([][]string, 0, len(s.Span.Annotations()))
-	for _, annotation := range s.Span.Annotations() {
-		js.Annotations = append(js.Annotations,
-			[]string{annotation.Name, annotation.Value})
-	}
+	js.Annotations = formatAnnotations(s.Span.Annotations())
 	return js
 }
 
+// formatStatus returns the name and message of the Span's status, or empty
+// strings if the status is unset.
+func formatStatus(s *monkit.Span) (status, message string) {
+	code, message := s.Status()
+	if code == monkit.StatusUnset {
+		return "", ""
+	}
+	return code.String(), message
+}
+
+// formatAnnotations turns annotations into name/value pairs, keeping the
+// type of values added with Span.AnnotateValue where they can be represented
+// in JSON.
+func formatAnnotations(annotations []monkit.Annotation) [][]interface{} {
+	rv := make([][]interface{}, 0, len(annotations))
+	for _, annotation := range annotations {
+		var val interface{} = annotation.Value
+		if annotation.Raw != nil {
+			if _, err := json.Marshal(annotation.Raw); err == nil {
+				val = annotation.Raw
+			}
+		}
+		rv = append(rv, []interface{}{annotation.Name, val})
+	}
+	return rv
+}
+
 type durationStats struct {
 	Average          time.Duration            `json:"average"`
 	ReservoirAverage time.Duration            `json:"reservoir_average"`
@@ -29,10 +29,12 @@ import (
 
 	"github.com/spacemonkeygo/monkit/v3"
 	"github.com/spacemonkeygo/monkit/v3/collect"
+	"github.com/spacemonkeygo/monkit/v3/prometheus"
 )
 
 const (
-	SampledKey   = "sampled"
+	// SampledKey is the same as monkit.SampledKey.
+	SampledKey   = monkit.SampledKey
 	SampledCBKey = "sampled-cb"
 )
 
@@ -52,17 +54,26 @@ func curry(reg *monkit.Registry,
 //
 // FromRequest understands the following paths:
 //  * /ps, /ps/text       - returns the result of SpansText
+//                          (/spans is an alias for /ps)
 //  * /ps/dot             - returns the result of SpansDot
-//  * /ps/json            - returns the result of SpansJSON
+//  * /ps/json            - returns the result of SpansJSON, or of
+//                          SpansJSONLevel given a level query parameter
+//  * /ps/tree            - returns the result of SpansTreeJSON
 //  * /funcs, /funcs/text - returns the result of FuncsText
 //  * /funcs/dot          - returns the result of FuncsDot
 //  * /funcs/json         - returns the result of FuncsJSON
-//  * /stats, /stats/text - returns the result of StatsText
+//  * /stats, /stats/text - returns the result of StatsText, or of
+//                          StatsTextSorted given sorted=true
 //  * /stats/json         - returns the result of StatsJSON
+//  * /stats/csv          - returns the result of StatsCSV
+//  * /stats/openmetrics  - returns the result of OpenMetrics
+//  * /stats/influx       - returns the result of InfluxLineProtocol
 //  * /trace/svg          - returns the result of TraceQuerySVG
 //  * /trace/json         - returns the result of TraceQueryJSON
 //  * /trace/remote       - returns trace id or redirect
 //
+// Unknown paths return a Not Found error listing the available endpoints.
+//
 // The last two paths are worth discussing in more detail, as they take
 // query parameters. All trace endpoints require at least one of the following
 // two query parameters:
@@ -105,14 +116,25 @@ func FromRequest(reg *monkit.Registry, path string, query url.Values) (
 	switch first {
 	case "":
 		return writeIndex, "text/html", nil
-	case "ps":
+	case "ps", "spans":
 		switch second {
 		case "", "text":
 			return curry(reg, SpansText), "text/plain; charset=utf-8", nil
 		case "dot":
 			return curry(reg, SpansDot), "text/plain; charset=utf-8", nil
 		case "json":
-			return curry(reg, SpansJSON), "application/json; charset=utf-8", nil
+			level := monkit.LevelDebug
+			if name := query.Get("level"); name != "" {
+				var ok bool
+				if level, ok = monkit.ParseLevel(name); !ok {
+					return nil, "", errBadRequest.New("invalid level %#v", name)
+				}
+			}
+			return func(w io.Writer) error {
+				return SpansJSONLevel(reg, w, level)
+			}, "application/json; charset=utf-8", nil
+		case "tree":
+			return curry(reg, SpansTreeJSON), "application/json; charset=utf-8", nil
 		}
 
 	case "funcs":
@@ -128,6 +150,11 @@ func FromRequest(reg *monkit.Registry, path string, query url.Values) (
 	case "stats":
 		switch second {
 		case "", "text", "old":
+			if sorted, _ := strconv.ParseBool(query.Get("sorted")); sorted {
+				return func(w io.Writer) error {
+					return StatsTextSorted(reg, w)
+				}, "text/plain; charset=utf-8", nil
+			}
 			return func(w io.Writer) error {
 				return StatsText(reg, w)
 			}, "text/plain; charset=utf-8", nil
@@ -135,6 +162,18 @@ func FromRequest(reg *monkit.Registry, path string, query url.Values) (
 			return func(w io.Writer) error {
 				return StatsJSON(reg, w)
 			}, "application/json; charset=utf-8", nil
+		case "csv":
+			return func(w io.Writer) error {
+				return StatsCSV(reg, w)
+			}, "text/csv; charset=utf-8", nil
+		case "openmetrics":
+			return func(w io.Writer) error {
+				return OpenMetrics(reg, w)
+			}, prometheus.OpenMetricsContentType, nil
+		case "influx":
+			return func(w io.Writer) error {
+				return InfluxLineProtocol(reg, w)
+			}, "text/plain; charset=utf-8", nil
 		}
 
 	case "trace":
@@ -272,7 +311,17 @@ func FromRequest(reg *monkit.Registry, path string, query url.Values) (
 			}, contentType, nil
 		}
 	}
-	return nil, "", errNotFound.New("path not found: %s", path)
+	return nil, "", errNotFound.New("path not found: %s (available endpoints: %s)",
+		path, strings.Join(endpoints, ", "))
+}
+
+// endpoints lists the paths FromRequest understands, for error messages.
+var endpoints = []string{
+	"/ps", "/ps/text", "/ps/dot", "/ps/json", "/ps/tree", "/spans",
+	"/funcs", "/funcs/text", "/funcs/dot", "/funcs/json",
+	"/stats", "/stats/text", "/stats/json", "/stats/csv", "/stats/openmetrics",
+	"/stats/influx",
+	"/trace/svg", "/trace/json", "/trace/remote",
 }
 
 var vizRedirectHTML = template.Must(template.New("vizredirect").Parse(`
@@ -300,6 +349,7 @@ func writeIndex(w io.Writer) error {
 		<dl style="max-width: 80ch;">
 			<dt><a href="ps">/ps</a></dt>
 			<dt><a href="ps/json">/ps/json</a></dt>
+			<dt><a href="ps/tree">/ps/tree</a></dt>
 			<dt><a href="ps/dot">/ps/dot</a></dt>
 			<dd>Information about active spans.</dd>
 
@@ -310,6 +360,9 @@ func writeIndex(w io.Writer) error {
 
 			<dt><a href="stats">/stats</a></dt>
 			<dt><a href="stats/json">/stats/json</a></dt>
+			<dt><a href="stats/csv">/stats/csv</a></dt>
+			<dt><a href="stats/openmetrics">/stats/openmetrics</a></dt>
+			<dt><a href="stats/influx">/stats/influx</a></dt>
 			<dt><a href="stats/svg">/stats/svg</a></dt>
 			<dd>Statistics about all observed functions, scopes and values.</dd>
 
@@ -0,0 +1,122 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// remoteClient fetches the stats of RemoteStatSources.
+var remoteClient = &http.Client{Timeout: 10 * time.Second}
+
+// RemoteStatSource returns a StatSource that fetches the stats of another
+// process from statsURL, such as "http://10.0.0.2:9000/stats", every time
+// its Stats method is called. The remote end is expected to serve this
+// package's HTTP handler; the stats are requested as JSON (see StatsJSON).
+// Every remote stat gets a host tag set to the host of statsURL, so stats of
+// several processes can be merged with monkit.MergeStatSources without
+// colliding.
+//
+// Fetching never fails the walk. Instead, a scrape_error stat tagged with
+// the host reports 1 if the stats couldn't be fetched or parsed, in which
+// case no remote stats are reported, and 0 otherwise.
+func RemoteStatSource(statsURL string) monkit.StatSource {
+	host := statsURL
+	if u, err := url.Parse(statsURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	errKey := monkit.NewSeriesKey("scrape_error").WithTag("host", host)
+
+	return monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			stats, err := fetchStats(statsURL)
+			if err != nil {
+				cb(errKey, "value", 1)
+				return
+			}
+			cb(errKey, "value", 0)
+			for _, stat := range stats {
+				key := monkit.NewSeriesKey(stat.measurement).
+					WithTags(stat.tags...).WithTag("host", host)
+				cb(key, stat.field, stat.value)
+			}
+		})
+}
+
+type remoteStat struct {
+	measurement string
+	tags        []monkit.SeriesTag
+	field       string
+	value       float64
+}
+
+// fetchStats gets and parses the stats served as JSON at statsURL.
+func fetchStats(statsURL string) (stats []remoteStat, err error) {
+	req, err := http.NewRequest(http.MethodGet, statsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var rows [][]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, err
+	}
+	stats = make([]remoteStat, 0, len(rows))
+	for _, row := range rows {
+		if len(row) != 4 {
+			return nil, fmt.Errorf("unexpected stat: %s", row)
+		}
+		var stat remoteStat
+		var tags map[string]string
+		var value *float64
+		if err := json.Unmarshal(row[0], &stat.measurement); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(row[1], &tags); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(row[2], &stat.field); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(row[3], &value); err != nil {
+			return nil, err
+		}
+		for key, val := range tags {
+			stat.tags = append(stat.tags, monkit.NewSeriesTag(key, val))
+		}
+		stat.value = math.NaN()
+		if value != nil {
+			stat.value = *value
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// collectRemote returns the stats source reports, by full name.
+func collectRemote(source monkit.StatSource) map[string]float64 {
+	stats := map[string]float64{}
+	source.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		stats[key.WithField(field)] = val
+	})
+	return stats
+}
+
+func TestRemoteStatSource(t *testing.T) {
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			cb(monkit.NewSeriesKey("requests").WithTag("kind", "get"), "total", 3)
+			cb(monkit.NewSeriesKey("latency"), "avg", math.NaN())
+		}))
+	server := httptest.NewServer(HTTP(r))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	stats := collectRemote(RemoteStatSource(server.URL + "/stats"))
+	expected := map[string]float64{
+		"scrape_error,host=" + host + " value":                 0,
+		"requests,host=" + host + ",kind=get,scope=test total": 3,
+	}
+	for name, val := range expected {
+		if got, ok := stats[name]; !ok || got != val {
+			t.Fatalf("expected %s=%v, got %v", name, val, stats)
+		}
+	}
+	if avg, ok := stats["latency,host="+host+",scope=test avg"]; !ok ||
+		!math.IsNaN(avg) {
+		t.Fatalf("expected null values to become NaN, got %v", stats)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+// scrapeError fetches stats with RemoteStatSource from a server with the
+// given handler and checks that only the scrape error is reported.
+func scrapeError(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	stats := collectRemote(RemoteStatSource(server.URL))
+	expected := map[string]float64{"scrape_error,host=" + host + " value": 1}
+	if fmt.Sprint(stats) != fmt.Sprint(expected) {
+		t.Fatalf("expected only a scrape error, got %v", stats)
+	}
+}
+
+func TestRemoteStatSourceMalformed(t *testing.T) {
+	for _, body := range []string{
+		`[["requests", {}, "total"]]`,
+		`[["requests", {}, "total", "three"]]`,
+		`[["requests", {}, "total", 3],`,
+		`not json`,
+	} {
+		scrapeError(t, func(w http.ResponseWriter, req *http.Request) {
+			_, _ = fmt.Fprint(w, body)
+		})
+	}
+}
+
+func TestRemoteStatSourceStatus(t *testing.T) {
+	scrapeError(t, func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+}
+
+func TestRemoteStatSourceTimeout(t *testing.T) {
+	defer func(client *http.Client) { remoteClient = client }(remoteClient)
+	remoteClient = &http.Client{Timeout: 10 * time.Millisecond}
+
+	release := make(chan struct{})
+	defer close(release)
+	scrapeError(t, func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	})
+}
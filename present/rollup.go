@@ -0,0 +1,139 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"sort"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// rollupQuantiles are the reservoir quantiles ScopeRollup approximates.
+var rollupQuantiles = []struct {
+	field string
+	q     float64
+}{{"r50", .5}, {"r90", .9}, {"r99", .99}}
+
+// ScopeRollup returns a StatSource that reports one series per Scope of the
+// Registry, summarizing all of the Scope's Funcs instead of reporting each
+// Func, which keeps the number of series on a dashboard down to the number
+// of Scopes. Each series is named "scope_rollup", tagged with the Scope's
+// name, and has the fields
+//
+//	funcs                          - the number of Funcs in the Scope
+//	current                        - the calls currently running
+//	total, successes, failures     - finished calls, summed over the Funcs
+//	errors, panics                 - failed calls, summed over the Funcs
+//	count, sum, min, avg, max      - of the durations of all finished calls
+//	r50, r90, r99                  - approximate duration percentiles
+//
+// Durations are in seconds. The counts, sum, min, avg, and max are exact, but
+// percentiles can't be combined exactly from the sampled reservoirs the Funcs
+// keep. Instead, each percentile is the count-weighted average of that
+// percentile of every Func's success and failure durations, so busy Funcs
+// dominate as they would in the exact result. The blend is exact when all
+// Funcs have the same distribution, and otherwise can be off in either
+// direction; in particular it smooths over a tail that only a few Funcs
+// contribute to, so the r99 of a Scope with one slow, busy Func is
+// understated. Use the per-Func stats to find out where the tail comes from.
+func ScopeRollup(r *monkit.Registry) monkit.StatSource {
+	return monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			rollups := map[string]*scopeRollup{}
+			r.Funcs(func(f *monkit.Func) {
+				name := f.Scope().Name()
+				rollup, ok := rollups[name]
+				if !ok {
+					rollup = &scopeRollup{quantiles: make([]float64, len(rollupQuantiles))}
+					rollups[name] = rollup
+				}
+				rollup.add(f.Snapshot())
+			})
+
+			names := make([]string, 0, len(rollups))
+			for name := range rollups {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				rollups[name].stats(
+					monkit.NewSeriesKey("scope_rollup").WithTag("scope", name), cb)
+			}
+		})
+}
+
+// scopeRollup sums the stats of the Funcs of one Scope.
+type scopeRollup struct {
+	funcs     int64
+	current   int64
+	successes int64
+	errors    int64
+	panics    int64
+
+	count     int64
+	sum       time.Duration
+	low, high time.Duration
+
+	// quantiles holds the sum of every Func's quantiles weighted by count.
+	quantiles []float64
+}
+
+func (s *scopeRollup) add(snap monkit.FuncStatsSnapshot) {
+	s.funcs++
+	s.current += snap.Current
+	s.successes += snap.Successes
+	s.errors += snap.ErrorCount
+	s.panics += snap.Panics
+	for _, d := range []*monkit.DurationDist{snap.SuccessTimes, snap.FailureTimes} {
+		if d.Count == 0 {
+			continue
+		}
+		if s.count == 0 || d.Low < s.low {
+			s.low = d.Low
+		}
+		if s.count == 0 || d.High > s.high {
+			s.high = d.High
+		}
+		s.count += d.Count
+		s.sum += d.Sum
+		for i, q := range rollupQuantiles {
+			s.quantiles[i] += float64(d.Count) * d.Query(q.q).Seconds()
+		}
+	}
+}
+
+func (s *scopeRollup) stats(key monkit.SeriesKey,
+	cb func(key monkit.SeriesKey, field string, val float64)) {
+	failures := s.errors + s.panics
+	cb(key, "funcs", float64(s.funcs))
+	cb(key, "current", float64(s.current))
+	cb(key, "total", float64(s.successes+failures))
+	cb(key, "successes", float64(s.successes))
+	cb(key, "failures", float64(failures))
+	cb(key, "errors", float64(s.errors))
+	cb(key, "panics", float64(s.panics))
+	cb(key, "count", float64(s.count))
+	if s.count == 0 {
+		return
+	}
+	cb(key, "sum", s.sum.Seconds())
+	cb(key, "min", s.low.Seconds())
+	cb(key, "avg", (s.sum / time.Duration(s.count)).Seconds())
+	cb(key, "max", s.high.Seconds())
+	for i, q := range rollupQuantiles {
+		cb(key, q.field, s.quantiles[i]/float64(s.count))
+	}
+}
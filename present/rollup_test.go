@@ -0,0 +1,87 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestScopeRollup(t *testing.T) {
+	r := monkit.NewRegistry()
+	now := time.Unix(1000, 0)
+	r.SetClock(func() time.Time { return now })
+
+	call := func(f *monkit.Func, d time.Duration, err error) {
+		ctx := context.Background()
+		finish := f.Task(&ctx)
+		now = now.Add(d)
+		finish(&err)
+	}
+	pkg := r.ScopeNamed("pkg")
+	a, b := pkg.FuncNamed("a"), pkg.FuncNamed("b")
+	call(a, time.Second, nil)
+	call(a, 3*time.Second, nil)
+	call(b, 2*time.Second, errors.New("failed"))
+	ctx := context.Background()
+	defer b.Task(&ctx)(nil)
+
+	// funcs of child scopes are rolled up on their own
+	sub := pkg.Group("sub")
+	call(sub.FuncNamed("c"), 10*time.Second, nil)
+
+	// scopes without funcs aren't reported
+	r.ScopeNamed("empty").Counter("requests").Inc(1)
+
+	rollups := map[string]map[string]float64{}
+	ScopeRollup(r).Stats(func(key monkit.SeriesKey, field string, val float64) {
+		if key.Measurement != "scope_rollup" {
+			t.Fatalf("unexpected series %v", key)
+		}
+		scope := key.Tags.Get("scope")
+		if rollups[scope] == nil {
+			rollups[scope] = map[string]float64{}
+		}
+		rollups[scope][field] = val
+	})
+	if len(rollups) != 2 {
+		t.Fatalf("expected a rollup per scope with funcs, got %v", rollups)
+	}
+
+	for field, expected := range map[string]float64{
+		"funcs": 2, "current": 1, "total": 3, "successes": 2, "failures": 1,
+		"errors": 1, "panics": 0, "count": 3, "sum": 6, "min": 1, "avg": 2,
+		"max": 3,
+	} {
+		if val, ok := rollups["pkg"][field]; !ok || val != expected {
+			t.Fatalf("expected pkg %s to be %v, got %v", field, expected, val)
+		}
+	}
+	for field, expected := range map[string]float64{
+		"funcs": 1, "current": 0, "total": 1, "successes": 1, "count": 1,
+		"sum": 10, "min": 10, "max": 10, "r50": 10, "r99": 10,
+	} {
+		if val, ok := rollups["pkg.sub"][field]; !ok || val != expected {
+			t.Fatalf("expected pkg.sub %s to be %v, got %v", field, expected, val)
+		}
+	}
+	if r50 := rollups["pkg"]["r50"]; r50 < 1 || r50 > 3 {
+		t.Fatalf("expected pkg r50 within the observed durations, got %v", r50)
+	}
+}
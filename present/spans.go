@@ -27,6 +27,9 @@ func outputDotSpan(w io.Writer, s *monkit.Span) error {
 	if s.Orphaned() {
 		orphaned = "orphaned\n"
 	}
+	if dropped := s.DroppedChildren(); dropped > 0 {
+		orphaned += fmt.Sprintf("%d more children not tracked\n", dropped)
+	}
 	_, err := fmt.Fprintf(w,
 		" f%d [label=\"%s",
 		s.Id(), escapeDotLabel("%s(%s)\nelapsed: %s\n%s",
@@ -87,6 +90,9 @@ func outputTextSpan(w io.Writer, s *monkit.Span, indent string) (err error) {
 	if s.Orphaned() {
 		orphaned = ", orphaned"
 	}
+	if level := s.Level(); level != monkit.LevelInfo {
+		orphaned += ", " + level.String()
+	}
 	_, err = fmt.Fprintf(w, "%s[%d,%d] %s(%s) (elapsed: %s%s)\n",
 		indent, s.Id(), s.Trace().Id(), s.Func().FullName(), strings.Join(s.Args(), ", "),
 		s.Duration(), orphaned)
@@ -106,6 +112,10 @@ func outputTextSpan(w io.Writer, s *monkit.Span, indent string) (err error) {
 		}
 		err = outputTextSpan(w, s, indent+" ")
 	})
+	if dropped := s.DroppedChildren(); err == nil && dropped > 0 {
+		_, err = fmt.Fprintf(w, "%s (%d more children not tracked)\n", indent,
+			dropped)
+	}
 	return err
 }
 
@@ -128,9 +138,30 @@ func SpansText(r *monkit.Registry, w io.Writer) (err error) {
 // SpansJSON finds all of the current Spans known by Registry r and writes
 // information about them in the JSON format to w.
 func SpansJSON(r *monkit.Registry, w io.Writer) (err error) {
+	return SpansJSONLevel(r, w, monkit.LevelDebug)
+}
+
+// SpansJSONLevel is like SpansJSON, but only writes Spans with at least the
+// given level. See Span.SetLevel.
+func SpansJSONLevel(r *monkit.Registry, w io.Writer, min monkit.Level) (
+	err error) {
 	lw := newListWriter(w)
 	r.AllSpans(func(s *monkit.Span) {
-		lw.elem(formatSpan(s))
+		if s.Level() >= min {
+			lw.elem(formatSpan(s))
+		}
+	})
+	return lw.done()
+}
+
+// SpansTreeJSON finds all of the current Spans known by Registry r and writes
+// them to w as a JSON list of span trees, where each span lists its children.
+// Orphaned spans are listed as roots. Each tree is collected before it is
+// written, so a slow writer does not hold up spans that are completing.
+func SpansTreeJSON(r *monkit.Registry, w io.Writer) (err error) {
+	lw := newListWriter(w)
+	r.RootSpans(func(s *monkit.Span) {
+		lw.elem(formatSpanTree(s))
 	})
 	return lw.done()
 }
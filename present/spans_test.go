@@ -0,0 +1,175 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// start starts a Task named name as a child of the Span in ctx, if any, and
+// returns the new context and the function that ends the Task.
+func start(mon *monkit.Scope, ctx context.Context, name string) (
+	context.Context, func()) {
+	finish := mon.TaskNamed(name)(&ctx)
+	return ctx, func() { finish(nil) }
+}
+
+func decodeSpanTrees(t *testing.T, r *monkit.Registry) []*spanTree {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := SpansTreeJSON(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var trees []*spanTree
+	if err := json.Unmarshal(buf.Bytes(), &trees); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	return trees
+}
+
+func TestSpansTreeJSON(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	rootCtx, finishRoot := start(mon, context.Background(), "root")
+	defer finishRoot()
+	childCtx, finishChild := start(mon, rootCtx, "child")
+	defer finishChild()
+	monkit.SpanFromCtx(childCtx).Annotate("key", "val")
+	_, finishGrandchild := start(mon, childCtx, "grandchild")
+	defer finishGrandchild()
+	_, finishSibling := start(mon, rootCtx, "sibling")
+	defer finishSibling()
+
+	// an orphan is left behind when its parent finishes first
+	parentCtx, finishParent := start(mon, context.Background(), "parent")
+	_, finishOrphan := start(mon, parentCtx, "orphan")
+	defer finishOrphan()
+	finishParent()
+
+	trees := decodeSpanTrees(t, r)
+	byName := map[string]*spanTree{}
+	for _, tree := range trees {
+		byName[tree.Func.Name] = tree
+	}
+	if len(trees) != 2 || byName["root"] == nil || byName["orphan"] == nil {
+		t.Fatalf("expected the root and the orphan as roots, got %d trees", len(trees))
+	}
+
+	root := byName["root"]
+	if root.ParentId != nil || root.Orphaned || len(root.Children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	child, sibling := root.Children[0], root.Children[1]
+	if child.Func.Name != "child" || sibling.Func.Name != "sibling" {
+		child, sibling = sibling, child
+	}
+	if child.Func.Name != "child" || sibling.Func.Name != "sibling" ||
+		len(sibling.Children) != 0 {
+		t.Fatalf("unexpected children: %+v, %+v", child, sibling)
+	}
+	for _, tree := range []*spanTree{child, sibling} {
+		if tree.ParentId == nil || *tree.ParentId != root.Id ||
+			tree.Trace.Id != root.Trace.Id {
+			t.Fatalf("expected %s to be linked to the root", tree.Func.Name)
+		}
+	}
+	if len(child.Annotations) != 1 || child.Annotations[0][0] != "key" ||
+		child.Annotations[0][1] != "val" {
+		t.Fatalf("unexpected annotations: %v", child.Annotations)
+	}
+	if len(child.Children) != 1 || child.Children[0].Func.Name != "grandchild" ||
+		*child.Children[0].ParentId != child.Id {
+		t.Fatalf("expected the grandchild under the child: %+v", child.Children)
+	}
+
+	orphan := byName["orphan"]
+	if !orphan.Orphaned || orphan.ParentId == nil || orphan.Children == nil {
+		t.Fatalf("unexpected orphan: %+v", orphan)
+	}
+}
+
+func TestSpansTreeJSONDeep(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	const depth = 1000
+	ctx := context.Background()
+	for i := 0; i < depth; i++ {
+		var finish func()
+		ctx, finish = start(mon, ctx, "span")
+		defer finish()
+	}
+
+	trees := decodeSpanTrees(t, r)
+	if len(trees) != 1 {
+		t.Fatalf("expected a single tree, got %d", len(trees))
+	}
+	levels := 0
+	for tree := trees[0]; tree != nil; levels++ {
+		switch len(tree.Children) {
+		case 0:
+			tree = nil
+		case 1:
+			tree = tree.Children[0]
+		default:
+			t.Fatalf("unexpected children at level %d", levels)
+		}
+	}
+	if levels != depth {
+		t.Fatalf("expected %d levels, got %d", depth, levels)
+	}
+}
+
+func TestSpansTreeJSONTypedAnnotations(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	ctx, finish := start(mon, context.Background(), "root")
+	defer finish()
+	span := monkit.SpanFromCtx(ctx)
+	span.AnnotateValue("int", 3)
+	span.AnnotateValue("float", 1.5)
+	span.AnnotateValue("bool", true)
+	span.AnnotateValue("string", "4")
+	span.AnnotateValue("unencodable", make(chan int))
+
+	// the annotations themselves keep the stringified value
+	expectedValues := []string{"3", "1.5", "true", "4"}
+	annotations := span.Annotations()
+	for i, expected := range expectedValues {
+		if annotations[i].Value != expected {
+			t.Fatalf("expected %q for %s, got %q",
+				expected, annotations[i].Name, annotations[i].Value)
+		}
+	}
+
+	trees := decodeSpanTrees(t, r)
+	if len(trees) != 1 || len(trees[0].Annotations) != 5 {
+		t.Fatalf("unexpected trees: %+v", trees)
+	}
+	expected := []interface{}{3.0, 1.5, true, "4", annotations[4].Value}
+	for i, annotation := range trees[0].Annotations {
+		if annotation[1] != expected[i] {
+			t.Fatalf("expected %s to be %#v, got %#v",
+				annotation[0], expected[i], annotation[1])
+		}
+	}
+}
@@ -15,10 +15,18 @@
 package present
 
 import (
+	"bufio"
+	"encoding/csv"
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/spacemonkeygo/monkit/v3"
+	"github.com/spacemonkeygo/monkit/v3/present/influx"
+	"github.com/spacemonkeygo/monkit/v3/prometheus"
 )
 
 // StatsOld is deprecated.
@@ -36,12 +44,129 @@ func StatsText(r *monkit.Registry, w io.Writer) (err error) {
 	return err
 }
 
+// StatsTextSorted is like StatsText, but sorts the statistics by their full
+// name first, so the output doesn't depend on map iteration order and can be
+// diffed or compared against golden files. All statistics are collected
+// before any are written.
+func StatsTextSorted(r *monkit.Registry, w io.Writer) (err error) {
+	type stat struct {
+		name string
+		val  float64
+	}
+	var stats []stat
+	r.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		stats = append(stats, stat{name: key.WithField(field), val: val})
+	})
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].name < stats[j].name
+	})
+	for _, s := range stats {
+		if _, err = fmt.Fprintf(w, "%s=%f\n", s.name, s.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // StatsJSON writes all of the name/value statistics pairs the Registry knows
-// to w in a JSON format.
+// to w in a JSON format. NaN and infinite values are written as null.
 func StatsJSON(r *monkit.Registry, w io.Writer) (err error) {
 	lw := newListWriter(w)
 	r.Stats(func(key monkit.SeriesKey, field string, val float64) {
-		lw.elem([]interface{}{key.Measurement, key.Tags.All(), field, val})
+		lw.elem([]interface{}{
+			key.Measurement, key.Tags.All(), field, jsonValue(val)})
 	})
 	return lw.done()
 }
+
+// jsonValue returns val, or nil for NaN and infinite values, which JSON can't
+// represent and empty distributions can produce.
+func jsonValue(val float64) interface{} {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return nil
+	}
+	return val
+}
+
+// StatsCSV writes all of the name/value statistics pairs the Registry knows
+// to w as CSV with a name,value header row. NaN and infinite values, which
+// empty distributions can produce, are written as empty cells.
+func StatsCSV(r *monkit.Registry, w io.Writer) (err error) {
+	cw := csv.NewWriter(w)
+	err = cw.Write([]string{"name", "value"})
+	r.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		if err != nil {
+			return
+		}
+		value := ""
+		if !math.IsNaN(val) && !math.IsInf(val, 0) {
+			value = strconv.FormatFloat(val, 'f', -1, 64)
+		}
+		err = cw.Write([]string{key.WithField(field), value})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// OpenMetrics writes all of the statistics the Registry knows to w in the
+// OpenMetrics text format, with TYPE, UNIT, and HELP metadata and the
+// terminating "# EOF" line. See prometheus.WriteOpenMetrics for how stats are
+// named and where their descriptions and units come from.
+func OpenMetrics(r *monkit.Registry, w io.Writer) error {
+	return prometheus.WriteOpenMetrics(r, w)
+}
+
+// InfluxLineProtocol writes all of the statistics the Registry knows to w in
+// the InfluxDB line protocol, timestamped with the current time. See
+// influx.WriteLines for how stats are mapped to lines and escaped.
+func InfluxLineProtocol(r *monkit.Registry, w io.Writer) error {
+	return influx.WriteLines(r, w, time.Now())
+}
+
+// streamFlushSize is roughly how much output StatsJSONStream buffers before
+// flushing it through to the underlying writer.
+const streamFlushSize = 32 * 1024
+
+// StatsJSONStream writes all of the name/value statistics pairs the Registry
+// knows to w in the same JSON format as StatsJSON. Each pair is encoded and
+// written as the Registry is walked, and output is regularly flushed through
+// to w, so the whole document is never held in memory. If w has a Flush
+// method, such as an http.Flusher or a bufio.Writer, it is called after each
+// flush as well.
+func StatsJSONStream(r *monkit.Registry, w io.Writer) error {
+	bw := bufio.NewWriterSize(w, streamFlushSize)
+	lw := newListWriter(bw)
+	r.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		lw.elem([]interface{}{
+			key.Measurement, key.Tags.All(), field, jsonValue(val)})
+		if lw.err == nil && bw.Buffered() >= streamFlushSize/2 {
+			lw.err = flushThrough(bw, w)
+		}
+	})
+	if err := lw.done(); err != nil {
+		return err
+	}
+	return flushThrough(bw, w)
+}
+
+// flushThrough flushes bw and then w, if w can be flushed.
+func flushThrough(bw *bufio.Writer, w io.Writer) error {
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return flush(w)
+}
+
+// flush flushes w, if w can be flushed.
+func flush(w io.Writer) error {
+	switch w := w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Flush() }:
+		w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// registryWith returns a Registry whose only stats are the ones source
+// reports.
+func registryWith(source monkit.StatSource) *monkit.Registry {
+	r := monkit.NewRegistry()
+	r.ScopeNamed("test").Chain(source)
+	return r
+}
+
+// decodeStats decodes StatsJSON formatted output.
+func decodeStats(t *testing.T, data []byte) [][]interface{} {
+	t.Helper()
+	var stats [][]interface{}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatalf("invalid JSON %q: %v", data, err)
+	}
+	return stats
+}
+
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (f *flushCounter) Flush() { f.flushes++ }
+
+func TestStatsJSONStream(t *testing.T) {
+	names := []string{`quo"te`, `back\slash`, "ctrl\x00\t\n\x1f", "plain"}
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			for i, name := range names {
+				key := monkit.NewSeriesKey(name).WithTag("tag", name)
+				cb(key, name, float64(i))
+			}
+			cb(monkit.NewSeriesKey("nan"), "value", math.NaN())
+			cb(monkit.NewSeriesKey("inf"), "value", math.Inf(1))
+			cb(monkit.NewSeriesKey("-inf"), "value", math.Inf(-1))
+		}))
+
+	var out flushCounter
+	if err := StatsJSONStream(r, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.flushes == 0 {
+		t.Fatal("expected w to be flushed")
+	}
+	stats := decodeStats(t, out.Bytes())
+	if len(stats) != len(names)+3 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	for i, name := range names {
+		stat := stats[i]
+		tags := stat[1].(map[string]interface{})
+		if stat[0] != name || tags["tag"] != name || stat[2] != name ||
+			stat[3] != float64(i) {
+			t.Fatalf("stat %d didn't round trip: %q", i, stat)
+		}
+	}
+	for _, stat := range stats[len(names):] {
+		if stat[3] != nil {
+			t.Fatalf("expected %v to be written as null, got %v", stat[0], stat[3])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := StatsJSON(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != out.String() {
+		t.Fatalf("expected StatsJSON output %q, got %q", buf.String(), out.String())
+	}
+}
+
+func TestStatsJSONStreamEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := StatsJSONStream(monkit.NewRegistry(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if stats := decodeStats(t, buf.Bytes()); stats == nil || len(stats) != 0 {
+		t.Fatalf("expected an empty list, got %q", buf.String())
+	}
+}
+
+func TestStatsJSONStreamSingle(t *testing.T) {
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			cb(monkit.NewSeriesKey("only"), "value", 1.5)
+		}))
+	var buf bytes.Buffer
+	if err := StatsJSONStream(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	stats := decodeStats(t, buf.Bytes())
+	if len(stats) != 1 || stats[0][0] != "only" || stats[0][2] != "value" ||
+		stats[0][3] != 1.5 {
+		t.Fatalf("unexpected stats: %q", buf.String())
+	}
+	if tags := stats[0][1].(map[string]interface{}); tags["scope"] != "test" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+}
+
+func TestStatsJSONStreamLarge(t *testing.T) {
+	const count = 10000
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			for i := 0; i < count; i++ {
+				cb(monkit.NewSeriesKey(fmt.Sprintf("series%d", i)), "value",
+					float64(i))
+			}
+		}))
+	var out flushCounter
+	if err := StatsJSONStream(r, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.flushes < 2 {
+		t.Fatalf("expected output to be flushed as it was written, got %d flushes",
+			out.flushes)
+	}
+	if stats := decodeStats(t, out.Bytes()); len(stats) != count {
+		t.Fatalf("expected %d stats, got %d", count, len(stats))
+	}
+}
+
+func TestStatsCSV(t *testing.T) {
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			key := monkit.NewSeriesKey("quoting").
+				WithTag("tag", `comma, "quote"`+"\nnewline")
+			cb(key, "value", 1.5)
+			cb(monkit.NewSeriesKey("nan"), "value", math.NaN())
+			cb(monkit.NewSeriesKey("inf"), "value", math.Inf(-1))
+		}))
+
+	var buf bytes.Buffer
+	if err := StatsCSV(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	expected := [][]string{
+		{"name", "value"},
+		{monkit.NewSeriesKey("quoting").
+			WithTag("tag", `comma, "quote"`+"\nnewline").
+			WithTag("scope", "test").WithField("value"), "1.5"},
+		{"nan,scope=test value", ""},
+		{"inf,scope=test value", ""},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Fatalf("expected %q, got %q", expected, records)
+	}
+}
+
+func TestStatsTextSorted(t *testing.T) {
+	names := []string{"b", "c", "a", "a.b", "ab"}
+	calls := 0
+	r := registryWith(monkit.StatSourceFunc(
+		func(cb func(key monkit.SeriesKey, field string, val float64)) {
+			// report in a different order on every call
+			calls++
+			for i := range names {
+				name := names[(i+calls)%len(names)]
+				cb(monkit.NewSeriesKey(name), "value", float64(len(name)))
+			}
+		}))
+
+	var first bytes.Buffer
+	if err := StatsTextSorted(r, &first); err != nil {
+		t.Fatal(err)
+	}
+	expected := "a,scope=test value=1.000000\n" +
+		"a.b,scope=test value=3.000000\n" +
+		"ab,scope=test value=2.000000\n" +
+		"b,scope=test value=1.000000\n" +
+		"c,scope=test value=1.000000\n"
+	if first.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, first.String())
+	}
+	for i := 0; i < 3; i++ {
+		var again bytes.Buffer
+		if err := StatsTextSorted(r, &again); err != nil {
+			t.Fatal(err)
+		}
+		if again.String() != first.String() {
+			t.Fatalf("expected stable output %q, got %q", first.String(),
+				again.String())
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsd pushes monkit statistics to a statsd or DogStatsD server
+// over UDP.
+//
+// Every measurement and field pair becomes a metric named
+// prefix.measurement.field. Fields that only ever increase, such as a Func's
+// successes or a distribution's count, are sent as statsd counters holding
+// the increase since the previous push. Everything else, including the
+// averages and reservoir percentiles of distributions, is sent as a gauge:
+// monkit only keeps summaries of distributions, so sending them as timings
+// would make the server summarize the summaries. With DogStatsD enabled,
+// series tags are sent as DogStatsD tags, as in
+//
+//	myapp.function.successes:42|c|#name:MyFunc,scope:main
+//
+// and otherwise they are folded into the metric name after the measurement,
+// as in
+//
+//	myapp.function.name_MyFunc.scope_main.successes:42|c
+//
+// Characters statsd doesn't allow are replaced with underscores. NaN and
+// infinite values are skipped. Metrics are batched into as few UDP packets as
+// possible without exceeding the configured packet size.
+package statsd // import "github.com/spacemonkeygo/monkit/v3/present/statsd"
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// DefaultMaxPacketSize keeps packets within a standard Ethernet MTU of 1500
+// bytes, after IP and UDP headers.
+const DefaultMaxPacketSize = 1432
+
+// counterFields are the fields monkit emits that only ever increase.
+var counterFields = map[string]bool{
+	"count":             true,
+	"total":             true,
+	"successes":         true,
+	"errors":            true,
+	"panics":            true,
+	"failures":          true,
+	"cancelled":         true,
+	"deadline_exceeded": true,
+	"slo_violations":    true,
+	"slo_total":         true,
+	"true":              true,
+	"false":             true,
+}
+
+// Options configures a Pusher.
+type Options struct {
+	// Prefix, if not empty, is prepended to every metric name, separated by
+	// a dot.
+	Prefix string
+
+	// DogStatsD, if true, sends series tags using the DogStatsD tag syntax
+	// instead of folding them into metric names.
+	DogStatsD bool
+
+	// MaxPacketSize is the most bytes sent in a single UDP packet. Metrics
+	// that don't fit in a packet on their own are sent alone. It defaults to
+	// DefaultMaxPacketSize.
+	MaxPacketSize int
+}
+
+// Pusher pushes monkit statistics to a statsd server over UDP. It remembers
+// the counters it sent so that each push only sends their increase. A Pusher
+// is safe for concurrent use.
+type Pusher struct {
+	addr string
+	opts Options
+
+	mtx      sync.Mutex
+	conn     net.Conn
+	counters map[string]float64
+}
+
+// NewPusher returns a Pusher that sends to the statsd server at addr, such as
+// "localhost:8125".
+func NewPusher(addr string, opts Options) *Pusher {
+	opts.Prefix = strings.TrimSuffix(opts.Prefix, ".")
+	if opts.MaxPacketSize <= 0 {
+		opts.MaxPacketSize = DefaultMaxPacketSize
+	}
+	return &Pusher{addr: addr, opts: opts, counters: map[string]float64{}}
+}
+
+// Push sends every stat of the Registry to the statsd server. A packet that
+// fails to send doesn't stop the rest from being sent; the first error is
+// returned.
+func (p *Pusher) Push(r *monkit.Registry) (err error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.conn == nil {
+		conn, err := net.Dial("udp", p.addr)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+	for _, packet := range p.packets(p.format(r)) {
+		if _, werr := p.conn.Write(packet); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		// redial next time, in case the address now resolves elsewhere.
+		p.closeConn()
+	}
+	return err
+}
+
+// Run pushes the Registry's stats every interval until ctx is canceled, and
+// then closes the Pusher. Failed pushes don't stop the loop; onError, if not
+// nil, is called with their errors.
+func (p *Pusher) Run(ctx context.Context, r *monkit.Registry,
+	interval time.Duration, onError func(error)) error {
+	defer p.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := p.Push(r); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Close closes the Pusher's socket, if any. The Pusher can still be used
+// afterwards.
+func (p *Pusher) Close() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.closeConn()
+}
+
+// closeConn closes the socket. p.mtx must be held.
+func (p *Pusher) closeConn() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// Run pushes the Registry's stats to the statsd server at addr every interval
+// until ctx is canceled, with the default Options. Push errors are ignored;
+// use a Pusher to observe them.
+func Run(ctx context.Context, r *monkit.Registry, addr string,
+	interval time.Duration) error {
+	return NewPusher(addr, Options{}).Run(ctx, r, interval, nil)
+}
+
+// format returns a statsd line for every stat of the Registry and updates
+// the remembered counters. p.mtx must be held.
+func (p *Pusher) format(r *monkit.Registry) (lines [][]byte) {
+	r.Stats(func(key monkit.SeriesKey, field string, val float64) {
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return
+		}
+		name, tags := p.name(key, field)
+		if counterFields[field] {
+			id := name + tags
+			last, seen := p.counters[id]
+			p.counters[id] = val
+			if seen && val >= last {
+				val -= last
+			}
+			lines = append(lines, p.line(name, val, "c", tags))
+			return
+		}
+		if val < 0 && !p.opts.DogStatsD {
+			// a signed gauge value changes the current value in plain
+			// statsd, so it has to be reset to zero first.
+			lines = append(lines, p.line(name, 0, "g", tags))
+		}
+		lines = append(lines, p.line(name, val, "g", tags))
+	})
+	return lines
+}
+
+func (p *Pusher) line(name string, val float64, typ, tags string) []byte {
+	var b bytes.Buffer
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(val, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(typ)
+	b.WriteString(tags)
+	return b.Bytes()
+}
+
+// packets batches lines into newline separated packets of at most
+// MaxPacketSize bytes.
+func (p *Pusher) packets(lines [][]byte) (packets [][]byte) {
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > p.opts.MaxPacketSize {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// name returns the statsd metric name for the series and field, and the
+// DogStatsD tag suffix, if any.
+func (p *Pusher) name(key monkit.SeriesKey, field string) (
+	name, tags string) {
+	all := key.Tags.All()
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	if p.opts.Prefix != "" {
+		b.WriteString(sanitize(p.opts.Prefix, true))
+		b.WriteByte('.')
+	}
+	b.WriteString(sanitize(key.Measurement, true))
+	if p.opts.DogStatsD {
+		var t strings.Builder
+		for _, k := range keys {
+			if t.Len() == 0 {
+				t.WriteString("|#")
+			} else {
+				t.WriteByte(',')
+			}
+			t.WriteString(sanitize(k, false))
+			t.WriteByte(':')
+			t.WriteString(sanitize(all[k], true))
+		}
+		tags = t.String()
+	} else {
+		for _, k := range keys {
+			b.WriteByte('.')
+			b.WriteString(sanitize(k, false))
+			b.WriteByte('_')
+			b.WriteString(sanitize(all[k], false))
+		}
+	}
+	b.WriteByte('.')
+	b.WriteString(sanitize(field, true))
+	return b.String(), tags
+}
+
+// sanitize replaces every character that isn't safe in a statsd metric name
+// or DogStatsD tag with an underscore. Dots are kept if allowDots is true.
+func sanitize(s string, allowDots bool) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '_', r == '-':
+			return r
+		case r == '.' && allowDots:
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// receive collects the lines of the packets sent to conn until it has been
+// quiet for a while.
+func receive(t *testing.T, conn net.PacketConn, maxSize int) (
+	lines map[string]bool) {
+	lines = map[string]bool{}
+	buf := make([]byte, 65536)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return lines
+		}
+		if n > maxSize {
+			t.Fatalf("packet of %d bytes exceeds %d", n, maxSize)
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			lines[line] = true
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("my/pkg")
+	mon.Counter("beans").Inc(3)
+	mon.FloatVal("temp").Observe(-2.5)
+	for i := 0; i < 40; i++ {
+		mon.Event("tick")
+	}
+
+	p := NewPusher(conn.LocalAddr().String(),
+		Options{Prefix: "app.", MaxPacketSize: 256})
+	defer p.Close()
+
+	if err := p.Push(r); err != nil {
+		t.Fatal(err)
+	}
+	lines := receive(t, conn, 256)
+	for _, expected := range []string{
+		"app.beans.scope_my_pkg.value:3|g",
+		"app.tick.scope_my_pkg.total:40|c",
+		"app.temp.scope_my_pkg.recent:0|g",
+		"app.temp.scope_my_pkg.recent:-2.5|g",
+	} {
+		if !lines[expected] {
+			t.Fatalf("missing %q in %v", expected, lines)
+		}
+	}
+
+	mon.Event("tick")
+	if err := p.Push(r); err != nil {
+		t.Fatal(err)
+	}
+	lines = receive(t, conn, 256)
+	if !lines["app.tick.scope_my_pkg.total:1|c"] {
+		t.Fatalf("expected counter delta in %v", lines)
+	}
+}
+
+func TestPushDogStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r := monkit.NewRegistry()
+	r.ScopeNamed("my/pkg").Counter("beans", monkit.NewSeriesTag("kind", "jelly")).
+		Inc(3)
+
+	p := NewPusher(conn.LocalAddr().String(), Options{DogStatsD: true})
+	defer p.Close()
+	if err := p.Push(r); err != nil {
+		t.Fatal(err)
+	}
+	lines := receive(t, conn, DefaultMaxPacketSize)
+	expected := "beans.value:3|g|#kind:jelly,scope:my_pkg"
+	if !lines[expected] {
+		t.Fatalf("missing %q in %v", expected, lines)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// RecordedTrace is a trace read back from the output of a trace writer by
+// ReadTraces. It and its spans are read-only.
+type RecordedTrace struct {
+	id       int64
+	root     string
+	start    time.Time
+	duration time.Duration
+	spans    []*RecordedSpan
+}
+
+// Id returns the id of the trace.
+func (t *RecordedTrace) Id() int64 { return t.id }
+
+// Root returns the full name of the func of the trace's first root span.
+func (t *RecordedTrace) Root() string { return t.root }
+
+// Start returns when the trace's first span started.
+func (t *RecordedTrace) Start() time.Time { return t.start }
+
+// Duration returns the time from the start of the trace's first span to the
+// finish of its last span.
+func (t *RecordedTrace) Duration() time.Duration { return t.duration }
+
+// Spans returns the root spans of the trace, sorted by start time. Spans
+// whose parent wasn't recorded with the trace, such as spans with a remote
+// parent, are roots too.
+func (t *RecordedTrace) Spans() []*RecordedSpan {
+	return append([]*RecordedSpan(nil), t.spans...)
+}
+
+// RecordedSpan is a finished span of a RecordedTrace.
+type RecordedSpan struct {
+	trace       *RecordedTrace
+	parent      *RecordedSpan
+	id          int64
+	parentId    *int64
+	pkg         string
+	name        string
+	start       time.Time
+	finish      time.Time
+	orphaned    bool
+	err         string
+	panicked    bool
+	status      monkit.StatusCode
+	statusMsg   string
+	args        []string
+	annotations []monkit.Annotation
+	links       []monkit.Link
+	events      []monkit.Event
+	children    []*RecordedSpan
+}
+
+// Id returns the id of the span.
+func (s *RecordedSpan) Id() int64 { return s.id }
+
+// ParentId returns the id of the span's parent, if it had one, even if the
+// parent wasn't recorded with the trace.
+func (s *RecordedSpan) ParentId() (int64, bool) {
+	if s.parentId == nil {
+		return 0, false
+	}
+	return *s.parentId, true
+}
+
+// Parent returns the span's parent, or nil if the span is a root of its
+// trace.
+func (s *RecordedSpan) Parent() *RecordedSpan { return s.parent }
+
+// Trace returns the trace the span belongs to.
+func (s *RecordedSpan) Trace() *RecordedTrace { return s.trace }
+
+// Package returns the name of the Scope of the span's func.
+func (s *RecordedSpan) Package() string { return s.pkg }
+
+// ShortName returns the name of the span's func without its Scope.
+func (s *RecordedSpan) ShortName() string { return s.name }
+
+// FullName returns the name of the span's func like monkit.Func.FullName.
+func (s *RecordedSpan) FullName() string { return s.pkg + "." + s.name }
+
+// Start returns when the span started.
+func (s *RecordedSpan) Start() time.Time { return s.start }
+
+// Finish returns when the span finished.
+func (s *RecordedSpan) Finish() time.Time { return s.finish }
+
+// Duration returns how long the span ran.
+func (s *RecordedSpan) Duration() time.Duration {
+	return s.finish.Sub(s.start)
+}
+
+// Orphaned returns true if the span finished after its parent.
+func (s *RecordedSpan) Orphaned() bool { return s.orphaned }
+
+// Err returns the error message the span finished with, or the empty string
+// if it succeeded.
+func (s *RecordedSpan) Err() string { return s.err }
+
+// Panicked returns true if the span finished with a panic.
+func (s *RecordedSpan) Panicked() bool { return s.panicked }
+
+// Status returns the status of the span like monkit.Span.Status.
+func (s *RecordedSpan) Status() (code monkit.StatusCode, message string) {
+	return s.status, s.statusMsg
+}
+
+// Args returns the formatted arguments of the span.
+func (s *RecordedSpan) Args() []string {
+	return append([]string(nil), s.args...)
+}
+
+// Annotations returns the annotations of the span. Annotations that were
+// added with a typed value have the value decoded from JSON as Raw, with
+// numbers kept as json.Number.
+func (s *RecordedSpan) Annotations() []monkit.Annotation {
+	return append([]monkit.Annotation(nil), s.annotations...)
+}
+
+// Links returns the links of the span.
+func (s *RecordedSpan) Links() []monkit.Link {
+	return append([]monkit.Link(nil), s.links...)
+}
+
+// Events returns the events of the span.
+func (s *RecordedSpan) Events() []monkit.Event {
+	return append([]monkit.Event(nil), s.events...)
+}
+
+// Children returns the child spans of the span, sorted by start time.
+func (s *RecordedSpan) Children() []*RecordedSpan {
+	return append([]*RecordedSpan(nil), s.children...)
+}
+
+// ReadTraces reads the traces written by a trace writer, such as one made by
+// NewTraceWriter, from r and calls cb with each of them in order. It stops at
+// the end of r or at the first malformed record, whose error it returns.
+func ReadTraces(r io.Reader, cb func(*RecordedTrace)) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for {
+		var record traceRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t := &RecordedTrace{
+			id:       record.TraceId,
+			root:     record.Root,
+			start:    time.Unix(0, record.Start),
+			duration: time.Duration(record.Duration),
+		}
+		for _, js := range record.Spans {
+			s, err := readSpan(t, nil, js)
+			if err != nil {
+				return err
+			}
+			t.spans = append(t.spans, s)
+		}
+		cb(t)
+	}
+}
+
+func readSpan(t *RecordedTrace, parent *RecordedSpan,
+	js *finishedSpanTree) (*RecordedSpan, error) {
+	if js == nil {
+		return nil, fmt.Errorf("trace %d has an empty span", t.id)
+	}
+	s := &RecordedSpan{
+		trace:    t,
+		parent:   parent,
+		id:       js.Id,
+		parentId: js.ParentId,
+		pkg:      js.Func.Package,
+		name:     js.Func.Name,
+		start:    time.Unix(0, js.Start),
+		finish:   time.Unix(0, js.Finish),
+		orphaned: js.Orphaned,
+		err:      js.Err,
+		panicked: js.Panicked,
+		args:     js.Args,
+	}
+	if js.Status != "" {
+		status, ok := monkit.ParseStatusCode(js.Status)
+		if !ok {
+			return nil, fmt.Errorf("span %d has an unknown status %q",
+				js.Id, js.Status)
+		}
+		s.status, s.statusMsg = status, js.StatusMsg
+	}
+	for _, annotation := range js.Annotations {
+		if len(annotation) != 2 {
+			return nil, fmt.Errorf("span %d has a malformed annotation", js.Id)
+		}
+		name, ok := annotation[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("span %d has a malformed annotation", js.Id)
+		}
+		a := monkit.Annotation{Name: name}
+		if val, ok := annotation[1].(string); ok {
+			a.Value = val
+		} else {
+			a.Value, a.Raw = fmt.Sprint(annotation[1]), annotation[1]
+		}
+		s.annotations = append(s.annotations, a)
+	}
+	for _, link := range js.Links {
+		var traceId monkit.TraceId
+		binary.BigEndian.PutUint64(traceId[:8], uint64(link.TraceIdHigh))
+		binary.BigEndian.PutUint64(traceId[8:], uint64(link.TraceId))
+		s.links = append(s.links, monkit.Link{
+			TraceId: traceId, SpanId: link.SpanId})
+	}
+	for _, event := range js.Events {
+		s.events = append(s.events, monkit.Event{
+			Name: event.Name, Time: time.Unix(0, event.Time)})
+	}
+	for _, child := range js.Children {
+		c, err := readSpan(t, s, child)
+		if err != nil {
+			return nil, err
+		}
+		s.children = append(s.children, c)
+	}
+	return s, nil
+}
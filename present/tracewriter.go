@@ -0,0 +1,219 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+	"github.com/spacemonkeygo/monkit/v3/collect"
+)
+
+// TraceWriterOptions configures a trace writer made by
+// NewTraceWriterWithOptions.
+type TraceWriterOptions struct {
+	// DropWhenBusy, if true, drops a completed trace instead of waiting when
+	// another trace is still being written. This keeps a slow writer from
+	// holding up the code that finished the trace, at the cost of losing
+	// traces. By default, completed traces wait for their turn.
+	DropWhenBusy bool
+
+	// OnError, if not nil, is called with any error encountered while
+	// encoding or writing a trace. Errors are otherwise ignored.
+	OnError func(error)
+}
+
+// NewTraceWriter returns a func suitable for Registry.ObserveTraces that
+// writes every trace, once all of its spans have finished, to w as a single
+// line of JSON (NDJSON). Each record has the trace id, the full name of the
+// root func, the trace's start time and duration in nanoseconds, and the tree
+// of its spans. Records are written one at a time, and w is flushed after
+// each one if it has a Flush method. See ReadTraces to read them back.
+func NewTraceWriter(w io.Writer) func(*monkit.Trace) {
+	return NewTraceWriterWithOptions(w, TraceWriterOptions{})
+}
+
+// NewTraceWriterWithOptions is like NewTraceWriter but with configurable
+// behavior. See TraceWriterOptions.
+func NewTraceWriterWithOptions(w io.Writer, opts TraceWriterOptions) func(
+	*monkit.Trace) {
+	tw := &traceWriter{w: w, opts: opts, format: formatTraceLine}
+	return tw.observe
+}
+
+// formatTraceLine encodes a trace as a single line of JSON.
+func formatTraceLine(t *monkit.Trace, spans []*collect.FinishedSpan) (
+	[]byte, error) {
+	data, err := json.Marshal(formatTraceRecord(t, spans))
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type traceWriter struct {
+	w      io.Writer
+	opts   TraceWriterOptions
+	format func(*monkit.Trace, []*collect.FinishedSpan) ([]byte, error)
+
+	busy int32
+	mtx  sync.Mutex
+}
+
+func (tw *traceWriter) observe(t *monkit.Trace) {
+	t.ObserveFinish(tw.write)
+}
+
+func (tw *traceWriter) write(t *monkit.Trace, spans []*collect.FinishedSpan) {
+	if tw.opts.DropWhenBusy {
+		if !atomic.CompareAndSwapInt32(&tw.busy, 0, 1) {
+			return
+		}
+		defer atomic.StoreInt32(&tw.busy, 0)
+	}
+
+	data, err := tw.format(t, spans)
+	if err == nil {
+		tw.mtx.Lock()
+		_, err = tw.w.Write(data)
+		if err == nil {
+			err = flush(tw.w)
+		}
+		tw.mtx.Unlock()
+	}
+	if err != nil && tw.opts.OnError != nil {
+		tw.opts.OnError(err)
+	}
+}
+
+// TraceJSON writes the Trace to w as JSON, in the same format as the records
+// of NewTraceWriter, plus a running field with the number of Spans that
+// haven't finished yet, if any. Only finished Spans are included, and they
+// are only recorded while the Registry is keeping recent traces. See
+// monkit.Registry.SetRecentTraceCapacity and monkit.Registry.FindTrace.
+func TraceJSON(t *monkit.Trace, w io.Writer) error {
+	var spans []*collect.FinishedSpan
+	t.FinishedSpans(func(s *monkit.Span) {
+		finish, _ := s.FinishTime()
+		err, panicked := s.Outcome()
+		spans = append(spans, &collect.FinishedSpan{
+			Span: s, Err: err, Panicked: panicked, Finish: finish})
+	})
+	record := formatTraceRecord(t, spans)
+	record.Running = t.Spans()
+	return json.NewEncoder(w).Encode(record)
+}
+
+type traceRecord struct {
+	TraceId  int64               `json:"trace_id"`
+	Root     string              `json:"root"`
+	Start    int64               `json:"start"`
+	Duration int64               `json:"duration"`
+	Running  int64               `json:"running,omitempty"`
+	Spans    []*finishedSpanTree `json:"spans"`
+}
+
+type finishedSpanTree struct {
+	Id       int64  `json:"id"`
+	ParentId *int64 `json:"parent_id,omitempty"`
+	Func     struct {
+		Package string `json:"package"`
+		Name    string `json:"name"`
+	} `json:"func"`
+	Start       int64               `json:"start"`
+	Finish      int64               `json:"finish"`
+	Orphaned    bool                `json:"orphaned"`
+	Err         string              `json:"err"`
+	Panicked    bool                `json:"panicked"`
+	Status      string              `json:"status,omitempty"`
+	StatusMsg   string              `json:"status_message,omitempty"`
+	Args        []string            `json:"args"`
+	Annotations [][]interface{}     `json:"annotations"`
+	Links       []spanLink          `json:"links,omitempty"`
+	Events      []spanEvent         `json:"events,omitempty"`
+	Children    []*finishedSpanTree `json:"children"`
+}
+
+// formatTraceRecord arranges the finished spans of a trace into trees sorted
+// by start time. Spans whose parent isn't among the spans, such as spans with
+// a remote parent, are roots.
+func formatTraceRecord(t *monkit.Trace,
+	spans []*collect.FinishedSpan) *traceRecord {
+	collect.StartTimeSorter(spans).Sort()
+
+	nodes := make(map[int64]*finishedSpanTree, len(spans))
+	for _, s := range spans {
+		nodes[s.Span.Id()] = formatFinishedSpanTree(s)
+	}
+
+	rv := &traceRecord{TraceId: t.Id(), Spans: []*finishedSpanTree{}}
+	var first *monkit.Span
+	var start, finish time.Time
+	for _, s := range spans {
+		node := nodes[s.Span.Id()]
+		if parentId, ok := s.Span.ParentId(); ok && nodes[parentId] != nil {
+			parent := nodes[parentId]
+			parent.Children = append(parent.Children, node)
+		} else {
+			if len(rv.Spans) == 0 {
+				rv.Root = s.Span.Func().FullName()
+			}
+			rv.Spans = append(rv.Spans, node)
+		}
+		if start.IsZero() || s.Span.Start().Before(start) {
+			first, start = s.Span, s.Span.Start()
+		}
+		if s.Finish.After(finish) {
+			finish = s.Finish
+		}
+	}
+	if first != nil {
+		rv.Start = first.WallStart().UnixNano()
+		rv.Duration = finish.Sub(start).Nanoseconds()
+	}
+	return rv
+}
+
+func formatFinishedSpanTree(s *collect.FinishedSpan) *finishedSpanTree {
+	js := &finishedSpanTree{}
+	js.Id = s.Span.Id()
+	if parent_id, ok := s.Span.ParentId(); ok {
+		js.ParentId = &parent_id
+	}
+	js.Func.Package = s.Span.Func().Scope().Name()
+	js.Func.Name = s.Span.Func().ShortName()
+	js.Start = s.Span.WallStart().UnixNano()
+	js.Finish = s.Span.WallTime(s.Finish).UnixNano()
+	js.Orphaned = s.Span.Orphaned()
+	if s.Err != nil {
+		js.Err = s.Err.Error()
+	}
+	js.Panicked = s.Panicked
+	js.Status, js.StatusMsg = formatStatus(s.Span)
+	js.Args = make([]string, 0, len(s.Span.Args()))
+	for _, arg := range s.Span.Args() {
+		js.Args = append(js.Args, fmt.Sprintf("%#v", arg))
+	}
+	js.Annotations = formatAnnotations(s.Span.Annotations())
+	js.Links = formatLinks(s.Span.Links())
+	js.Events = formatEvents(s.Span)
+	js.Children = []*finishedSpanTree{}
+	return js
+}
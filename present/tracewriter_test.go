@@ -0,0 +1,241 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package present
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// linkedTrace is the 128-bit trace id the children of runTrace link to.
+var linkedTrace = monkit.TraceId{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14,
+	15, 16}
+
+// runTrace runs a root Task with a failing child Task as a new trace.
+func runTrace(mon *monkit.Scope) {
+	ctx := context.Background()
+	defer mon.TaskNamed("root")(&ctx)(nil)
+	monkit.SpanFromCtx(ctx).Annotate("key", "val")
+	func() {
+		err := errors.New("child failed")
+		ctx := ctx
+		defer mon.TaskNamed("child")(&ctx)(&err)
+		monkit.SpanFromCtx(ctx).AddLink(linkedTrace, 42)
+	}()
+}
+
+func TestTraceWriter(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("test")
+	var buf bytes.Buffer
+	defer r.ObserveTraces(NewTraceWriter(&buf))()
+
+	runTrace(mon)
+	runTrace(mon)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per trace, got %q", buf.String())
+	}
+	for _, line := range lines {
+		var record traceRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		if record.TraceId == 0 || record.Root != "test.root" ||
+			record.Start == 0 || record.Duration <= 0 || record.Running != 0 {
+			t.Fatalf("unexpected record: %q", line)
+		}
+		if len(record.Spans) != 1 || len(record.Spans[0].Children) != 1 {
+			t.Fatalf("expected the child under the root: %q", line)
+		}
+	}
+
+	var traces []*RecordedTrace
+	err := ReadTraces(&buf, func(t *RecordedTrace) { traces = append(traces, t) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 || traces[0].Id() == traces[1].Id() {
+		t.Fatalf("expected two distinct traces, got %d", len(traces))
+	}
+	for _, trace := range traces {
+		spans := trace.Spans()
+		if trace.Root() != "test.root" || len(spans) != 1 {
+			t.Fatalf("unexpected trace: %+v", trace)
+		}
+		root := spans[0]
+		if root.FullName() != "test.root" || root.Err() != "" ||
+			root.Parent() != nil || root.Trace() != trace {
+			t.Fatalf("unexpected root: %+v", root)
+		}
+		if annotations := root.Annotations(); len(annotations) != 1 ||
+			annotations[0].Name != "key" || annotations[0].Value != "val" {
+			t.Fatalf("unexpected annotations: %v", annotations)
+		}
+		children := root.Children()
+		if len(children) != 1 {
+			t.Fatalf("expected one child, got %d", len(children))
+		}
+		child := children[0]
+		if child.ShortName() != "child" || child.Parent() != root ||
+			child.Err() != "child failed" || child.Duration() < 0 {
+			t.Fatalf("unexpected child: %+v", child)
+		}
+		if id, ok := child.ParentId(); !ok || id != root.Id() {
+			t.Fatalf("expected the child's parent id to be the root's")
+		}
+		if code, msg := child.Status(); code != monkit.StatusError ||
+			msg != "child failed" {
+			t.Fatalf("unexpected child status: %v %q", code, msg)
+		}
+		if links := child.Links(); len(links) != 1 ||
+			links[0] != (monkit.Link{TraceId: linkedTrace, SpanId: 42}) {
+			t.Fatalf("unexpected child links: %v", links)
+		}
+	}
+}
+
+func TestReadTracesMalformed(t *testing.T) {
+	var traces int
+	err := ReadTraces(strings.NewReader(`{"trace_id": 1, "spans": []}
+{"trace_id": `), func(*RecordedTrace) { traces++ })
+	if err == nil || traces != 1 {
+		t.Fatalf("expected one trace and an error, got %d and %v", traces, err)
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+func TestTraceWriterOnError(t *testing.T) {
+	r := monkit.NewRegistry()
+	writeErr := errors.New("write failed")
+	var errs []error
+	defer r.ObserveTraces(NewTraceWriterWithOptions(failingWriter{writeErr},
+		TraceWriterOptions{OnError: func(err error) { errs = append(errs, err) }}))()
+
+	runTrace(r.ScopeNamed("test"))
+	if len(errs) != 1 || errs[0] != writeErr {
+		t.Fatalf("expected the write error to be reported, got %v", errs)
+	}
+}
+
+// blockingWriter blocks its first Write until release is closed.
+type blockingWriter struct {
+	once     sync.Once
+	started  chan struct{}
+	release  chan struct{}
+	mtx      sync.Mutex
+	received bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.started)
+		<-w.release
+	})
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.received.Write(p)
+}
+
+func TestTraceWriterDropWhenBusy(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("test")
+	w := &blockingWriter{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	defer r.ObserveTraces(NewTraceWriterWithOptions(w,
+		TraceWriterOptions{DropWhenBusy: true}))()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runTrace(mon)
+	}()
+	<-w.started
+
+	// the writer is busy with the first trace, so this one is dropped
+	// instead of waiting.
+	runTrace(mon)
+	close(w.release)
+	<-done
+
+	var lines int
+	scanner := bufio.NewScanner(&w.received)
+	for scanner.Scan() {
+		lines++
+	}
+	if lines != 1 {
+		t.Fatalf("expected the second trace to be dropped, got %d lines", lines)
+	}
+}
+
+func TestTraceJSON(t *testing.T) {
+	r := monkit.NewRegistry()
+	r.SetRecentTraceCapacity(1)
+	mon := r.ScopeNamed("test")
+
+	ctx := context.Background()
+	finishRoot := mon.TaskNamed("root")(&ctx)
+	trace := monkit.SpanFromCtx(ctx).Trace()
+	func() {
+		ctx := ctx
+		defer mon.TaskNamed("done")(&ctx)(nil)
+	}()
+	runningCtx := ctx
+	finishRunning := mon.TaskNamed("slow")(&runningCtx)
+
+	var buf bytes.Buffer
+	if err := TraceJSON(r.FindTrace(trace.Id()), &buf); err != nil {
+		t.Fatal(err)
+	}
+	var record traceRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	// only the finished child is included, as a root since its parent is
+	// still running.
+	if record.TraceId != trace.Id() || record.Running != 2 ||
+		len(record.Spans) != 1 || record.Spans[0].Func.Name != "done" {
+		t.Fatalf("unexpected record: %s", buf.String())
+	}
+
+	finishRunning(nil)
+	finishRoot(nil)
+	buf.Reset()
+	if err := TraceJSON(r.FindTrace(trace.Id()), &buf); err != nil {
+		t.Fatal(err)
+	}
+	record = traceRecord{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if strings.Contains(buf.String(), `"running"`) || record.Root != "test.root" ||
+		len(record.Spans) != 1 || len(record.Spans[0].Children) != 2 {
+		t.Fatalf("unexpected record for the finished trace: %s", buf.String())
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// OpenMetricsContentType is the content type of the OpenMetrics text format.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// OpenMetricsHTTP makes an http.Handler that serves the Registry's statistics
+// in the OpenMetrics text format.
+func OpenMetricsHTTP(r *monkit.Registry) http.Handler {
+	return openMetricsHandler{Registry: r}
+}
+
+type openMetricsHandler struct {
+	Registry *monkit.Registry
+}
+
+func (h openMetricsHandler) ServeHTTP(w http.ResponseWriter,
+	req *http.Request) {
+	w.Header().Set("Content-Type", OpenMetricsContentType)
+	_ = WriteOpenMetrics(h.Registry, w)
+}
+
+// WriteOpenMetrics writes all of the statistics the Registry knows to w in the
+// OpenMetrics text format, terminated by the required "# EOF" line.
+//
+// Metrics are grouped and named the same way as by Write, with the
+// differences OpenMetrics requires: counter families are named without the
+// _total suffix, which their samples always carry instead, and families of
+// stats with a unit set with monkit.Scope.SetUnit are named with the unit as
+// a suffix and get a UNIT line. The unit applies to all of a stat's fields but
+// count, which counts observations. Help text set with monkit.Scope.Describe
+// is reported as HELP.
+func WriteOpenMetrics(r *monkit.Registry, w io.Writer) error {
+	families := buildFamilies(r)
+	help := make(map[*family]string, len(families))
+	units := make(map[*family]string, len(families))
+	for _, f := range families {
+		var unit string
+		help[f], unit = describe(r, f)
+		if unit != "" && f.field != "count" {
+			units[f] = sanitizeLabel(unit)
+		}
+
+		if f.typ == typeCounter {
+			f.name = strings.TrimSuffix(f.name, "_total")
+			for i := range f.samples {
+				f.samples[i].suffix = "_total"
+			}
+		}
+		if unit := units[f]; unit != "" && unit != "_" &&
+			!strings.HasSuffix(f.name, "_"+unit) {
+			f.name += "_" + unit
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range assignNames(families) {
+		_, _ = fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, openMetricsType(f.typ))
+		if unit := units[f]; unit != "" && strings.HasSuffix(f.name, "_"+unit) {
+			_, _ = fmt.Fprintf(bw, "# UNIT %s %s\n", f.name, unit)
+		}
+		if text := help[f]; text != "" {
+			_, _ = fmt.Fprintf(bw, "# HELP %s %s\n", f.name,
+				escapeLabelValue(text))
+		}
+		for _, s := range f.samples {
+			_, _ = bw.WriteString(f.name)
+			_, _ = bw.WriteString(s.suffix)
+			if s.labels != "" {
+				_, _ = bw.WriteString("{")
+				_, _ = bw.WriteString(s.labels)
+				_, _ = bw.WriteString("}")
+			}
+			_, _ = bw.WriteString(" ")
+			_, _ = bw.WriteString(formatValue(s.val))
+			_, _ = bw.WriteString("\n")
+		}
+	}
+	_, _ = bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// openMetricsType returns the OpenMetrics name of a Prometheus metric type.
+func openMetricsType(typ string) string {
+	if typ == typeUntyped {
+		return "unknown"
+	}
+	return typ
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("my.pkg")
+	mon.Meter("requests.served").Mark(3)
+	mon.SetDescription("requests.served", "Requests served.\nBy \"us\".")
+	mon.Counter("in-flight").Inc(2)
+	mon.DurationVal("latency").Observe(time.Second)
+	mon.Describe("latency", "", "seconds")
+	mon.Histogram("size", []float64{1, 10}).Observe(5)
+	mon.Counter("a.b").Inc(1)
+	mon.Counter("a_b").Inc(1)
+	mon.Func().Task(nil)(nil)
+
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	validateOpenMetrics(t, out)
+
+	for _, expected := range []string{
+		"# TYPE requests_served counter\n" +
+			"# HELP requests_served Requests served.\\nBy \\\"us\\\".\n" +
+			"requests_served_total{scope=\"my.pkg\"} 3\n",
+		"# TYPE latency_seconds summary\n# UNIT latency_seconds seconds\n",
+		"latency_seconds_count{scope=\"my.pkg\"} 1\n",
+		"# TYPE latency_max_seconds gauge\n",
+		"# TYPE size histogram\n",
+		"size_bucket{le=\"+Inf\",scope=\"my.pkg\"} 1\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected %q in output:\n%s", expected, out)
+		}
+	}
+}
+
+// validateOpenMetrics checks the parts of the OpenMetrics text format that
+// WriteOpenMetrics is responsible for.
+func validateOpenMetrics(t *testing.T, out string) {
+	t.Helper()
+	if !strings.HasSuffix(out, "\n# EOF\n") {
+		t.Fatalf("missing EOF:\n%s", out)
+	}
+	suffixes := map[string][]string{
+		"counter":   {"_total"},
+		"gauge":     {""},
+		"unknown":   {""},
+		"summary":   {"", "_sum", "_count"},
+		"histogram": {"_bucket", "_sum", "_count"},
+	}
+	seen := map[string]bool{}
+	var name, typ string
+	var sampled bool
+	lines := strings.Split(strings.TrimSuffix(out, "\n# EOF\n"), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "# TYPE "):
+			name, typ, sampled = fields[2], fields[3], false
+			if seen[name] {
+				t.Fatalf("duplicate family %q", name)
+			}
+			seen[name] = true
+			if _, ok := suffixes[typ]; !ok {
+				t.Fatalf("unknown type in %q", line)
+			}
+		case strings.HasPrefix(line, "# UNIT "), strings.HasPrefix(line, "# HELP "):
+			if fields[2] != name || sampled {
+				t.Fatalf("misplaced metadata %q", line)
+			}
+			if fields[1] == "UNIT" && !strings.HasSuffix(name, "_"+fields[3]) {
+				t.Fatalf("family %q doesn't end with its unit", name)
+			}
+		case strings.HasPrefix(line, "#"):
+			t.Fatalf("unexpected comment %q", line)
+		default:
+			sampled = true
+			sampleName := fields[0]
+			if i := strings.IndexByte(sampleName, '{'); i >= 0 {
+				sampleName = sampleName[:i]
+			}
+			ok := false
+			for _, suffix := range suffixes[typ] {
+				ok = ok || sampleName == name+suffix
+			}
+			if !ok {
+				t.Fatalf("sample %q doesn't belong to %s family %q",
+					line, typ, name)
+			}
+		}
+	}
+}
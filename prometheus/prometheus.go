@@ -0,0 +1,504 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus renders monkit statistics in the Prometheus text
+// exposition format.
+//
+// Every measurement and field pair becomes a metric named
+// measurement_field, with the series tags as labels. Series that look like
+// distributions (they have count, sum, and reservoir quantile fields such as
+// r50 or rmax) are instead rendered as a summary named after the measurement,
+// with a quantile label, and _sum and _count samples. The remaining
+// distribution fields (min, max, avg, etc) are rendered as gauges. Series
+// with "bucket" fields tagged with "le", along with the matching series with
+// "sum" and "count" fields, such as those from a monkit.Histogram, are
+// rendered as a histogram named after the measurement.
+//
+// Names are sanitized by replacing every character Prometheus doesn't allow
+// with an underscore. If two different monkit names sanitize to the same
+// Prometheus name, the name that sorts first keeps the plain sanitized name
+// and the others get a suffix derived from a hash of their original name, so
+// that the mapping is deterministic and never merges distinct series.
+package prometheus // import "github.com/spacemonkeygo/monkit/v3/prometheus"
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeSummary   = "summary"
+	typeHistogram = "histogram"
+	typeUntyped   = "untyped"
+)
+
+// counterFields are the fields monkit emits that only ever increase.
+var counterFields = map[string]bool{
+	"total":             true,
+	"successes":         true,
+	"errors":            true,
+	"panics":            true,
+	"failures":          true,
+	"cancelled":         true,
+	"deadline_exceeded": true,
+	"slo_violations":    true,
+	"slo_total":         true,
+	"true":              true,
+	"false":             true,
+}
+
+// HTTP makes an http.Handler that serves the Registry's statistics in the
+// Prometheus text exposition format.
+func HTTP(r *monkit.Registry) http.Handler {
+	return handler{Registry: r}
+}
+
+type handler struct {
+	Registry *monkit.Registry
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = Write(h.Registry, w)
+}
+
+// Write writes all of the statistics the Registry knows to w in the
+// Prometheus text exposition format.
+func Write(r *monkit.Registry, w io.Writer) error {
+	return WriteStats(r, w)
+}
+
+// WriteStats writes all of the statistics from the given StatSource to w in
+// the Prometheus text exposition format. If src is a
+// monkit.DescribedStatSource, such as a Registry, help text set with
+// monkit.Scope.Describe is reported as HELP.
+func WriteStats(src monkit.StatSource, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range collectFamilies(src) {
+		if help, _ := describe(src, f); help != "" {
+			_, _ = fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(help))
+		}
+		_, _ = fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.samples {
+			_, _ = bw.WriteString(f.name)
+			_, _ = bw.WriteString(s.suffix)
+			if s.labels != "" {
+				_, _ = bw.WriteString("{")
+				_, _ = bw.WriteString(s.labels)
+				_, _ = bw.WriteString("}")
+			}
+			_, _ = bw.WriteString(" ")
+			_, _ = bw.WriteString(formatValue(s.val))
+			_, _ = bw.WriteString("\n")
+		}
+	}
+	return bw.Flush()
+}
+
+type field struct {
+	name string
+	val  float64
+}
+
+type series struct {
+	key    monkit.SeriesKey
+	fields []field
+}
+
+type sample struct {
+	suffix string
+	labels string
+	val    float64
+
+	// histogram samples are sorted by group, the labels without le, and then
+	// by le.
+	group string
+	le    float64
+}
+
+type family struct {
+	raw     string
+	name    string
+	typ     string
+	samples []sample
+
+	// field and keys identify the monkit stats the family came from, with
+	// one key per scope, so that their descriptions can be looked up.
+	field string
+	keys  []monkit.SeriesKey
+}
+
+type quantile struct {
+	q   float64
+	val float64
+}
+
+// collectFamilies gathers the stats from src into sorted metric families.
+func collectFamilies(src monkit.StatSource) []*family {
+	return assignNames(buildFamilies(src))
+}
+
+// buildFamilies gathers the stats from src into metric families keyed by
+// their raw, unsanitized names.
+func buildFamilies(src monkit.StatSource) map[string]*family {
+	var order []string
+	all := map[string]*series{}
+	src.Stats(func(key monkit.SeriesKey, name string, val float64) {
+		id := key.String()
+		s, ok := all[id]
+		if !ok {
+			s = &series{key: key}
+			all[id] = s
+			order = append(order, id)
+		}
+		s.fields = append(s.fields, field{name: name, val: val})
+	})
+
+	sort.Strings(order)
+
+	// histograms holds the series that have histogram buckets, that is,
+	// series that have "bucket" fields when tagged with "le".
+	histograms := map[string]bool{}
+	for _, id := range order {
+		s := all[id]
+		if _, ok := s.key.Tags.All()["le"]; ok && s.hasField("bucket") {
+			histograms[histogramId(s.key)] = true
+		}
+	}
+
+	families := map[string]*family{}
+	var key monkit.SeriesKey
+	add := func(measurement, fieldName, typ string, s sample) {
+		raw := measurement + "\x00" + fieldName
+		f, ok := families[raw]
+		if !ok {
+			name := measurement
+			if fieldName != "" {
+				name += "_" + fieldName
+			}
+			f = &family{raw: raw, name: sanitizeName(name), typ: typ,
+				field: fieldName}
+			families[raw] = f
+		} else if f.typ != typ {
+			f.typ = typeUntyped
+		}
+		if len(f.keys) == 0 || f.keys[len(f.keys)-1].Tags.Get("scope") !=
+			key.Tags.Get("scope") {
+			f.keys = append(f.keys, key)
+		}
+		f.samples = append(f.samples, s)
+	}
+
+	for _, id := range order {
+		s := all[id]
+		measurement := s.key.Measurement
+		labels := formatLabels(s.key.Tags.All(), "")
+		key = s.key
+
+		if histograms[histogramId(s.key)] {
+			tags := s.key.Tags.All()
+			le, isBucket := tags["le"]
+			group := histogramId(s.key)
+			for _, f := range s.fields {
+				switch {
+				case isBucket && f.name == "bucket":
+					bound, err := strconv.ParseFloat(le, 64)
+					if err != nil {
+						bound = math.Inf(1)
+					}
+					add(measurement, "", typeHistogram, sample{suffix: "_bucket",
+						labels: labels, val: f.val, group: group, le: bound})
+				case !isBucket && f.name == "sum":
+					add(measurement, "", typeHistogram, sample{suffix: "_sum",
+						labels: labels, val: f.val, group: group, le: math.Inf(1)})
+				case !isBucket && f.name == "count":
+					add(measurement, "", typeHistogram, sample{suffix: "_count",
+						labels: labels, val: f.val, group: group, le: math.Inf(1)})
+				default:
+					add(measurement, f.name, typeGauge,
+						sample{labels: labels, val: f.val})
+				}
+			}
+			continue
+		}
+
+		var quantiles []quantile
+		var count, sum *float64
+		for i := range s.fields {
+			f := &s.fields[i]
+			if q, ok := parseQuantile(f.name); ok {
+				quantiles = append(quantiles, quantile{q: q, val: f.val})
+			}
+			switch f.name {
+			case "count":
+				count = &f.val
+			case "sum":
+				sum = &f.val
+			}
+		}
+
+		if len(quantiles) == 0 || count == nil || sum == nil {
+			for _, f := range s.fields {
+				typ := typeGauge
+				if counterFields[f.name] || f.name == "count" {
+					typ = typeCounter
+				}
+				add(measurement, f.name, typ,
+					sample{labels: labels, val: f.val})
+			}
+			continue
+		}
+
+		sort.SliceStable(quantiles, func(i, j int) bool {
+			return quantiles[i].q < quantiles[j].q
+		})
+		for _, q := range quantiles {
+			add(measurement, "", typeSummary, sample{
+				labels: formatLabels(s.key.Tags.All(),
+					strconv.FormatFloat(q.q, 'f', -1, 64)),
+				val: q.val})
+		}
+		add(measurement, "", typeSummary,
+			sample{suffix: "_sum", labels: labels, val: *sum})
+		add(measurement, "", typeSummary,
+			sample{suffix: "_count", labels: labels, val: *count})
+		for _, f := range s.fields {
+			if _, ok := parseQuantile(f.name); ok ||
+				f.name == "count" || f.name == "sum" {
+				continue
+			}
+			add(measurement, f.name, typeGauge,
+				sample{labels: labels, val: f.val})
+		}
+	}
+
+	for _, f := range families {
+		if f.typ == typeHistogram {
+			sort.SliceStable(f.samples, func(i, j int) bool {
+				a, b := f.samples[i], f.samples[j]
+				if a.group != b.group {
+					return a.group < b.group
+				}
+				if suffixRank(a.suffix) != suffixRank(b.suffix) {
+					return suffixRank(a.suffix) < suffixRank(b.suffix)
+				}
+				return a.le < b.le
+			})
+		}
+	}
+
+	return families
+}
+
+// describe returns the help text and unit of the first of the family's stats
+// that has them, if src is a monkit.DescribedStatSource.
+func describe(src monkit.StatSource, f *family) (help, unit string) {
+	described, ok := src.(monkit.DescribedStatSource)
+	if !ok {
+		return "", ""
+	}
+	for _, key := range f.keys {
+		h, u := described.StatDescription(key)
+		if help == "" {
+			help = h
+		}
+		if unit == "" {
+			unit = u
+		}
+	}
+	return help, unit
+}
+
+func (s *series) hasField(name string) bool {
+	for _, f := range s.fields {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// histogramId identifies the histogram a series belongs to, which is the
+// series without its le tag.
+func histogramId(key monkit.SeriesKey) string {
+	tags := make(map[string]string, key.Tags.Len())
+	for k, v := range key.Tags.All() {
+		if k != "le" {
+			tags[k] = v
+		}
+	}
+	return key.Measurement + "\x00" + formatLabels(tags, "")
+}
+
+// suffixRank orders histogram samples the way Prometheus lists them.
+func suffixRank(suffix string) int {
+	switch suffix {
+	case "_bucket":
+		return 0
+	case "_sum":
+		return 1
+	}
+	return 2
+}
+
+// assignNames makes sure no two families share a name, and returns the
+// families sorted by name.
+func assignNames(families map[string]*family) []*family {
+	raws := make([]string, 0, len(families))
+	for raw := range families {
+		raws = append(raws, raw)
+	}
+	sort.Strings(raws)
+
+	taken := make(map[string]bool, len(raws))
+	rv := make([]*family, 0, len(raws))
+	for _, raw := range raws {
+		f := families[raw]
+		if taken[f.name] {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(raw))
+			f.name = fmt.Sprintf("%s_%08x", f.name, h.Sum32())
+		}
+		taken[f.name] = true
+		rv = append(rv, f)
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].name < rv[j].name })
+	return rv
+}
+
+// parseQuantile turns reservoir fields such as rmin, r50, r99_9, and rmax
+// into quantiles between 0 and 1. An underscore stands for the decimal point.
+func parseQuantile(name string) (float64, bool) {
+	switch name {
+	case "rmin":
+		return 0, true
+	case "rmax":
+		return 1, true
+	}
+	if len(name) < 2 || name[0] != 'r' || name[1] < '0' || name[1] > '9' {
+		return 0, false
+	}
+	percentile, err := strconv.ParseFloat(
+		strings.Replace(name[1:], "_", ".", 1), 64)
+	if err != nil || percentile < 0 || percentile > 100 {
+		return 0, false
+	}
+	return percentile / 100, true
+}
+
+// sanitizeName replaces all characters that are not valid in a Prometheus
+// metric name with underscores.
+func sanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// sanitizeLabel replaces all characters that are not valid in a Prometheus
+// label name with underscores.
+func sanitizeLabel(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, allowColon bool) string {
+	if name == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' ||
+			(r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') ||
+			(allowColon && r == ':') ||
+			(i > 0 && r >= '0' && r <= '9')
+		if !valid {
+			if i == 0 && r >= '0' && r <= '9' {
+				b.WriteByte('_')
+				b.WriteRune(r)
+				continue
+			}
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// formatLabels renders the tags as sorted, escaped Prometheus labels. If q is
+// not empty, it is added as the quantile label.
+func formatLabels(tags map[string]string, q string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sanitizeLabel(key))
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(tags[key]))
+		b.WriteByte('"')
+	}
+	if q != "" {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`quantile="`)
+		b.WriteString(q)
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(val string) string {
+	return labelValueEscaper.Replace(val)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// escapeHelp escapes help text for the Prometheus text exposition format,
+// which unlike label values and OpenMetrics doesn't escape quotes.
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatValue(val float64) string {
+	switch {
+	case math.IsNaN(val):
+		return "NaN"
+	case math.IsInf(val, 1):
+		return "+Inf"
+	case math.IsInf(val, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spacemonkeygo/monkit/v3"
+)
+
+func TestWrite(t *testing.T) {
+	r := monkit.NewRegistry()
+	mon := r.ScopeNamed("my.pkg")
+	mon.Meter("requests.served").Mark(3)
+	mon.Counter("in-flight").Inc(2)
+	mon.FloatVal("size", monkit.NewSeriesTag("path", `a "quoted" \ path`)).
+		Observe(1)
+	mon.Counter("a.b").Inc(1)
+	mon.Counter("a_b").Inc(1)
+	mon.FloatValWithPercentiles("latency", []float64{99.9}).Observe(2)
+	mon.Describe("in-flight", "Requests\nin \"flight\".", "requests")
+
+	var buf bytes.Buffer
+	if err := Write(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, expected := range []string{
+		"# TYPE requests_served_total counter\n" +
+			"requests_served_total{scope=\"my.pkg\"} 3\n",
+		"# HELP in_flight_value Requests\\nin \"flight\".\n" +
+			"# TYPE in_flight_value gauge\n",
+		"# TYPE size summary\n",
+		`size{path="a \"quoted\" \\ path",scope="my.pkg",quantile="0.5"} 1`,
+		`size_count{path="a \"quoted\" \\ path",scope="my.pkg"} 1`,
+		"# TYPE size_recent gauge\n",
+		"a_b_value{scope=\"my.pkg\"} 1\n",
+		`latency{scope="my.pkg",quantile="0.999`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("expected %q in output:\n%s", expected, out)
+		}
+	}
+
+	// a.b and a_b both sanitize to a_b, so one of them must get a suffix
+	if strings.Count(out, "# TYPE a_b_value") != 2 ||
+		strings.Count(out, "# TYPE a_b_value gauge\n") != 1 {
+		t.Fatalf("expected colliding names to be disambiguated:\n%s", out)
+	}
+
+	var again bytes.Buffer
+	if err := Write(r, &again); err != nil {
+		t.Fatal(err)
+	}
+	if names(again.String()) != names(out) {
+		t.Fatalf("output is not deterministic")
+	}
+}
+
+// names strips the values from the exposition format, since things like
+// meter rates change between calls.
+func names(out string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(out, "\n") {
+		if idx := strings.LastIndexByte(line, ' '); idx >= 0 &&
+			!strings.HasPrefix(line, "#") {
+			line = line[:idx]
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestWriteHistogram(t *testing.T) {
+	r := monkit.NewRegistry()
+	h := r.ScopeNamed("pkg").Histogram("latency", []float64{0.5, 0.1, 2.5})
+	for _, val := range []float64{0.05, 0.3, 0.3, 1, 10} {
+		h.Observe(val)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(r, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# TYPE latency histogram\n" +
+		`latency_bucket{le="0.1",scope="pkg"} 1` + "\n" +
+		`latency_bucket{le="0.5",scope="pkg"} 3` + "\n" +
+		`latency_bucket{le="2.5",scope="pkg"} 4` + "\n" +
+		`latency_bucket{le="+Inf",scope="pkg"} 5` + "\n" +
+		`latency_sum{scope="pkg"} 11.65` + "\n" +
+		`latency_count{scope="pkg"} 5` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ObserveTracesRateLimited is like ObserveTraces, but cb is called for at
+// most perSecond new traces per second, so a traffic spike can't overwhelm an
+// exporter. Bursts of up to perSecond traces are let through at once. Traces
+// that are dropped because of the limit are counted in the dropped_traces
+// Counter of the monkit package Scope. The limit is checked without locking.
+// A perSecond of 0 or less drops all traces. Limits above one trace per
+// nanosecond are treated as one trace per nanosecond.
+func (r *Registry) ObserveTracesRateLimited(perSecond int,
+	cb func(*Trace)) (cancel func()) {
+	l := &traceRateLimiter{
+		r:       r,
+		cb:      cb,
+		dropped: r.ScopeNamed(selfScope).Counter("dropped_traces"),
+	}
+	if perSecond > 0 {
+		l.interval = int64(time.Second) / int64(perSecond)
+		if l.interval <= 0 {
+			l.interval = 1
+		}
+		l.burst = int64(time.Second)
+	}
+	return r.ObserveTraces(l.observe)
+}
+
+// traceRateLimiter is a token bucket implemented with the generic cell rate
+// algorithm, which only needs a single atomically updated timestamp.
+type traceRateLimiter struct {
+	// sync/atomic things
+	tat int64 // theoretical arrival time in UnixNano
+
+	r        *Registry
+	cb       func(*Trace)
+	interval int64
+	burst    int64
+	dropped  *Counter
+}
+
+func (l *traceRateLimiter) observe(t *Trace) {
+	if l.allow(l.r.now().UnixNano()) {
+		l.cb(t)
+		return
+	}
+	l.dropped.Inc(1)
+}
+
+func (l *traceRateLimiter) allow(now int64) bool {
+	if l.interval <= 0 {
+		return false
+	}
+	for {
+		tat := atomic.LoadInt64(&l.tat)
+		next := tat
+		if next < now {
+			next = now
+		}
+		next += l.interval
+		if next-now > l.burst {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&l.tat, tat, next) {
+			return true
+		}
+	}
+}
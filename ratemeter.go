@@ -0,0 +1,140 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3/monotime"
+)
+
+const rateMeterTick = 5 * time.Second
+
+// rateMeterAlphas are the standard load average decay factors for 1, 5, and
+// 15 minute moving averages updated every 5 seconds.
+var rateMeterAlphas = [3]float64{
+	1 - math.Exp(-5.0/60.0/1),
+	1 - math.Exp(-5.0/60.0/5),
+	1 - math.Exp(-5.0/60.0/15),
+}
+
+// RateMeter keeps track of events and their 1, 5, and 15 minute exponentially
+// weighted moving average rates per second, like load averages.
+// Implements the StatSource interface. You should construct using
+// NewRateMeter, though expected usage is like:
+//
+//   var (
+//     mon      = monkit.Package()
+//     requests = mon.RateMeter("requests")
+//   )
+//
+//   func MyFunc() {
+//     ...
+//     requests.Mark(1)
+//     ...
+//   }
+//
+type RateMeter struct {
+	// sync/atomic things
+	total   int64
+	pending int64
+
+	scopeGate
+	mtx         sync.Mutex
+	rates       [3]float64
+	initialized bool
+	lastTick    time.Time
+	key         SeriesKey
+}
+
+// NewRateMeter constructs a RateMeter
+func NewRateMeter(key SeriesKey) *RateMeter {
+	return &RateMeter{key: key, lastTick: monotime.Now()}
+}
+
+// Mark marks amount events occurring. Mark is lock-free; the moving
+// averages are brought up to date lazily when they are read.
+func (m *RateMeter) Mark(amount int) {
+	m.Mark64(int64(amount))
+}
+
+// Mark64 marks amount events occurring (int64 version).
+func (m *RateMeter) Mark64(amount int64) {
+	if m.off() {
+		return
+	}
+	atomic.AddInt64(&m.total, amount)
+	atomic.AddInt64(&m.pending, amount)
+}
+
+// Reset resets all internal state.
+func (m *RateMeter) Reset() {
+	m.mtx.Lock()
+	atomic.StoreInt64(&m.total, 0)
+	atomic.StoreInt64(&m.pending, 0)
+	m.rates = [3]float64{}
+	m.initialized = false
+	m.lastTick = monotime.Now()
+	m.mtx.Unlock()
+}
+
+// tick decays the moving averages for every full tick interval that has
+// passed since the last one. m.mtx must be held.
+func (m *RateMeter) tick(now time.Time) {
+	ticks := int64(now.Sub(m.lastTick) / rateMeterTick)
+	if ticks <= 0 {
+		return
+	}
+	m.lastTick = m.lastTick.Add(time.Duration(ticks) * rateMeterTick)
+
+	instant := float64(atomic.SwapInt64(&m.pending, 0)) /
+		rateMeterTick.Seconds()
+	for i, alpha := range rateMeterAlphas {
+		if m.initialized {
+			m.rates[i] += alpha * (instant - m.rates[i])
+		} else {
+			m.rates[i] = instant
+		}
+		// the remaining ticks had no events, so the rate only decays.
+		m.rates[i] *= math.Pow(1-alpha, float64(ticks-1))
+	}
+	m.initialized = true
+}
+
+// Rates returns the 1, 5, and 15 minute moving average rates per second.
+func (m *RateMeter) Rates() (rate1, rate5, rate15 float64) {
+	m.mtx.Lock()
+	m.tick(monotime.Now())
+	rates := m.rates
+	m.mtx.Unlock()
+	return rates[0], rates[1], rates[2]
+}
+
+// Total returns the total number of events marked.
+func (m *RateMeter) Total() int64 {
+	return atomic.LoadInt64(&m.total)
+}
+
+// Stats implements the StatSource interface
+func (m *RateMeter) Stats(cb func(key SeriesKey, field string, val float64)) {
+	rate1, rate5, rate15 := m.Rates()
+	cb(m.key, "rate1", rate1)
+	cb(m.key, "rate5", rate5)
+	cb(m.key, "rate15", rate15)
+	cb(m.key, "total", float64(m.Total()))
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateMeter(t *testing.T) {
+	m := NewRegistry().ScopeNamed("test").RateMeter("requests")
+	start := m.lastTick
+
+	m.Mark(50)
+	m.mtx.Lock()
+	m.tick(start.Add(rateMeterTick))
+	m.mtx.Unlock()
+	for i, rate := range m.rates {
+		if rate != 10 {
+			t.Fatalf("expected initial rate %d of 10, got %v", i, rate)
+		}
+	}
+
+	// a minute without events decays the 1 minute rate by 1/e.
+	m.mtx.Lock()
+	m.tick(start.Add(rateMeterTick + time.Minute))
+	m.mtx.Unlock()
+	if got, want := m.rates[0], 10/math.E; math.Abs(got-want) > 1e-9 {
+		t.Fatalf("expected rate1 of %v, got %v", want, got)
+	}
+	if m.rates[0] >= m.rates[1] || m.rates[1] >= m.rates[2] {
+		t.Fatalf("expected longer windows to decay slower: %v", m.rates)
+	}
+
+	if m.Total() != 50 {
+		t.Fatalf("expected total of 50, got %d", m.Total())
+	}
+}
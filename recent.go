@@ -0,0 +1,162 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sync/atomic"
+)
+
+// SetRecentTraceCapacity configures how many fully completed traces the
+// Registry keeps around for inspection with RecentTraces. The default of 0
+// disables keeping recent traces entirely, which also means finished spans are
+// not retained. Shrinking the capacity keeps the most recent traces.
+func (r *Registry) SetRecentTraceCapacity(n int) {
+	if n < 0 {
+		n = 0
+	}
+	r.recentMtx.Lock()
+	defer r.recentMtx.Unlock()
+
+	recent := make([]*Trace, n)
+	count := r.recentLen
+	if count > n {
+		count = n
+	}
+	for i := 0; i < count; i++ {
+		recent[count-1-i] = r.recentAt(i)
+	}
+	r.recent = recent
+	r.recentLen = count
+	r.recentNext = 0
+	if n > 0 {
+		r.recentNext = count % n
+	}
+	r.rebuildIndex()
+	atomic.StoreInt64(&r.recentCapacity, int64(n))
+}
+
+// defaultTraceSpanLimit is the trace span limit of new Registries. See
+// SetTraceSpanLimit.
+const defaultTraceSpanLimit = 10000
+
+// SetTraceSpanLimit limits how many finished Spans are kept for each trace,
+// both for recent traces (see Trace.FinishedSpans) and for observers of
+// finished traces (see ObserveFinishedTraces). Otherwise a long-lived root
+// Span, such as that of a server loop, keeps every Span started under it for
+// as long as it runs. Spans past the limit still run and are monitored as
+// usual, but are dropped from the trace and counted in the
+// trace_spans_dropped counter of the monkit Scope. n <= 0 restores the
+// default of 10000.
+func (r *Registry) SetTraceSpanLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&r.spanLimit, int64(n))
+}
+
+// traceSpanLimit returns the limit set with SetTraceSpanLimit.
+func (r *Registry) traceSpanLimit() int {
+	if n := atomic.LoadInt64(&r.spanLimit); n > 0 {
+		return int(n)
+	}
+	return defaultTraceSpanLimit
+}
+
+// spanDropped counts a finished Span that was dropped from a trace. See
+// SetTraceSpanLimit.
+func (r *Registry) spanDropped() {
+	r.ScopeNamed(selfScope).Counter("trace_spans_dropped").Inc(1)
+}
+
+// RecentTraceCapacity returns how many completed traces the Registry keeps.
+// See SetRecentTraceCapacity.
+func (r *Registry) RecentTraceCapacity() int {
+	return int(atomic.LoadInt64(&r.recentCapacity))
+}
+
+// RecentTraces calls cb with up to n of the most recently completed traces,
+// most recent first. If n <= 0, all kept traces are returned. A trace is
+// completed once all of its spans have finished. See Trace.FinishedSpans for
+// the spans that made up the trace.
+func (r *Registry) RecentTraces(n int, cb func(t *Trace)) {
+	r.recentMtx.Lock()
+	count := r.recentLen
+	if n > 0 && n < count {
+		count = n
+	}
+	traces := make([]*Trace, 0, count)
+	for i := 0; i < count; i++ {
+		traces = append(traces, r.recentAt(i))
+	}
+	r.recentMtx.Unlock()
+	for _, t := range traces {
+		cb(t)
+	}
+}
+
+// FindTrace returns the Trace with the given id, or nil if there is none.
+// Traces with live Spans are looked up first, followed by the recently
+// completed traces the Registry keeps. See SetRecentTraceCapacity.
+func (r *Registry) FindTrace(id int64) *Trace {
+	var found *Trace
+	r.RootSpans(func(s *Span) {
+		if found == nil && s.Trace().Id() == id {
+			found = s.Trace()
+		}
+	})
+	if found != nil {
+		return found
+	}
+	r.recentMtx.Lock()
+	defer r.recentMtx.Unlock()
+	for i := 0; i < r.recentLen; i++ {
+		if t := r.recentAt(i); t.Id() == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// recentAt returns the i'th most recent trace. recentMtx must be held.
+func (r *Registry) recentAt(i int) *Trace {
+	idx := r.recentNext - 1 - i
+	if idx < 0 {
+		idx += len(r.recent)
+	}
+	return r.recent[idx]
+}
+
+func (r *Registry) recordingTraces() bool {
+	return atomic.LoadInt64(&r.recentCapacity) > 0
+}
+
+func (r *Registry) traceFinished(t *Trace) {
+	if !t.hasFinished() {
+		return
+	}
+	r.recentMtx.Lock()
+	if len(r.recent) > 0 {
+		if r.recentLen == len(r.recent) {
+			r.unindexTrace(r.recentNext)
+		}
+		r.recent[r.recentNext] = t
+		r.indexTrace(r.recentNext)
+		r.recentNext = (r.recentNext + 1) % len(r.recent)
+		if r.recentLen < len(r.recent) {
+			r.recentLen++
+		}
+	}
+	r.recentMtx.Unlock()
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecentTraces(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	run := func() {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		func(ctx context.Context) {
+			defer mon.Task()(&ctx)(nil)
+		}(ctx)
+	}
+
+	run()
+	count := 0
+	r.RecentTraces(0, func(*Trace) { count++ })
+	if count != 0 {
+		t.Fatalf("expected no traces while disabled, got %d", count)
+	}
+
+	r.SetRecentTraceCapacity(2)
+	for i := 0; i < 3; i++ {
+		run()
+	}
+
+	var traces []*Trace
+	r.RecentTraces(0, func(t *Trace) { traces = append(traces, t) })
+	if len(traces) != 2 {
+		t.Fatalf("expected 2 traces, got %d", len(traces))
+	}
+	for _, trace := range traces {
+		var spans []*Span
+		trace.FinishedSpans(func(s *Span) { spans = append(spans, s) })
+		if len(spans) != 2 {
+			t.Fatalf("expected 2 spans, got %d", len(spans))
+		}
+		if spans[0].Parent() != nil || spans[1].Parent() != spans[0] {
+			t.Fatalf("unexpected span tree")
+		}
+		if _, ok := spans[1].FinishTime(); !ok {
+			t.Fatalf("expected span to be finished")
+		}
+	}
+
+	r.SetRecentTraceCapacity(1)
+	var shrunk []*Trace
+	r.RecentTraces(5, func(t *Trace) { shrunk = append(shrunk, t) })
+	if len(shrunk) != 1 || shrunk[0] != traces[0] {
+		t.Fatalf("expected most recent trace to be kept")
+	}
+}
+
+func TestFindTrace(t *testing.T) {
+	r := NewRegistry()
+	r.SetRecentTraceCapacity(1)
+	mon := r.ScopeNamed("test")
+
+	ctx := context.Background()
+	done := mon.Task()(&ctx)
+	live := SpanFromCtx(ctx).Trace()
+	if r.FindTrace(live.Id()) != live {
+		t.Fatalf("expected to find the live trace")
+	}
+	done(nil)
+	if r.FindTrace(live.Id()) != live {
+		t.Fatalf("expected to find the recent trace")
+	}
+
+	other := context.Background()
+	mon.Task()(&other)(nil)
+	if r.FindTrace(live.Id()) != nil {
+		t.Fatalf("expected the evicted trace not to be found")
+	}
+}
+
+func TestFindTracesByAnnotation(t *testing.T) {
+	r := NewRegistry()
+	r.SetRecentTraceCapacity(3)
+	mon := r.ScopeNamed("test")
+
+	run := func(tenant string) *Trace {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		func(ctx context.Context) {
+			defer mon.Task()(&ctx)(nil)
+			SpanFromCtx(ctx).Annotate("tenant", tenant)
+			SpanFromCtx(ctx).Annotate("user", tenant)
+		}(ctx)
+		return SpanFromCtx(ctx).Trace()
+	}
+
+	first := run("acme")
+	if traces := r.FindTracesByAnnotation("tenant", "acme"); traces != nil {
+		t.Fatalf("expected no results before indexing, got %d", len(traces))
+	}
+
+	// already kept traces are indexed right away
+	r.IndexAnnotation("tenant")
+	second := run("other")
+	third := run("acme")
+	traces := r.FindTracesByAnnotation("tenant", "acme")
+	if len(traces) != 2 || traces[0] != third || traces[1] != first {
+		t.Fatalf("unexpected traces: %v", traces)
+	}
+	if traces := r.FindTracesByAnnotation("tenant", "other"); len(traces) != 1 ||
+		traces[0] != second {
+		t.Fatalf("unexpected traces: %v", traces)
+	}
+	if traces := r.FindTracesByAnnotation("user", "acme"); traces != nil {
+		t.Fatalf("expected unindexed annotations not to be found")
+	}
+
+	// evicted traces are dropped from the index
+	run("new")
+	traces = r.FindTracesByAnnotation("tenant", "acme")
+	if len(traces) != 1 || traces[0] != third {
+		t.Fatalf("expected the evicted trace to be gone: %v", traces)
+	}
+	r.SetRecentTraceCapacity(1)
+	if traces := r.FindTracesByAnnotation("tenant", "acme"); traces != nil {
+		t.Fatalf("expected the index to shrink with the capacity: %v", traces)
+	}
+	if traces := r.FindTracesByAnnotation("tenant", "new"); len(traces) != 1 {
+		t.Fatalf("expected the most recent trace to stay indexed")
+	}
+}
+
+func TestTraceSpanLimit(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	r.SetTraceSpanLimit(3)
+
+	dropped := func() float64 {
+		return Collect(r.ScopeNamed(selfScope))["trace_spans_dropped,scope="+selfScope+" value"]
+	}
+	// a long-lived root with more children than the limit
+	run := func() {
+		ctx := context.Background()
+		defer mon.TaskNamed("root")(&ctx)(nil)
+		for i := 0; i < 5; i++ {
+			func(ctx context.Context) {
+				defer mon.TaskNamed("child")(&ctx)(nil)
+			}(ctx)
+		}
+	}
+
+	r.SetRecentTraceCapacity(1)
+	run()
+	var trace *Trace
+	r.RecentTraces(1, func(t *Trace) { trace = t })
+	kept := 0
+	trace.FinishedSpans(func(*Span) { kept++ })
+	if kept != 3 || trace.DroppedSpans() != 3 || dropped() != 3 {
+		t.Fatalf("expected 3 kept and 3 dropped spans, got %d, %d and %v",
+			kept, trace.DroppedSpans(), dropped())
+	}
+
+	r.SetRecentTraceCapacity(0)
+	var observed []*FinishedSpan
+	cancel := r.ObserveFinishedTraces(func(t *Trace, spans []*FinishedSpan) {
+		observed = spans
+	})
+	defer cancel()
+	run()
+	if len(observed) != 3 || dropped() != 6 {
+		t.Fatalf("expected 3 observed spans and 6 dropped, got %d and %v",
+			len(observed), dropped())
+	}
+}
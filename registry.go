@@ -15,21 +15,58 @@
 package monkit
 
 import (
+	"log"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spacemonkeygo/monkit/v3/monotime"
 )
 
 type traceWatcherRef struct {
 	watcher func(*Trace)
 }
 
+type clockRef struct {
+	now func() time.Time
+}
+
+type samplerRef struct {
+	sampler func(*Trace) bool
+}
+
+type nameFormatterRef struct {
+	format func(pkg, fn string) string
+}
+
+type panicHandlerRef struct {
+	handler func(interface{})
+}
+
+type traceWatcherEntry struct {
+	cb          func(*Trace)
+	sampledOnly bool
+}
+
 type registryInternal struct {
 	// sync/atomic things
-	traceWatcher *traceWatcherRef
+	traceWatcher     *traceWatcherRef
+	sampler          *samplerRef
+	clock            *clockRef
+	panicHandler     *panicHandlerRef
+	nameFormatter    *nameFormatterRef
+	annotationBudget *annotationBudgetRef
+	idGenerator      *idGeneratorRef
+	recentCapacity   int64
+	spanLimit        int64
+	maxDepth         int32
+
+	noop bool // see NewNoopRegistry
 
 	watcherMtx     sync.Mutex
 	watcherCounter int64
-	traceWatchers  map[int64]func(*Trace)
+	traceWatchers  map[int64]traceWatcherEntry
 
 	scopeMtx sync.Mutex
 	scopes   map[string]*Scope
@@ -37,10 +74,25 @@ type registryInternal struct {
 	spanMtx sync.Mutex
 	spans   map[*Span]struct{}
 
-	orphanMtx sync.Mutex
-	orphans   map[*Span]struct{}
+	orphanMtx      sync.Mutex
+	orphans        map[*Span]time.Time
+	orphanMaxAge   time.Duration
+	lastOrphanReap time.Time
+	leakedOrphans  *Counter
+
+	recentMtx  sync.Mutex
+	recent     []*Trace
+	recentNext int
+	recentLen  int
+	recentKeys [][]indexKey          // index keys of each recent trace
+	indexed    map[string]bool       // see IndexAnnotation
+	index      map[indexKey][]*Trace // oldest first
 }
 
+// selfScope is the name of the Scope that holds stats about monkit itself,
+// such as leaked_orphans and dropped_traces.
+const selfScope = "github.com/spacemonkeygo/monkit/v3"
+
 // Registry encapsulates all of the top-level state for a monitoring system.
 // In general, only the Default registry is ever used.
 type Registry struct {
@@ -58,10 +110,10 @@ type Registry struct {
 func NewRegistry() *Registry {
 	return &Registry{
 		registryInternal: &registryInternal{
-			traceWatchers: map[int64]func(*Trace){},
+			traceWatchers: map[int64]traceWatcherEntry{},
 			scopes:        map[string]*Scope{},
 			spans:         map[*Span]struct{}{},
-			orphans:       map[*Span]struct{}{}}}
+			orphans:       map[*Span]time.Time{}}}
 }
 
 // WithTransformers returns a copy of Registry but with the additional
@@ -98,27 +150,182 @@ func (r *Registry) ScopeNamed(name string) *Scope {
 
 func (r *Registry) observeTrace(t *Trace) {
 	watcher := loadTraceWatcherRef(&r.traceWatcher)
-	if watcher != nil {
-		watcher.watcher(t)
+	if watcher == nil {
+		return
+	}
+	if sampler := loadSamplerRef(&r.sampler); sampler != nil {
+		sampled, decided := t.Get(SampledKey).(bool)
+		if t.Priority() > 0 {
+			sampled = true
+		} else if !decided {
+			sampled = sampler.sampler(t)
+			t.Set(SampledKey, sampled)
+		}
+		if !sampled {
+			return
+		}
+	}
+	watcher.watcher(t)
+}
+
+// SetClock replaces the clock the Registry uses to time Spans, which is
+// mostly useful for deterministic tests. Passing nil restores the default
+// monotonic clock.
+func (r *Registry) SetClock(now func() time.Time) {
+	if now == nil {
+		storeClockRef(&r.clock, nil)
+		return
+	}
+	storeClockRef(&r.clock, &clockRef{now: now})
+}
+
+func (r *registryInternal) now() time.Time {
+	if clock := loadClockRef(&r.clock); clock != nil {
+		return clock.now()
+	}
+	return monotime.Now()
+}
+
+// wallNow returns the current wall-clock time, without a monotonic clock
+// reading, or the time of the clock set with SetClock, if any.
+func (r *registryInternal) wallNow() time.Time {
+	if clock := loadClockRef(&r.clock); clock != nil {
+		return clock.now()
+	}
+	return time.Now().Round(0)
+}
+
+// SetNameFormatter replaces how the full names of Funcs, as returned by
+// Func.FullName, are derived from the name of their Scope, usually the full
+// package path, and their function name, such as "(*Server).Handle". The
+// default joins the two with a dot. For instance, to name Funcs after just
+// the function and its receiver type:
+//
+//   r.SetNameFormatter(func(pkg, fn string) string { return fn })
+//
+// The full name of a Func is computed once, when it is created, so a Func
+// keeps its name when the formatter changes, and only Funcs created
+// afterwards use the new one. Set the formatter before instrumented code
+// runs. Passing nil restores the default.
+func (r *Registry) SetNameFormatter(format func(pkg, fn string) string) {
+	if format == nil {
+		storeNameFormatterRef(&r.nameFormatter, nil)
+		return
 	}
+	storeNameFormatterRef(&r.nameFormatter, &nameFormatterRef{format: format})
+}
+
+// formatName returns the full name of a new Func. See SetNameFormatter.
+func (r *registryInternal) formatName(pkg, fn string) string {
+	if formatter := loadNameFormatterRef(&r.nameFormatter); formatter != nil {
+		return formatter.format(pkg, fn)
+	}
+	return pkg + "." + fn
+}
+
+// SetMaxTraceDepth limits how deeply Spans nest within a trace, where root
+// Spans have a depth of 1. Recursive or deeply nested monitored calls can
+// otherwise build span trees too deep for presenters to make sense of. A new
+// Span that would be deeper than n still records timing as usual, but it is
+// attached to its deepest ancestor within the limit instead of its actual
+// parent, and annotated with depth.overflow set to the depth it would have
+// had. Children of root Spans are always kept at depth 2. The default of 0
+// doesn't limit the depth.
+func (r *Registry) SetMaxTraceDepth(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&r.maxDepth, int32(n))
+}
+
+func (r *registryInternal) maxTraceDepth() int32 {
+	return atomic.LoadInt32(&r.maxDepth)
+}
+
+// SetSampler sets a func that decides which new traces are handed to the
+// trace watchers registered with ObserveTraces and friends. Traces for which
+// sampler returns false are not observed at all. The sampler is only called
+// when there is at least one watcher, and may be swapped at any time; passing
+// nil observes all traces again, which is the default.
+//
+// A decision that a trace already carries under SampledKey takes precedence
+// over the sampler: such traces are observed if and only if they are
+// sampled, and the sampler is not called for them. Traces get a decision
+// when it arrives with a remote request, or when they are started with
+// Func.RemoteTrace or Func.ResetTrace from within a trace that has one.
+// Otherwise the sampler decides, and its decision is stored under SampledKey
+// so that it propagates to downstream services. Traces with a priority above
+// zero are always observed and never passed to the sampler; see
+// Trace.SetPriority for the full order of precedence.
+func (r *Registry) SetSampler(sampler func(t *Trace) bool) {
+	if sampler == nil {
+		storeSamplerRef(&r.sampler, nil)
+		return
+	}
+	storeSamplerRef(&r.sampler, &samplerRef{sampler: sampler})
+}
+
+// SetWatcherPanicHandler sets a func that is called with the recovered value
+// whenever a trace watcher registered with ObserveTraces and friends panics.
+// A panicking watcher never propagates the panic into the code that started
+// the trace, and the remaining watchers are still called. Passing nil
+// restores the default, which logs the panic with the standard log package.
+func (r *Registry) SetWatcherPanicHandler(handler func(recovered interface{})) {
+	if handler == nil {
+		storePanicHandlerRef(&r.panicHandler, nil)
+		return
+	}
+	storePanicHandlerRef(&r.panicHandler, &panicHandlerRef{handler: handler})
+}
+
+// callWatcher calls cb with t, recovering from and reporting any panic.
+func (r *registryInternal) callWatcher(cb func(*Trace), t *Trace) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			if h := loadPanicHandlerRef(&r.panicHandler); h != nil {
+				h.handler(rec)
+				return
+			}
+			log.Printf("monkit: trace watcher panicked: %v", rec)
+		}
+	}()
+	cb(t)
 }
 
 func (r *Registry) updateWatcher() {
 	cbs := make([]func(*Trace), 0, len(r.traceWatchers))
-	for _, cb := range r.traceWatchers {
-		cbs = append(cbs, cb)
+	var sampledCbs []func(*Trace)
+	for _, entry := range r.traceWatchers {
+		if entry.sampledOnly {
+			sampledCbs = append(sampledCbs, entry.cb)
+		} else {
+			cbs = append(cbs, entry.cb)
+		}
+	}
+	if len(sampledCbs) > 0 {
+		cbs = append(cbs, func(t *Trace) {
+			if !t.sampled() {
+				return
+			}
+			for _, cb := range sampledCbs {
+				r.callWatcher(cb, t)
+			}
+		})
 	}
 	switch len(cbs) {
 	case 0:
 		storeTraceWatcherRef(&r.traceWatcher, nil)
 	case 1:
+		cb := cbs[0]
 		storeTraceWatcherRef(&r.traceWatcher,
-			&traceWatcherRef{watcher: cbs[0]})
+			&traceWatcherRef{watcher: func(t *Trace) {
+				r.callWatcher(cb, t)
+			}})
 	default:
 		storeTraceWatcherRef(&r.traceWatcher,
 			&traceWatcherRef{watcher: func(t *Trace) {
 				for _, cb := range cbs {
-					cb(t)
+					r.callWatcher(cb, t)
 				}
 			}})
 	}
@@ -130,6 +337,30 @@ func (r *Registry) updateWatcher() {
 // Note: this only applies to all new traces. If you want to find existing
 // or running traces, please pull them off of live RootSpans.
 func (r *Registry) ObserveTraces(cb func(*Trace)) (cancel func()) {
+	return r.addWatcher(traceWatcherEntry{cb: cb})
+}
+
+// ObserveTracesSampled is like ObserveTraces, but cb is only called for new
+// traces that are sampled, that is, traces with SampledKey set to true by the
+// time they start. Whether a trace is sampled is checked once per trace no
+// matter how many sampled watchers are registered, and not at all if there
+// are none.
+func (r *Registry) ObserveTracesSampled(cb func(*Trace)) (cancel func()) {
+	return r.addWatcher(traceWatcherEntry{cb: cb, sampledOnly: true})
+}
+
+// ObserveAllSpans lets you observe every Span, not just root Spans, of all
+// new traces flowing through the system, until the returned cancel method is
+// called. observer.Start is called once a Span has been linked into its
+// parent or the registry, so the Span is already visible to AllSpans.
+// Like ObserveTraces, this only applies to traces that start after
+// ObserveAllSpans is called, and traces rejected by the Registry's sampler
+// are not observed. See SetSampler.
+func (r *Registry) ObserveAllSpans(observer SpanObserver) (cancel func()) {
+	return r.observeFinishedTraces(observer, nil, false)
+}
+
+func (r *Registry) addWatcher(entry traceWatcherEntry) (cancel func()) {
 	// even though observeTrace doesn't get a mutex, it's only ever loading
 	// the traceWatcher pointer, so we can use this mutex here to safely
 	// coordinate the setting of the traceWatcher pointer.
@@ -138,7 +369,7 @@ func (r *Registry) ObserveTraces(cb func(*Trace)) (cancel func()) {
 
 	cbId := r.watcherCounter
 	r.watcherCounter += 1
-	r.traceWatchers[cbId] = cb
+	r.traceWatchers[cbId] = entry
 	r.updateWatcher()
 
 	return func() {
@@ -161,10 +392,11 @@ func (r *Registry) rootSpanEnd(s *Span) {
 	r.spanMtx.Unlock()
 }
 
-func (r *Registry) orphanedSpan(s *Span) {
-	r.orphanMtx.Lock()
-	r.orphans[s] = struct{}{}
-	r.orphanMtx.Unlock()
+// orphanedSpanLocked lists s with the root Spans. r.orphanMtx must be held.
+func (r *Registry) orphanedSpanLocked(s *Span) {
+	now := r.now()
+	r.maybeReapOrphansLocked(now)
+	r.orphans[s] = now
 }
 
 func (r *Registry) orphanEnd(s *Span) {
@@ -176,54 +408,95 @@ func (r *Registry) orphanEnd(s *Span) {
 // RootSpans will call 'cb' on all currently executing Spans with no live or
 // reachable parent. See also AllSpans.
 func (r *Registry) RootSpans(cb func(s *Span)) {
+	for _, s := range r.rootSpanList() {
+		cb(s)
+	}
+}
+
+// rootSpanList returns a sorted snapshot of the Registry's root Spans.
+func (r *Registry) rootSpanList() []*Span {
 	r.spanMtx.Lock()
-	spans := make([]*Span, 0, len(r.spans))
+	r.orphanMtx.Lock()
+	defer r.spanMtx.Unlock()
+	defer r.orphanMtx.Unlock()
+	return r.rootSpanListLocked()
+}
+
+// rootSpanListLocked is like rootSpanList. r.spanMtx and r.orphanMtx must be
+// held.
+func (r *Registry) rootSpanListLocked() []*Span {
+	r.reapOrphansLocked(r.now())
+	spans := make([]*Span, 0, len(r.spans)+len(r.orphans))
 	for s := range r.spans {
 		spans = append(spans, s)
 	}
-	r.spanMtx.Unlock()
-	r.orphanMtx.Lock()
-	orphans := make([]*Span, 0, len(r.orphans))
 	for s := range r.orphans {
-		orphans = append(orphans, s)
+		spans = append(spans, s)
 	}
-	r.orphanMtx.Unlock()
-	spans = append(spans, orphans...)
 	sort.Sort(spanSorter(spans))
-	for _, s := range spans {
-		cb(s)
-	}
+	return spans
 }
 
+// walkSpan calls cb on s and all of its descendants, depth first, with an
+// explicit stack so deep span trees can't overflow the goroutine stack.
 func walkSpan(s *Span, cb func(s *Span)) {
-	cb(s)
-	s.Children(func(s *Span) {
-		walkSpan(s, cb)
-	})
+	stack := []*Span{s}
+	var children []*Span
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		cb(s)
+		children = children[:0]
+		s.Children(func(child *Span) { children = append(children, child) })
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, children[i])
+		}
+	}
 }
 
-// AllSpans calls 'cb' on all currently known Spans. See also RootSpans.
+// AllSpans calls 'cb' on all currently known Spans. Children that a Span
+// doesn't keep track of because of Func.SetMaxChildren are skipped. See also
+// RootSpans.
 func (r *Registry) AllSpans(cb func(s *Span)) {
 	r.RootSpans(func(s *Span) { walkSpan(s, cb) })
 }
 
 // Scopes calls 'cb' on all currently known Scopes.
 func (r *Registry) Scopes(cb func(s *Scope)) {
+	for _, s := range r.scopeList() {
+		cb(s)
+	}
+}
+
+// scopeList returns a sorted snapshot of the Registry's Scopes.
+func (r *Registry) scopeList() []*Scope {
 	r.scopeMtx.Lock()
+	defer r.scopeMtx.Unlock()
+	return r.scopeListLocked()
+}
+
+// scopeListLocked is like scopeList. r.scopeMtx must be held.
+func (r *Registry) scopeListLocked() []*Scope {
 	c := make([]*Scope, 0, len(r.scopes))
 	for _, s := range r.scopes {
 		c = append(c, s)
 	}
-	r.scopeMtx.Unlock()
 	sort.Sort(scopeSorter(c))
-	for _, s := range c {
-		cb(s)
-	}
+	return c
+}
+
+// Reset zeroes the stats of every Scope in the Registry. See Scope.Reset.
+func (r *Registry) Reset() {
+	r.Scopes(func(s *Scope) { s.reset() })
 }
 
 // Funcs calls 'cb' on all currently known Funcs.
 func (r *Registry) Funcs(cb func(f *Func)) {
-	r.Scopes(func(s *Scope) { s.Funcs(cb) })
+	for _, s := range r.scopeList() {
+		for _, f := range s.funcList() {
+			cb(f)
+		}
+	}
 }
 
 // Stats implements the StatSource interface.
@@ -231,13 +504,75 @@ func (r *Registry) Stats(cb func(key SeriesKey, field string, val float64)) {
 	for _, t := range r.transformers {
 		cb = t.Transform(cb)
 	}
-	r.Scopes(func(s *Scope) { s.Stats(cb) })
+	r.Scopes(func(s *Scope) { s.ownStats(cb) })
 }
 
-var _ StatSource = (*Registry)(nil)
+// StatsWithSpans is like Stats, but also reports stats about each Func's
+// live Spans, so that a backend that only scrapes stats can see concurrency
+// and stuck calls: live is the number of the Func's Spans currently running,
+// and live_oldest_seconds is how long the oldest of them has been running,
+// which is only reported while there is one. Both are reported under the
+// Func's series key, after the stats of its Scope. Live Spans are found by
+// walking AllSpans once per call, so Spans that AllSpans can't reach, such
+// as those dropped because their parent had too many children, are not
+// counted, and live can be lower than the Func's current field.
+func (r *Registry) StatsWithSpans(cb func(key SeriesKey, field string, val float64)) {
+	for _, t := range r.transformers {
+		cb = t.Transform(cb)
+	}
+
+	type liveSpans struct {
+		count  int64
+		oldest time.Time
+	}
+	live := map[*Func]*liveSpans{}
+	now := r.now()
+	r.AllSpans(func(s *Span) {
+		l := live[s.f]
+		if l == nil {
+			l = &liveSpans{oldest: s.start}
+			live[s.f] = l
+		}
+		l.count++
+		if s.start.Before(l.oldest) {
+			l.oldest = s.start
+		}
+	})
+
+	r.Scopes(func(s *Scope) {
+		if !s.Enabled() {
+			return
+		}
+		s.ownStats(cb)
+		for _, f := range s.funcList() {
+			key := f.key.WithTag("scope", s.name)
+			l := live[f]
+			if l == nil {
+				cb(key, "live", 0)
+				continue
+			}
+			cb(key, "live", float64(l.count))
+			cb(key, "live_oldest_seconds", now.Sub(l.oldest).Seconds())
+		}
+	})
+}
+
+// StatDescription implements the DescribedStatSource interface by asking
+// the Scope named in the key's scope tag. See Scope.Describe.
+func (r *Registry) StatDescription(key SeriesKey) (help, unit string) {
+	r.scopeMtx.Lock()
+	s := r.scopes[key.Tags.Get("scope")]
+	r.scopeMtx.Unlock()
+	if s == nil {
+		return "", ""
+	}
+	return s.StatDescription(key)
+}
+
+var _ DescribedStatSource = (*Registry)(nil)
 
 // Default is the default Registry
-var Default = NewRegistry()
+var Default = newDefaultRegistry()
 
 // ScopeNamed is just a wrapper around Default.ScopeNamed
 func ScopeNamed(name string) *Scope { return Default.ScopeNamed(name) }
@@ -268,8 +603,29 @@ func (s spanSorter) Less(i, j int) bool {
 	return (iname < jname) || (iname == jname && ispan.id < jspan.id)
 }
 
+type spanStartSorter []*Span
+
+func (s spanStartSorter) Len() int      { return len(s) }
+func (s spanStartSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s spanStartSorter) Less(i, j int) bool {
+	ispan, jspan := s[i], s[j]
+	return ispan.start.Before(jspan.start) ||
+		(ispan.start.Equal(jspan.start) && ispan.id < jspan.id)
+}
+
 type scopeSorter []*Scope
 
 func (s scopeSorter) Len() int           { return len(s) }
 func (s scopeSorter) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s scopeSorter) Less(i, j int) bool { return s[i].name < s[j].name }
+
+type funcSorter []*Func
+
+func (f funcSorter) Len() int      { return len(f) }
+func (f funcSorter) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+
+func (f funcSorter) Less(i, j int) bool {
+	iname, jname := f[i].ShortName(), f[j].ShortName()
+	return (iname < jname) || (iname == jname && f[i].id < f[j].id)
+}
@@ -0,0 +1,566 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestObserveTracesSampled(t *testing.T) {
+	r := NewRegistry()
+	f := r.ScopeNamed("test").FuncNamed("remote")
+
+	var all, sampled []*Trace
+	cancelAll := r.ObserveTraces(func(t *Trace) { all = append(all, t) })
+	cancelSampled := r.ObserveTracesSampled(func(t *Trace) {
+		sampled = append(sampled, t)
+	})
+
+	run := func(trace *Trace) {
+		ctx := context.Background()
+		defer f.RemoteTrace(&ctx, 0, trace)(nil)
+	}
+	run(NewTraceSampled(NewId(), 1))
+	run(NewTraceSampled(NewId(), 0))
+	run(NewTrace(NewId()))
+
+	if len(all) != 3 || len(sampled) != 1 || sampled[0] != all[0] {
+		t.Fatalf("unexpected traces observed: %d all, %d sampled",
+			len(all), len(sampled))
+	}
+
+	cancelSampled()
+	run(NewTraceSampled(NewId(), 1))
+	if len(all) != 4 || len(sampled) != 1 {
+		t.Fatalf("expected sampled watcher to be canceled")
+	}
+	cancelAll()
+}
+
+func TestSetSampler(t *testing.T) {
+	r := NewRegistry()
+	f := r.ScopeNamed("test").FuncNamed("remote")
+
+	var observed []*Trace
+	defer r.ObserveTraces(func(t *Trace) { observed = append(observed, t) })()
+
+	keep := NewTrace(2)
+	r.SetSampler(func(t *Trace) bool { return t.Id()%2 == 0 })
+	for _, trace := range []*Trace{NewTrace(1), keep} {
+		ctx := context.Background()
+		f.RemoteTrace(&ctx, 0, trace)(nil)
+	}
+	if len(observed) != 1 || observed[0] != keep {
+		t.Fatalf("expected only the even trace to be observed, got %d", len(observed))
+	}
+
+	r.SetSampler(nil)
+	ctx := context.Background()
+	f.RemoteTrace(&ctx, 0, NewTrace(3))(nil)
+	if len(observed) != 2 {
+		t.Fatalf("expected all traces to be observed without a sampler")
+	}
+}
+
+func TestSamplingInherited(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	var observed []*Trace
+	defer r.ObserveTraces(func(t *Trace) { observed = append(observed, t) })()
+	sampled := func(t *Trace) bool {
+		sampled, _ := t.Get(SampledKey).(bool)
+		return sampled
+	}
+
+	// the sampler only decides for traces without a decision, and records it
+	r.SetSampler(func(*Trace) bool { return false })
+	incoming := NewTraceSampled(1, 1)
+	ctx := context.Background()
+	defer mon.Func().RemoteTrace(&ctx, 0, incoming)(nil)
+	if len(observed) != 1 || observed[0] != incoming {
+		t.Fatalf("expected the sampled remote trace to be observed")
+	}
+
+	// new traces started within it inherit its decision
+	child := ctx
+	defer mon.Func().ResetTrace(&child)(nil)
+	trace := SpanFromCtx(child).Trace()
+	if !sampled(trace) || trace.Get(SampleRateKey) != 1.0 || len(observed) != 2 {
+		t.Fatalf("expected the new trace to inherit the sampling decision")
+	}
+	remote := NewTrace(2)
+	child = ctx
+	defer mon.Func().RemoteTrace(&child, 0, remote)(nil)
+	if !sampled(remote) || len(observed) != 3 {
+		t.Fatalf("expected the remote trace to inherit the sampling decision")
+	}
+
+	// unrelated traces are left to the sampler
+	other := context.Background()
+	defer mon.Func().ResetTrace(&other)(nil)
+	if sampled(SpanFromCtx(other).Trace()) || len(observed) != 3 {
+		t.Fatalf("expected the sampler to reject the unrelated trace")
+	}
+	if decided, ok := SpanFromCtx(other).Trace().Get(SampledKey).(bool); !ok || decided {
+		t.Fatalf("expected the sampler's decision to be recorded")
+	}
+}
+
+func TestTracePriority(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	var observed []*Trace
+	defer r.ObserveTracesSampled(func(t *Trace) { observed = append(observed, t) })()
+	r.SetSampler(func(*Trace) bool {
+		t.Fatal("the sampler should not be called for prioritized traces")
+		return false
+	})
+
+	// priority overrides an inherited decision not to sample
+	incoming := NewTraceSampled(1, 0)
+	incoming.SetPriority(1)
+	ctx := context.Background()
+	defer mon.Func().RemoteTrace(&ctx, 0, incoming)(nil)
+	if len(observed) != 1 || observed[0] != incoming {
+		t.Fatalf("expected the prioritized trace to be observed")
+	}
+
+	// and is inherited by new traces started within it
+	child := ctx
+	defer mon.Func().ResetTrace(&child)(nil)
+	if trace := SpanFromCtx(child).Trace(); trace.Priority() != 1 ||
+		len(observed) != 2 {
+		t.Fatalf("expected the new trace to inherit the priority")
+	}
+}
+
+func TestWatcherPanic(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	var recovered []interface{}
+	r.SetWatcherPanicHandler(func(rec interface{}) {
+		recovered = append(recovered, rec)
+	})
+
+	called := 0
+	defer r.ObserveTraces(func(*Trace) { panic("boom") })()
+	defer r.ObserveTraces(func(*Trace) { called++ })()
+
+	ctx := context.Background()
+	mon.Task()(&ctx)(nil)
+
+	if called != 1 {
+		t.Fatalf("expected the remaining watcher to be called, got %d", called)
+	}
+	if len(recovered) != 1 || recovered[0] != "boom" {
+		t.Fatalf("unexpected recovered values: %v", recovered)
+	}
+}
+
+type spanEvents struct {
+	r      *Registry
+	events []string
+}
+
+func (e *spanEvents) Start(s *Span) {
+	found := false
+	e.r.AllSpans(func(live *Span) { found = found || live == s })
+	if !found {
+		panic("started span not visible to AllSpans")
+	}
+	e.events = append(e.events, "start "+s.Func().ShortName())
+}
+
+func (e *spanEvents) Finish(s *Span, err error, panicked bool,
+	finish time.Time) {
+	e.events = append(e.events, "finish "+s.Func().ShortName())
+}
+
+func TestObserveAllSpans(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	events := &spanEvents{r: r}
+	cancel := r.ObserveAllSpans(events)
+
+	run := func() {
+		ctx := context.Background()
+		defer mon.TaskNamed("parent")(&ctx)(nil)
+		func(ctx context.Context) {
+			defer mon.TaskNamed("child")(&ctx)(nil)
+		}(ctx)
+	}
+
+	run()
+	expected := []string{
+		"start parent", "start child", "finish child", "finish parent"}
+	if len(events.events) != len(expected) {
+		t.Fatalf("unexpected events: %v", events.events)
+	}
+	for i := range expected {
+		if events.events[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, events.events)
+		}
+	}
+
+	cancel()
+	run()
+	if len(events.events) != len(expected) {
+		t.Fatalf("expected no events after cancel: %v", events.events)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	now := time.Unix(1000, 0)
+	r.SetClock(func() time.Time { return now })
+
+	var span *Span
+	func() {
+		ctx := context.Background()
+		defer mon.TaskNamed("timed")(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+		now = now.Add(500 * time.Millisecond)
+	}()
+
+	if span.Elapsed() != 500*time.Millisecond {
+		t.Fatalf("expected 500ms, got %v", span.Elapsed())
+	}
+	stats := Collect(mon)
+	if got := stats["function,name=timed,scope=test successes"]; got != 1 {
+		t.Fatalf("expected one success: %v", stats)
+	}
+	if got := stats["function_times,kind=success,name=timed,scope=test recent"]; got != 0.5 {
+		t.Fatalf("expected recent duration of 0.5s, got %v", got)
+	}
+
+	r.SetClock(nil)
+	if r.now() == now {
+		t.Fatalf("expected the default clock to be restored")
+	}
+}
+
+func TestReapOrphans(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	now := time.Unix(0, 0)
+	r.SetClock(func() time.Time { return now })
+	r.SetOrphanMaxAge(time.Hour)
+	defer r.SetOrphanMaxAge(0)
+
+	ctx := context.Background()
+	parentDone := mon.Task()(&ctx)
+	childDone := mon.TaskNamed("child")(&ctx)
+	parentDone(nil)
+
+	now = now.Add(time.Minute)
+	if reaped := r.reapOrphans(); reaped != 0 {
+		t.Fatalf("expected young orphans to be kept, reaped %d", reaped)
+	}
+	// listing the root spans reaps old orphans.
+	now = now.Add(time.Hour)
+	r.RootSpans(func(s *Span) {
+		t.Fatalf("unexpected root span %s", s.Func().ShortName())
+	})
+	stats := Collect(r)
+	if stats["leaked_orphans,scope=github.com/spacemonkeygo/monkit/v3 value"] != 1 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+
+	// so does orphaning another span, once half the max age has passed.
+	ctx = context.Background()
+	parentDone = mon.Task()(&ctx)
+	otherDone := mon.TaskNamed("child")(&ctx)
+	parentDone(nil)
+	now = now.Add(2 * time.Hour)
+	ctx = context.Background()
+	parentDone = mon.Task()(&ctx)
+	lastDone := mon.TaskNamed("child")(&ctx)
+	parentDone(nil)
+	r.orphanMtx.Lock()
+	orphans := len(r.orphans)
+	r.orphanMtx.Unlock()
+	if orphans != 1 {
+		t.Fatalf("expected only the new orphan to be kept, got %d", orphans)
+	}
+
+	// finishing a reaped orphan is harmless.
+	childDone(nil)
+	otherDone(nil)
+	lastDone(nil)
+}
+
+func TestObserveTracesRateLimited(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	now := time.Unix(100, 0)
+	r.SetClock(func() time.Time { return now })
+
+	observed := 0
+	defer r.ObserveTracesRateLimited(2, func(*Trace) { observed++ })()
+
+	run := func(n int) {
+		for i := 0; i < n; i++ {
+			ctx := context.Background()
+			mon.Task()(&ctx)(nil)
+		}
+	}
+
+	run(5)
+	if observed != 2 {
+		t.Fatalf("expected a burst of 2 traces, got %d", observed)
+	}
+	now = now.Add(500 * time.Millisecond)
+	run(5)
+	if observed != 3 {
+		t.Fatalf("expected 1 more trace after half a second, got %d", observed)
+	}
+
+	stats := Collect(r)
+	if stats["dropped_traces,scope=github.com/spacemonkeygo/monkit/v3 value"] != 7 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+func TestObserveTracesRateLimitedHuge(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	// more than one trace per nanosecond must not round down to no traces
+	observed := 0
+	defer r.ObserveTracesRateLimited(math.MaxInt32, func(*Trace) { observed++ })()
+	for i := 0; i < 5; i++ {
+		ctx := context.Background()
+		mon.Task()(&ctx)(nil)
+	}
+	if observed != 5 {
+		t.Fatalf("expected all traces to be observed, got %d", observed)
+	}
+}
+
+func TestObserveTracesAsync(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	started := make(chan struct{}, 5)
+	block := make(chan struct{})
+	var observed int64
+	cancel := r.ObserveTracesAsync(1, 2, func(*Trace) {
+		started <- struct{}{}
+		<-block
+		atomic.AddInt64(&observed, 1)
+	})
+
+	run := func() {
+		ctx := context.Background()
+		mon.Task()(&ctx)(nil)
+	}
+
+	// the first trace occupies the worker, the next two fill the queue, and
+	// the rest are dropped.
+	run()
+	<-started
+	for i := 0; i < 4; i++ {
+		run()
+	}
+	close(block)
+	cancel()
+
+	if observed != 3 {
+		t.Fatalf("expected the queued traces to be drained, got %d", observed)
+	}
+	stats := Collect(r)
+	if stats["async_dropped_traces,scope=github.com/spacemonkeygo/monkit/v3 value"] != 2 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+func TestStatsWithSpans(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	now := time.Unix(100, 0)
+	r.SetClock(func() time.Time { return now })
+
+	f := mon.FuncNamed("work")
+	mon.FuncNamed("idle")
+	ctx := context.Background()
+	defer f.Task(&ctx)(nil)
+	now = now.Add(time.Second)
+	child := ctx
+	defer f.Task(&child)(nil)
+	now = now.Add(2 * time.Second)
+
+	stats := map[string]float64{}
+	r.StatsWithSpans(func(key SeriesKey, field string, val float64) {
+		stats[key.WithField(field)] = val
+	})
+	for name, expected := range map[string]float64{
+		"function,name=work,scope=test live":                2,
+		"function,name=work,scope=test live_oldest_seconds": 3,
+		"function,name=idle,scope=test live":                0,
+	} {
+		if got, ok := stats[name]; !ok || got != expected {
+			t.Fatalf("expected %s of %v, got %v", name, expected, got)
+		}
+	}
+	if _, ok := stats["function,name=idle,scope=test live_oldest_seconds"]; ok {
+		t.Fatalf("unexpected oldest span age for an idle func")
+	}
+	if _, ok := stats["function,name=work,scope=test total"]; !ok {
+		t.Fatalf("expected the regular stats too")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	mon.Counter("count").Inc(2)
+
+	ctx := context.Background()
+	rootDone := mon.TaskNamed("root")(&ctx)
+	childCtx := ctx
+	childDone := mon.TaskNamed("child")(&childCtx, "arg")
+
+	snap := r.Snapshot()
+	childDone(nil)
+	rootDone(nil)
+	mon.Counter("count").Inc(1)
+
+	if len(snap.Scopes) != 1 || snap.Scopes[0] != "test" {
+		t.Fatalf("unexpected scopes: %v", snap.Scopes)
+	}
+	if len(snap.Funcs) != 2 || snap.Funcs[0].Name != "child" ||
+		snap.Funcs[1].Name != "root" {
+		t.Fatalf("unexpected funcs: %v", snap.Funcs)
+	}
+	found := false
+	for _, stat := range snap.Stats {
+		if stat.Key.Measurement == "count" && stat.Field == "value" {
+			found = stat.Value == 2
+		}
+	}
+	if !found {
+		t.Fatalf("expected the counter value at snapshot time: %v", snap.Stats)
+	}
+	if len(snap.Spans) != 1 || len(snap.Spans[0].Children) != 1 {
+		t.Fatalf("unexpected span forest: %v", snap.Spans)
+	}
+	child := snap.Spans[0].Children[0]
+	if child.Func.Name != "child" || child.ParentId != snap.Spans[0].Id ||
+		len(child.Args) != 1 || child.Args[0] != `"arg"` {
+		t.Fatalf("unexpected child span: %+v", child)
+	}
+}
+
+func TestSnapshotConsistent(t *testing.T) {
+	r := NewRegistry()
+
+	// a StatSource that calls back into the Registry while its stats are
+	// read, starting a Span of a Func in a new Scope, must neither deadlock
+	// nor leave that Span listed without its Func.
+	var done []func(*error)
+	r.ScopeNamed("test").Chain(StatSourceFunc(
+		func(cb func(key SeriesKey, field string, val float64)) {
+			ctx := context.Background()
+			mon := r.ScopeNamed(fmt.Sprintf("late%d", len(done)))
+			done = append(done, mon.TaskNamed("late")(&ctx))
+		}))
+	defer func() {
+		for _, finish := range done {
+			finish(nil)
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		snap := r.Snapshot()
+		scopes := map[string]bool{}
+		for _, name := range snap.Scopes {
+			scopes[name] = true
+		}
+		funcs := map[FuncSnapshot]bool{}
+		for _, f := range snap.Funcs {
+			if !scopes[f.Scope] {
+				t.Fatalf("func %v listed without its scope", f)
+			}
+			funcs[f] = true
+		}
+		for _, span := range snap.Spans {
+			if !funcs[span.Func] {
+				t.Fatalf("span %d listed without its func %v", span.Id,
+					span.Func)
+			}
+		}
+		reported := map[FuncSnapshot]bool{}
+		for _, stat := range snap.Stats {
+			if stat.Key.Measurement == "function" && stat.Field == "total" {
+				reported[FuncSnapshot{Scope: stat.Key.Tags.Get("scope"),
+					Name: stat.Key.Tags.Get("name")}] = true
+			}
+		}
+		for f := range funcs {
+			if !reported[FuncSnapshot{Scope: f.Scope, Name: f.Name}] {
+				t.Fatalf("func %v listed without its stats", f)
+			}
+		}
+		if len(snap.Spans) != i {
+			t.Fatalf("expected %d spans, got %d", i, len(snap.Spans))
+		}
+	}
+}
+
+func TestSetIdGenerator(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	var next int64
+	r.SetIdGenerator(func() int64 {
+		return 42<<32 | atomic.AddInt64(&next, 1)
+	})
+
+	var root, child *Span
+	func() {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		root = SpanFromCtx(ctx)
+		func(ctx context.Context) {
+			defer mon.Task()(&ctx)(nil)
+			child = SpanFromCtx(ctx)
+		}(ctx)
+	}()
+	for _, id := range []int64{root.Trace().Id(), root.Id(), child.Id()} {
+		if id>>32 != 42 {
+			t.Fatalf("id %x doesn't have the generator's prefix", id)
+		}
+	}
+	if root.Id() == child.Id() || root.Trace().Id() == root.Id() {
+		t.Fatalf("expected distinct ids")
+	}
+
+	r.SetIdGenerator(nil)
+	ctx := context.Background()
+	mon.Task()(&ctx)(nil)
+	if SpanFromCtx(ctx).Id()>>32 == 42 {
+		t.Fatalf("expected the default generator")
+	}
+}
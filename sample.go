@@ -0,0 +1,126 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+const (
+	// SampledKey is the Trace value key holding a bool of whether or not the
+	// Trace is sampled. See Trace.Get.
+	SampledKey = "sampled"
+
+	// SampleRateKey is the Trace value key holding the float64 rate that was
+	// used to make the sampling decision for a Trace, so that downstream
+	// services can make the same decision. The http and grpc subpackages
+	// propagate it along with the decision. See NewTraceSampled.
+	SampleRateKey = "sample-rate"
+
+	// PriorityKey is the Trace value key holding the int sampling priority of
+	// a Trace. See Trace.SetPriority.
+	PriorityKey = "priority"
+)
+
+// sampled returns whether the Trace has been decided to be sampled, or has a
+// priority that forces it to be.
+func (t *Trace) sampled() bool {
+	if t.Priority() > 0 {
+		return true
+	}
+	sampled, _ := t.Get(SampledKey).(bool)
+	return sampled
+}
+
+// SetPriority sets the sampling priority of the Trace, for traces that must
+// be retained no matter what, such as those of a debug session. Sampling
+// decisions are made in order of precedence:
+//
+//  1. A Trace with a priority above zero is always sampled, even if it
+//     inherited a decision not to be, and is never passed to the Registry's
+//     sampler.
+//  2. Otherwise a decision the Trace already carries under SampledKey, such
+//     as one inherited from a remote caller or an enclosing trace, is kept.
+//  3. Otherwise the Registry's sampler decides. See Registry.SetSampler.
+//
+// Setting a priority above zero also sets SampledKey to true, so the Trace
+// propagates as sampled. A priority of zero or less has no effect on
+// sampling. The priority is inherited by traces started from within the
+// Trace and propagated to remote services by the http and grpc subpackages.
+func (t *Trace) SetPriority(priority int) {
+	t.Set(PriorityKey, priority)
+	if priority > 0 {
+		t.Set(SampledKey, true)
+	}
+}
+
+// Priority returns the sampling priority of the Trace, or zero if none was
+// set. See SetPriority.
+func (t *Trace) Priority() int {
+	priority, _ := t.Get(PriorityKey).(int)
+	return priority
+}
+
+// NewTraceSampled creates a new Trace and decides whether or not it is
+// sampled with SampleTraceId. The decision is stored under SampledKey and the
+// rate under SampleRateKey.
+func NewTraceSampled(id int64, rate float64) *Trace {
+	t := NewTrace(id)
+	t.Set(SampledKey, SampleTraceId(id, rate))
+	t.Set(SampleRateKey, rate)
+	return t
+}
+
+// inheritSampling copies the sampling decision and rate of from onto t,
+// unless t already has a decision of its own. Traces started from within an
+// already sampled (or unsampled) trace thereby keep the same decision, so a
+// distributed request is sampled all or nothing. A higher priority is always
+// inherited.
+func inheritSampling(t, from *Trace) {
+	if priority := from.Priority(); priority > t.Priority() {
+		t.SetPriority(priority)
+	}
+	sampled, ok := from.Get(SampledKey).(bool)
+	if !ok {
+		return
+	}
+	if _, decided := t.Get(SampledKey).(bool); decided {
+		return
+	}
+	t.Set(SampledKey, sampled)
+	if rate, ok := from.Get(SampleRateKey).(float64); ok {
+		t.Set(SampleRateKey, rate)
+	}
+}
+
+// SampleTraceId deterministically decides whether a trace with the given id
+// should be sampled at the given rate, where 0 <= rate <= 1. The decision is
+// based on a hash of the id, so every service sharing a trace id and rate
+// comes to the same decision.
+func SampleTraceId(id int64, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	// use the top 53 bits of the hash as a uniform float in [0, 1)
+	return float64(hashId(id)>>11)/(1<<53) < rate
+}
+
+// hashId is the splitmix64 finalizer, which spreads sequential ids uniformly
+// over the full uint64 range.
+func hashId(id int64) uint64 {
+	z := uint64(id)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"testing"
+)
+
+func TestSampleTraceId(t *testing.T) {
+	const total = 100000
+	sampled := 0
+	for id := int64(0); id < total; id++ {
+		decision := SampleTraceId(id, .1)
+		if decision != SampleTraceId(id, .1) {
+			t.Fatalf("decision for %d is not stable", id)
+		}
+		if decision {
+			sampled++
+			if !SampleTraceId(id, .5) {
+				t.Fatalf("higher rates should sample a superset")
+			}
+		}
+	}
+	if sampled < total*9/100 || sampled > total*11/100 {
+		t.Fatalf("expected about 10%% sampled, got %d of %d", sampled, total)
+	}
+
+	tr := NewTraceSampled(5, 1)
+	if sampled, _ := tr.Get(SampledKey).(bool); !sampled {
+		t.Fatalf("expected trace to be sampled")
+	}
+	if rate, _ := tr.Get(SampleRateKey).(float64); rate != 1 {
+		t.Fatalf("expected rate to be stored, got %v", rate)
+	}
+}
@@ -16,25 +16,40 @@ package monkit
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Scope represents a named collection of StatSources. Scopes are constructed
 // through Registries.
 type Scope struct {
-	r       *Registry
-	name    string
-	mtx     sync.RWMutex
-	sources map[string]StatSource
-	chains  []StatSource
+	disabled int32 // sync/atomic
+
+	r            *Registry
+	name         string
+	mtx          sync.RWMutex
+	sources      map[string]StatSource
+	chains       []StatSource
+	descriptions map[string]statDescription
+	groups       map[string]*Scope // see Group
+
+	noopTask  Task            // see newNoopTask
+	noopTasks map[string]Task // see noopTaskNamed, protected by mtx
 }
 
 func newScope(r *Registry, name string) *Scope {
-	return &Scope{
+	s := &Scope{
 		r:       r,
 		name:    name,
 		sources: map[string]StatSource{}}
+	if r.noop {
+		s.disabled = 1
+		s.noopTask = s.newNoopTask(nil)
+	}
+	return s
 }
 
 // Func retrieves or creates a Func named after the currently executing
@@ -61,6 +76,9 @@ func (s *Scope) newSource(name string, constructor func() StatSource) (
 	}
 
 	ss := constructor()
+	if g, ok := ss.(gated); ok {
+		g.setGate(&s.disabled)
+	}
 	s.sources[name] = ss
 	s.mtx.Unlock()
 
@@ -104,19 +122,20 @@ func (s *Scope) FuncNamed(name string, tags ...SeriesTag) *Func {
 	return f
 }
 
-// Funcs calls 'cb' for all Funcs registered on this Scope.
+// Funcs calls 'cb' for all Funcs registered on this Scope, followed by the
+// Funcs of its groups. See Group.
 func (s *Scope) Funcs(cb func(f *Func)) {
-	s.mtx.Lock()
-	funcs := make(map[*Func]struct{}, len(s.sources))
-	for _, source := range s.sources {
-		if f, ok := source.(*Func); ok {
-			funcs[f] = struct{}{}
-		}
-	}
-	s.mtx.Unlock()
-	for f := range funcs {
+	for _, f := range s.funcList() {
 		cb(f)
 	}
+	for _, g := range s.groupList() {
+		g.Funcs(cb)
+	}
+}
+
+// funcList returns a snapshot of the Scope's Funcs.
+func (s *Scope) funcList() []*Func {
+	return scopeSources{named: s.allNamedSources()}.funcs()
 }
 
 // Meter retrieves or creates a Meter named after the given name. See Event.
@@ -133,11 +152,68 @@ func (s *Scope) Meter(name string, tags ...SeriesTag) *Meter {
 }
 
 // Event retrieves or creates a Meter named after the given name and then
-// calls Mark(1) on that meter.
+// calls Mark(1) on that meter. To also see when an event last happened, hold
+// an EventCounter instead.
 func (s *Scope) Event(name string, tags ...SeriesTag) {
 	s.Meter(name, tags...).Mark(1)
 }
 
+// EventCounter retrieves or creates an EventCounter named after the given
+// name.
+func (s *Scope) EventCounter(name string, tags ...SeriesTag) *EventCounter {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewEventCounter(NewSeriesKey(name).WithTags(tags...))
+	})
+	m, ok := source.(*EventCounter)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
+// BurstMeter retrieves or creates a BurstMeter named after the given name.
+func (s *Scope) BurstMeter(name string, tags ...SeriesTag) *BurstMeter {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewBurstMeter(NewSeriesKey(name).WithTags(tags...))
+	})
+	m, ok := source.(*BurstMeter)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
+// RateMeter retrieves or creates a RateMeter named after the given name.
+func (s *Scope) RateMeter(name string, tags ...SeriesTag) *RateMeter {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewRateMeter(NewSeriesKey(name).WithTags(tags...))
+	})
+	m, ok := source.(*RateMeter)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
+// Histogram retrieves or creates a Histogram after the given name with the
+// given bucket upper bounds. If a Histogram with this name already exists, it
+// is returned unchanged.
+func (s *Scope) Histogram(name string, buckets []float64,
+	tags ...SeriesTag) *Histogram {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewHistogram(NewSeriesKey(name).WithTags(tags...), buckets)
+	})
+	m, ok := source.(*Histogram)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
 // DiffMeter retrieves or creates a DiffMeter after the given name and two
 // submeters.
 func (s *Scope) DiffMeter(name string, m1, m2 *Meter, tags ...SeriesTag) {
@@ -188,6 +264,45 @@ func (s *Scope) FloatValf(template string, args ...interface{}) *FloatVal {
 	return s.FloatVal(fmt.Sprintf(template, args...))
 }
 
+// FloatValWithPercentiles retrieves or creates a FloatVal after the given
+// name that reports the given reservoir percentiles, e.g.
+// []float64{50, 95, 99.9}. If a FloatVal with this name already exists, it is
+// returned unchanged.
+func (s *Scope) FloatValWithPercentiles(name string, percentiles []float64,
+	tags ...SeriesTag) *FloatVal {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewFloatValWithPercentiles(
+			NewSeriesKey(name).WithTags(tags...), percentiles)
+	})
+	m, ok := source.(*FloatVal)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
+// FloatValSized retrieves or creates a FloatVal after the given name that
+// keeps reservoir samples for percentile estimation instead of the default of
+// ReservoirSize. Each sample costs 4 bytes. Percentiles are estimated from
+// the samples, so tail percentiles such as r99 are only as good as the
+// handful of samples above them: a larger reservoir gives more accurate tails
+// for busy series at the cost of memory and of sorting time when stats are
+// collected, while a smaller one saves memory for quiet series. If a FloatVal
+// with this name already exists, it is returned unchanged.
+func (s *Scope) FloatValSized(name string, reservoir int,
+	tags ...SeriesTag) *FloatVal {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewFloatValSized(NewSeriesKey(name).WithTags(tags...), reservoir)
+	})
+	m, ok := source.(*FloatVal)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
 // BoolVal retrieves or creates a BoolVal after the given name.
 func (s *Scope) BoolVal(name string, tags ...SeriesTag) *BoolVal {
 	source := s.newSource(sourceName("", name, tags), func() StatSource {
@@ -233,6 +348,57 @@ func (s *Scope) DurationVal(name string, tags ...SeriesTag) *DurationVal {
 	return m
 }
 
+// DurationValWithPercentiles retrieves or creates a DurationVal after the
+// given name that reports the given reservoir percentiles, e.g.
+// []float64{50, 95, 99.9}. If a DurationVal with this name already exists, it
+// is returned unchanged.
+func (s *Scope) DurationValWithPercentiles(name string, percentiles []float64,
+	tags ...SeriesTag) *DurationVal {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewDurationValWithPercentiles(
+			NewSeriesKey(name).WithTags(tags...), percentiles)
+	})
+	m, ok := source.(*DurationVal)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
+// DurationValSized retrieves or creates a DurationVal after the given name
+// that keeps reservoir samples for percentile estimation. See FloatValSized
+// for the tradeoffs involved.
+func (s *Scope) DurationValSized(name string, reservoir int,
+	tags ...SeriesTag) *DurationVal {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewDurationValSized(NewSeriesKey(name).WithTags(tags...), reservoir)
+	})
+	m, ok := source.(*DurationVal)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
+// DurationValUnit retrieves or creates a DurationVal after the given name
+// that reports durations in the given unit, e.g. time.Millisecond, instead of
+// seconds. If a DurationVal with this name already exists, it is returned
+// unchanged.
+func (s *Scope) DurationValUnit(name string, unit time.Duration,
+	tags ...SeriesTag) *DurationVal {
+	source := s.newSource(sourceName("", name, tags), func() StatSource {
+		return NewDurationValUnit(NewSeriesKey(name).WithTags(tags...), unit)
+	})
+	m, ok := source.(*DurationVal)
+	if !ok {
+		panic(fmt.Sprintf("%s already used for another stats source: %#v",
+			name, source))
+	}
+	return m
+}
+
 // Timer retrieves or creates a Timer after the given name.
 func (s *Scope) Timer(name string, tags ...SeriesTag) *Timer {
 	source := s.newSource(sourceName("", name, tags), func() StatSource {
@@ -262,30 +428,45 @@ func (s *Scope) Counter(name string, tags ...SeriesTag) *Counter {
 // Gauge registers a callback that returns a float as the given name in the
 // Scope's StatSource table.
 func (s *Scope) Gauge(name string, cb func() float64) {
-	type gauge struct{ StatSource }
+	s.GaugeFunc(name, cb)
+}
+
+type gauge struct{ StatSource }
+
+// GaugeFunc is like Gauge, but also accepts SeriesTags. cb is called to
+// compute the current value every time the Scope's Stats are walked, so
+// there is no need for a goroutine polling the value. No Scope or Registry
+// locks are held while cb runs, so cb may safely use monkit itself.
+// Registering a GaugeFunc with the same name and tags as an existing one
+// replaces it.
+func (s *Scope) GaugeFunc(name string, cb func() float64, tags ...SeriesTag) {
+	key := NewSeriesKey(name).WithTags(tags...)
+	sourceName := sourceName("", name, tags)
 
 	// gauges allow overwriting
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	if source, exists := s.sources[name]; exists {
+	if source, exists := s.sources[sourceName]; exists {
 		if _, ok := source.(gauge); !ok {
 			panic(fmt.Sprintf("%s already used for another stats source: %#v",
 				name, source))
 		}
 	}
 
-	s.sources[name] = gauge{StatSource: StatSourceFunc(
+	s.sources[sourceName] = gauge{StatSource: StatSourceFunc(
 		func(scb func(key SeriesKey, field string, value float64)) {
-			scb(NewSeriesKey(name), "value", cb())
+			scb(key, "value", cb())
 		}),
 	}
 }
 
-// Chain registers a full StatSource as the given name in the Scope's
-// StatSource table.
+// Chain registers an external StatSource with the Scope. Every chained
+// source is walked during Stats, after the Scope's own sources, and its
+// series are tagged with the Scope's name like everything else in the Scope.
+// Stat producers with their own callback signature can be adapted with
+// StatSourceFunc.
 func (s *Scope) Chain(source StatSource) {
-	// chains allow overwriting
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
@@ -302,29 +483,233 @@ func (s *Scope) allNamedSources() (sources []namedSource) {
 	return sources
 }
 
-// Stats implements the StatSource interface.
+// Stats implements the StatSource interface. The stats of the Scope's groups
+// are reported after its own, each under the group's name. See Group.
 func (s *Scope) Stats(cb func(key SeriesKey, field string, val float64)) {
-	cbWithScope := func(key SeriesKey, field string, val float64) {
-		cb(key.WithTag("scope", s.name), field, val)
+	if !s.Enabled() {
+		return
+	}
+	s.sourceList().stats(s.name, cb)
+	for _, g := range s.groupList() {
+		g.Stats(cb)
 	}
+}
 
-	for _, namedSource := range s.allNamedSources() {
-		namedSource.source.Stats(cbWithScope)
+// ownStats is like Stats, but leaves out the Scope's groups, for walks that
+// visit every Scope of the Registry anyway.
+func (s *Scope) ownStats(cb func(key SeriesKey, field string, val float64)) {
+	if !s.Enabled() {
+		return
 	}
+	s.sourceList().stats(s.name, cb)
+}
+
+// scopeSources is a copy of the StatSources registered on a Scope, so that
+// they can be reported without holding the Scope's lock.
+type scopeSources struct {
+	named  []namedSource
+	chains []StatSource
+}
 
+func (s *Scope) sourceList() scopeSources {
+	named := s.allNamedSources()
 	s.mtx.Lock()
 	chains := append([]StatSource(nil), s.chains...)
 	s.mtx.Unlock()
+	return scopeSources{named: named, chains: chains}
+}
 
-	for _, source := range chains {
+// funcs returns the Funcs among l's sources, without duplicates.
+func (l scopeSources) funcs() []*Func {
+	seen := make(map[*Func]bool, len(l.named))
+	funcs := make([]*Func, 0, len(l.named))
+	for _, namedSource := range l.named {
+		if f, ok := namedSource.source.(*Func); ok && !seen[f] {
+			seen[f] = true
+			funcs = append(funcs, f)
+		}
+	}
+	return funcs
+}
+
+// stats reports the stats of l's sources to cb, tagged with the scope name.
+func (l scopeSources) stats(scope string,
+	cb func(key SeriesKey, field string, val float64)) {
+	cbWithScope := func(key SeriesKey, field string, val float64) {
+		cb(key.WithTag("scope", scope), field, val)
+	}
+	for _, namedSource := range l.named {
+		namedSource.source.Stats(cbWithScope)
+	}
+	for _, source := range l.chains {
 		source.Stats(cbWithScope)
 	}
 }
 
+// Reset zeroes all of the Funcs, counters, meters, and distributions
+// registered on the Scope. Registrations are kept, so existing references
+// stay valid and keep recording. Gauges and chained StatSources are left
+// alone. The Scope's groups are reset too. Reset is safe to call while other
+// goroutines are recording, but it is mostly intended for isolating tests
+// from one another.
+func (s *Scope) Reset() {
+	s.reset()
+	for _, g := range s.groupList() {
+		g.Reset()
+	}
+}
+
+// reset is like Reset, but leaves out the Scope's groups.
+func (s *Scope) reset() {
+	for _, namedSource := range s.allNamedSources() {
+		switch source := namedSource.source.(type) {
+		case *Func:
+			source.resetCounts()
+		case *Counter:
+			source.Reset()
+		case *Meter:
+			source.Reset(0)
+		case interface{ Reset() }:
+			source.Reset()
+		}
+	}
+}
+
+// SetEnabled turns collection for the Scope on or off at runtime. Scopes are
+// enabled by default. While a Scope is disabled, its Tasks don't create Spans
+// or record anything, the Counters, Meters, Vals, Timers, and Histograms
+// retrieved from it drop what they are given, each at the cost of a single
+// atomic load, and its Stats reports nothing. Values recorded before the
+// Scope was disabled are kept, so a Counter that tracks work in flight with
+// Inc and Dec can drift if it is disabled in between. Stat sources made with
+// their own constructors, such as NewCounter, aren't affected. Scopes of a
+// Registry made with NewNoopRegistry stay disabled.
+func (s *Scope) SetEnabled(enabled bool) {
+	if s.r.noop {
+		return
+	}
+	disabled := int32(1)
+	if enabled {
+		disabled = 0
+	}
+	atomic.StoreInt32(&s.disabled, disabled)
+}
+
+// Enabled returns whether collection for the Scope is enabled. See
+// SetEnabled.
+func (s *Scope) Enabled() bool { return atomic.LoadInt32(&s.disabled) == 0 }
+
+// gated is implemented by the stat sources that stop recording while the
+// Scope they were retrieved from is disabled.
+type gated interface {
+	setGate(disabled *int32)
+}
+
+// scopeGate is embedded in stat sources to implement gated. The zero value
+// never stops recording.
+type scopeGate struct {
+	disabled *int32 // sync/atomic
+}
+
+func (g *scopeGate) setGate(disabled *int32) { g.disabled = disabled }
+
+// off returns true while the Scope the stat source belongs to is disabled.
+func (g *scopeGate) off() bool {
+	return g.disabled != nil && atomic.LoadInt32(g.disabled) != 0
+}
+
 // Name returns the name of the Scope, often the Package name.
 func (s *Scope) Name() string { return s.name }
 
-var _ StatSource = (*Scope)(nil)
+type statDescription struct {
+	help string
+	unit string
+}
+
+// Describe attaches human readable help text and the unit the values are
+// measured in, such as "seconds" or "bytes", to the stat created on this
+// Scope with the given name, such as "requests.served" for
+// mon.Meter("requests.served"). Either may be empty. The metadata is kept
+// apart from the stat itself, so it costs nothing when recording values, and
+// is reported by presenters that support it, such as the OpenMetrics one. See
+// DescribedStatSource.
+func (s *Scope) Describe(name, help, unit string) {
+	s.updateDescription(name, func(d *statDescription) {
+		d.help, d.unit = help, unit
+	})
+}
+
+// SetDescription is like Describe, but only sets the help text of the named
+// stat. Passing an empty text removes it.
+func (s *Scope) SetDescription(statName, text string) {
+	s.updateDescription(statName, func(d *statDescription) { d.help = text })
+}
+
+// SetUnit is like Describe, but only sets the unit of the named stat.
+// Passing an empty unit removes it.
+func (s *Scope) SetUnit(statName, unit string) {
+	s.updateDescription(statName, func(d *statDescription) { d.unit = unit })
+}
+
+func (s *Scope) updateDescription(statName string,
+	update func(d *statDescription)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	d := s.descriptions[statName]
+	update(&d)
+	if d == (statDescription{}) {
+		delete(s.descriptions, statName)
+		return
+	}
+	if s.descriptions == nil {
+		s.descriptions = map[string]statDescription{}
+	}
+	s.descriptions[statName] = d
+}
+
+// Description returns the help text and unit set for the named stat, if any.
+func (s *Scope) Description(statName string) (help, unit string) {
+	s.mtx.RLock()
+	d := s.descriptions[statName]
+	s.mtx.RUnlock()
+	return d.help, d.unit
+}
+
+// StatDescription implements the DescribedStatSource interface.
+func (s *Scope) StatDescription(key SeriesKey) (help, unit string) {
+	return s.Description(key.Measurement)
+}
+
+// Group returns a child Scope for namespacing related stats within a large
+// package. The child Scope is registered on the same Registry with the name
+// of this Scope followed by a dot and the given name, so its stats and Funcs
+// are reported under e.g. "pkg.cache". This Scope keeps track of its groups,
+// and its Stats, Funcs, and Reset include theirs. Calling Group with the same
+// name returns the same Scope.
+func (s *Scope) Group(name string) *Scope {
+	g := s.r.ScopeNamed(s.name + "." + name)
+	s.mtx.Lock()
+	if s.groups == nil {
+		s.groups = map[string]*Scope{}
+	}
+	s.groups[name] = g
+	s.mtx.Unlock()
+	return g
+}
+
+// groupList returns a sorted snapshot of the Scope's groups.
+func (s *Scope) groupList() []*Scope {
+	s.mtx.RLock()
+	groups := make([]*Scope, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	s.mtx.RUnlock()
+	sort.Sort(scopeSorter(groups))
+	return groups
+}
+
+var _ DescribedStatSource = (*Scope)(nil)
 
 type namedSource struct {
 	name   string
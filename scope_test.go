@@ -0,0 +1,268 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScopeChain(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	mon.Counter("own").Inc(1)
+
+	// a helper library with its own callback signature
+	libStats := func(cb func(name string, val float64)) {
+		cb("hits", 3)
+		cb("misses", 1)
+	}
+	mon.Chain(StatSourceFunc(func(cb func(key SeriesKey, field string, val float64)) {
+		libStats(func(name string, val float64) {
+			cb(NewSeriesKey("cache"), name, val)
+		})
+	}))
+	mon.Chain(StatSourceFunc(func(cb func(key SeriesKey, field string, val float64)) {
+		cb(NewSeriesKey("pool"), "size", 8)
+	}))
+
+	stats := Collect(mon)
+	for key, expected := range map[string]float64{
+		"own,scope=test value":    1,
+		"cache,scope=test hits":   3,
+		"cache,scope=test misses": 1,
+		"pool,scope=test size":    8,
+	} {
+		if val, ok := stats[key]; !ok || val != expected {
+			t.Fatalf("expected %s to be %v: %v", key, expected, stats)
+		}
+	}
+}
+
+func TestScopeGroup(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("pkg")
+	sub := mon.Group("sub")
+	if sub.Name() != "pkg.sub" {
+		t.Fatalf("unexpected name %q", sub.Name())
+	}
+	if mon.Group("sub") != sub || r.ScopeNamed("pkg.sub") != sub {
+		t.Fatalf("expected the same Scope for the same group")
+	}
+
+	mon.Counter("own").Inc(1)
+	sub.Counter("hits").Inc(2)
+	ctx := context.Background()
+	sub.FuncNamed("lookup").Task(&ctx)(nil)
+
+	stats := Collect(r)
+	for key, expected := range map[string]float64{
+		"own,scope=pkg value":                      1,
+		"hits,scope=pkg.sub value":                 2,
+		"function,name=lookup,scope=pkg.sub total": 1,
+	} {
+		if val, ok := stats[key]; !ok || val != expected {
+			t.Fatalf("expected %s to be %v: %v", key, expected, stats)
+		}
+	}
+
+	// the parent reports its groups' stats and Funcs along with its own,
+	// while the Registry still reports each of them once.
+	parent := Collect(mon)
+	for _, key := range []string{
+		"own,scope=pkg value",
+		"hits,scope=pkg.sub value",
+		"function,name=lookup,scope=pkg.sub total",
+	} {
+		if _, ok := parent[key]; !ok {
+			t.Fatalf("expected %s to be reported by the parent: %v", key, parent)
+		}
+	}
+	var funcs []string
+	mon.Funcs(func(f *Func) { funcs = append(funcs, f.FullName()) })
+	if len(funcs) != 1 || funcs[0] != "pkg.sub.lookup" {
+		t.Fatalf("unexpected parent funcs: %v", funcs)
+	}
+	reported := 0
+	r.Stats(func(key SeriesKey, field string, val float64) {
+		if key.Measurement == "hits" && field == "value" {
+			reported++
+		}
+	})
+	if reported != 1 {
+		t.Fatalf("expected the group's counter once, got %d", reported)
+	}
+}
+
+func TestScopeSetEnabled(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	mon.Counter("count").Inc(1)
+
+	mon.SetEnabled(false)
+	ctx := context.Background()
+	mon.Task()(&ctx)(nil)
+	if SpanFromCtx(ctx) != nil {
+		t.Fatal("expected no span while disabled")
+	}
+	if stats := Collect(r); len(stats) != 0 {
+		t.Fatalf("expected no stats while disabled: %v", stats)
+	}
+
+	mon.SetEnabled(true)
+	mon.Task()(&ctx)(nil)
+	if SpanFromCtx(ctx) == nil {
+		t.Fatal("expected a span once enabled again")
+	}
+	stats := Collect(r)
+	if stats["count,scope=test value"] != 1 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+func TestScopeSetEnabledRecording(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	counter := mon.Counter("counter")
+	meter := mon.Meter("meter")
+	burst := mon.BurstMeter("burst")
+	rate := mon.RateMeter("rate")
+	histogram := mon.Histogram("histogram", []float64{1})
+	intVal := mon.IntVal("int")
+	floatVal := mon.FloatVal("float")
+	durVal := mon.DurationVal("duration")
+	boolVal := mon.BoolVal("bool")
+	structVal := mon.StructVal("struct")
+	timer := mon.Timer("timer")
+	standalone := NewCounter(NewSeriesKey("standalone"))
+
+	record := func() {
+		counter.Inc(1)
+		counter.Set(counter.Current() + 1)
+		meter.Mark(1)
+		burst.Mark(1)
+		rate.Mark(1)
+		histogram.Observe(1)
+		intVal.Observe(1)
+		intVal.ObserveN(1, 2)
+		floatVal.Observe(1)
+		floatVal.ObserveWeighted(1, 2)
+		durVal.Observe(time.Second)
+		durVal.ObserveN(time.Second, 2)
+		boolVal.Observe(true)
+		structVal.Observe(struct{ Field int }{1})
+		timer.Start().Stop()
+		standalone.Inc(1)
+	}
+
+	mon.SetEnabled(false)
+	record()
+	mon.SetEnabled(true)
+	if counter.Current() != 0 || meter.Total() != 0 || burst.Total() != 0 ||
+		rate.Total() != 0 || histogram.Sum() != 0 {
+		t.Fatal("expected counters and meters not to record while disabled")
+	}
+	if intVal.dist.Count != 0 || floatVal.dist.Count != 0 ||
+		durVal.dist.Count != 0 || timer.Values().Count != 0 {
+		t.Fatal("expected vals not to record while disabled")
+	}
+	if stats := Collect(boolVal); stats["bool true"] != 0 {
+		t.Fatalf("expected the bool val not to record while disabled: %v", stats)
+	}
+	if stats := Collect(structVal); len(stats) != 0 {
+		t.Fatalf("expected the struct val not to record while disabled: %v", stats)
+	}
+	if standalone.Current() != 1 {
+		t.Fatal("expected counters not retrieved from a scope to keep recording")
+	}
+
+	record()
+	if counter.Current() != 2 || intVal.dist.Count != 3 ||
+		floatVal.dist.Count != 3 || durVal.dist.Count != 3 ||
+		timer.Values().Count != 1 || histogram.Sum() != 1 {
+		t.Fatal("expected recording once enabled again")
+	}
+}
+
+func TestNoopRegistry(t *testing.T) {
+	r := NewNoopRegistry()
+	mon := r.ScopeNamed("test")
+	count := mon.Counter("count")
+	f := mon.Func()
+
+	mon.SetEnabled(true)
+	if mon.Enabled() || mon.Group("sub").Enabled() {
+		t.Fatal("expected no-op scopes to stay disabled")
+	}
+
+	ctx := context.Background()
+	var err error
+	allocs := testing.AllocsPerRun(100, func() {
+		mon.Task()(&ctx)(&err)
+		mon.TaskNamed("named")(&ctx)(&err)
+		f.Task(&ctx)(&err)
+		count.Inc(1)
+		if SpanFromCtx(ctx) != nil {
+			t.Fatal("expected no span")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+	if stats := Collect(r); len(stats) != 0 {
+		t.Fatalf("expected no stats: %v", stats)
+	}
+
+	if got := mon.Task().Func(); got.ShortName() != "TestNoopRegistry" {
+		t.Fatalf("unexpected Func %q", got.ShortName())
+	}
+	if got := mon.TaskNamed("named").Func(); got.ShortName() != "named" {
+		t.Fatalf("unexpected Func %q", got.ShortName())
+	}
+	if got := mon.Task(NewSeriesTag("key", "val")).Func(); got.ShortName() !=
+		"TestNoopRegistry" || got.key.Tags.Get("key") != "val" {
+		t.Fatalf("unexpected Func %q", got.ShortName())
+	}
+}
+
+func TestScopeDescribe(t *testing.T) {
+	r := NewRegistry()
+	s := r.ScopeNamed("test")
+	s.Counter("requests").Inc(1)
+	s.Describe("requests", "Requests handled.", "requests")
+
+	var src DescribedStatSource = r
+	var key SeriesKey
+	src.Stats(func(k SeriesKey, field string, val float64) { key = k })
+	if help, unit := src.StatDescription(key); help != "Requests handled." ||
+		unit != "requests" {
+		t.Fatalf("unexpected description: %q %q", help, unit)
+	}
+
+	s.SetDescription("requests", "")
+	if help, unit := s.Description("requests"); help != "" || unit != "requests" {
+		t.Fatalf("unexpected description: %q %q", help, unit)
+	}
+	s.SetUnit("requests", "")
+	if len(s.descriptions) != 0 {
+		t.Fatalf("expected empty descriptions to be removed")
+	}
+
+	if help, unit := r.StatDescription(
+		NewSeriesKey("requests").WithTag("scope", "missing")); help != "" ||
+		unit != "" {
+		t.Fatalf("unexpected description for unknown scope: %q %q", help, unit)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package monkit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// SlogHandler wraps next so that every record logged with a context that
+// has a Span attached gets trace_id and span_id attributes. The trace id is
+// formatted like TraceId.String and the span id as 16 lowercase hex
+// characters, which matches how the ids are exported to OpenTelemetry.
+// Records logged without a context or without a Span are passed through
+// unchanged.
+func SlogHandler(next slog.Handler) slog.Handler {
+	return slogHandler{next: next}
+}
+
+type slogHandler struct {
+	next slog.Handler
+}
+
+// Enabled implements slog.Handler.
+func (h slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if s := SpanFromCtx(ctx); s != nil {
+			r = r.Clone()
+			r.AddAttrs(
+				slog.String("trace_id", s.Trace().Id128().String()),
+				slog.String("span_id", fmt.Sprintf("%016x", uint64(s.Id()))))
+		}
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return slogHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler.
+func (h slogHandler) WithGroup(name string) slog.Handler {
+	return slogHandler{next: h.next.WithGroup(name)}
+}
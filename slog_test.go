@@ -0,0 +1,64 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package monkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(SlogHandler(slog.NewJSONHandler(&buf, nil)))
+
+	logger.InfoContext(context.Background(), "no span")
+	var rec map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec["trace_id"]; ok {
+		t.Fatalf("unexpected trace_id: %v", rec)
+	}
+
+	mon := NewRegistry().Package()
+	ctx := context.Background()
+	func() {
+		defer mon.Task()(&ctx)(nil)
+		buf.Reset()
+		logger.With("a", 1).InfoContext(ctx, "with span")
+	}()
+
+	rec = nil
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	s := SpanFromCtx(ctx)
+	if rec["trace_id"] != s.Trace().Id128().String() {
+		t.Fatalf("unexpected trace_id: %v", rec)
+	}
+	if rec["span_id"] != fmt.Sprintf("%016x", uint64(s.Id())) {
+		t.Fatalf("unexpected span_id: %v", rec)
+	}
+	if rec["a"] != float64(1) {
+		t.Fatalf("expected attrs to be preserved: %v", rec)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ObserveSlowTraces calls cb for every new trace that took longer than
+// threshold, once all of the trace's spans have finished. A trace's duration
+// is the time from the start of its first span to the finish of its last
+// span, as reported by Trace.Duration. Like ObserveTraces, this only applies
+// to traces that start after ObserveSlowTraces is called. The returned cancel
+// method stops any further calls to cb.
+func (r *Registry) ObserveSlowTraces(threshold time.Duration,
+	cb func(*Trace)) (cancel func()) {
+	return r.observeSlowTraces(threshold, cb, false)
+}
+
+// ObserveSlowTracesSampled is like ObserveSlowTraces, but only considers
+// traces that are sampled. See ObserveTracesSampled.
+func (r *Registry) ObserveSlowTracesSampled(threshold time.Duration,
+	cb func(*Trace)) (cancel func()) {
+	return r.observeSlowTraces(threshold, cb, true)
+}
+
+func (r *Registry) observeSlowTraces(threshold time.Duration,
+	cb func(*Trace), sampledOnly bool) (cancel func()) {
+	w := &slowTraceWatcher{threshold: threshold, cb: cb}
+	stop := r.observeFinishedTraces(nil, w.finished, sampledOnly)
+	return func() {
+		// traces that are still running are reported when stopping, so
+		// cancel first to ignore them.
+		w.mtx.Lock()
+		w.canceled = true
+		w.mtx.Unlock()
+		stop()
+	}
+}
+
+type slowTraceWatcher struct {
+	threshold time.Duration
+	cb        func(*Trace)
+
+	mtx      sync.Mutex
+	canceled bool
+}
+
+func (w *slowTraceWatcher) finished(t *Trace, spans []*FinishedSpan) {
+	if t.Duration() <= w.threshold {
+		return
+	}
+	w.mtx.Lock()
+	canceled := w.canceled
+	w.mtx.Unlock()
+	if !canceled {
+		w.cb(t)
+	}
+}
+
+// SlowestLiveSpans returns up to n of the currently executing Spans found by
+// AllSpans, sorted by how long they have been running, longest first. All
+// elapsed times are measured against the same snapshot of the Registry's
+// clock, so ties are broken by Span id and the order is stable.
+func (r *Registry) SlowestLiveSpans(n int) []*Span {
+	if n <= 0 {
+		return nil
+	}
+	type liveSpan struct {
+		span    *Span
+		elapsed time.Duration
+	}
+	var live []liveSpan
+	now := r.now()
+	r.AllSpans(func(s *Span) {
+		live = append(live, liveSpan{span: s, elapsed: now.Sub(s.Start())})
+	})
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].elapsed != live[j].elapsed {
+			return live[i].elapsed > live[j].elapsed
+		}
+		return live[i].span.Id() < live[j].span.Id()
+	})
+	if len(live) > n {
+		live = live[:n]
+	}
+	spans := make([]*Span, 0, len(live))
+	for _, l := range live {
+		spans = append(spans, l.span)
+	}
+	return spans
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestObserveSlowTraces(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	now := time.Unix(1000, 0)
+	r.SetClock(func() time.Time { return now })
+
+	var slow []int64
+	cancel := r.ObserveSlowTraces(time.Second, func(t *Trace) {
+		slow = append(slow, t.Id())
+	})
+
+	run := func(d time.Duration) (traceId int64) {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		traceId = SpanFromCtx(ctx).Trace().Id()
+		func(ctx context.Context) {
+			defer mon.Task()(&ctx)(nil)
+			now = now.Add(d)
+		}(ctx)
+		return traceId
+	}
+
+	run(500 * time.Millisecond)
+	slowId := run(2 * time.Second)
+	if len(slow) != 1 || slow[0] != slowId {
+		t.Fatalf("expected only the slow trace, got %v", slow)
+	}
+
+	// traces still running when canceling aren't reported
+	ctx := context.Background()
+	finish := mon.Task()(&ctx)
+	now = now.Add(2 * time.Second)
+	func(ctx context.Context) {
+		defer mon.Task()(&ctx)(nil)
+	}(ctx)
+	cancel()
+	finish(nil)
+	run(2 * time.Second)
+	if len(slow) != 1 {
+		t.Fatalf("expected no calls after cancel")
+	}
+}
+
+func TestSlowestLiveSpans(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	now := time.Unix(1000, 0)
+	r.SetClock(func() time.Time { return now })
+
+	if spans := r.SlowestLiveSpans(3); len(spans) != 0 {
+		t.Fatalf("expected no spans, got %v", spans)
+	}
+
+	start := func() (*Span, func(*error)) {
+		ctx := context.Background()
+		exit := mon.Task()(&ctx)
+		now = now.Add(time.Second)
+		return SpanFromCtx(ctx), exit
+	}
+	oldest, exit1 := start()
+	middle, exit2 := start()
+	done, exit3 := start()
+	exit3(nil)
+	newest, exit4 := start()
+	defer exit1(nil)
+	defer exit2(nil)
+	defer exit4(nil)
+
+	spans := r.SlowestLiveSpans(2)
+	if len(spans) != 2 || spans[0] != oldest || spans[1] != middle {
+		t.Fatalf("unexpected spans: %v", spans)
+	}
+	spans = r.SlowestLiveSpans(10)
+	if len(spans) != 3 || spans[2] != newest {
+		t.Fatalf("unexpected spans: %v", spans)
+	}
+	for _, s := range spans {
+		if s == done {
+			t.Fatalf("finished span returned")
+		}
+	}
+}
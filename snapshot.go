@@ -0,0 +1,174 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"sort"
+	"time"
+)
+
+// Snapshot is a point-in-time copy of the state of a Registry. See
+// Registry.Snapshot.
+type Snapshot struct {
+	// Time is when the Snapshot was taken, according to the Registry's clock.
+	Time time.Time
+
+	// Scopes holds the names of all Scopes, sorted.
+	Scopes []string
+
+	// Funcs holds all Funcs, sorted by Scope and then by name.
+	Funcs []FuncSnapshot
+
+	// Stats holds every value the Registry's Stats reported, in order.
+	Stats []StatSnapshot
+
+	// Spans holds the trees of live Spans, starting with the root Spans as
+	// returned by RootSpans.
+	Spans []*SpanSnapshot
+}
+
+// FuncSnapshot is a copy of the identity of a Func.
+type FuncSnapshot struct {
+	Id    int64
+	Scope string
+	Name  string
+}
+
+// StatSnapshot is a single value reported by a StatSource.
+type StatSnapshot struct {
+	Key   SeriesKey
+	Field string
+	Value float64
+}
+
+// SpanSnapshot is a copy of a live Span and its children.
+type SpanSnapshot struct {
+	Id          int64
+	ParentId    int64
+	HasParent   bool
+	TraceId     int64
+	Func        FuncSnapshot
+	Args        []string
+	Annotations []Annotation
+	Start       time.Time
+	Elapsed     time.Duration // as of the Snapshot's Time
+	Orphaned    bool
+	Children    []*SpanSnapshot
+}
+
+// Snapshot copies the Registry's Scopes, Funcs, stats, and live Spans into a
+// Snapshot, so that presenters can work from one consistent view instead of
+// walking the Registry several times while it changes. The Snapshot doesn't
+// reference any live objects, and it isn't affected by anything the Registry
+// does afterwards.
+//
+// While the Scopes, Funcs, and Spans are copied, the Registry's Scope and
+// Span locks are held together, so no Scope can be created and no root Span
+// can start or finish in the meantime. Funcs are copied after the Spans, so
+// every Span's Func is listed, and the stats are read from exactly the Scopes
+// and StatSources the Snapshot lists. The elapsed times of all Spans are
+// measured against the same Time. Everything is copied, so a Snapshot costs
+// memory in proportion to the number of stats and live Spans, and it briefly
+// holds up new root Spans; it is meant for occasional use, such as serving a
+// dashboard request, not for hot paths.
+func (r *Registry) Snapshot() *Snapshot {
+	r.scopeMtx.Lock()
+	r.spanMtx.Lock()
+	r.orphanMtx.Lock()
+	scopes := r.scopeListLocked()
+	snap := &Snapshot{
+		Time:   r.now(),
+		Scopes: make([]string, 0, len(scopes)),
+	}
+
+	type pending struct {
+		span   *Span
+		parent *SpanSnapshot
+	}
+	var stack []pending
+	roots := r.rootSpanListLocked()
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, pending{span: roots[i]})
+	}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := snapshotSpan(p.span, snap.Time)
+		if p.parent == nil {
+			snap.Spans = append(snap.Spans, node)
+		} else {
+			p.parent.Children = append(p.parent.Children, node)
+		}
+		var children []*Span
+		p.span.Children(func(child *Span) { children = append(children, child) })
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, pending{span: children[i], parent: node})
+		}
+	}
+
+	sources := make([]scopeSources, 0, len(scopes))
+	for _, s := range scopes {
+		snap.Scopes = append(snap.Scopes, s.Name())
+		l := s.sourceList()
+		sources = append(sources, l)
+		funcs := l.funcs()
+		sort.Sort(funcSorter(funcs))
+		for _, f := range funcs {
+			snap.Funcs = append(snap.Funcs, snapshotFunc(f))
+		}
+	}
+	r.orphanMtx.Unlock()
+	r.spanMtx.Unlock()
+	r.scopeMtx.Unlock()
+
+	// StatSources may call back into the Registry, so they are only asked for
+	// their values once the locks are released.
+	cb := func(key SeriesKey, field string, val float64) {
+		snap.Stats = append(snap.Stats, StatSnapshot{
+			Key: key, Field: field, Value: val})
+	}
+	for _, t := range r.transformers {
+		cb = t.Transform(cb)
+	}
+	for i, s := range scopes {
+		if s.Enabled() {
+			sources[i].stats(s.name, cb)
+		}
+	}
+	return snap
+}
+
+func snapshotFunc(f *Func) FuncSnapshot {
+	return FuncSnapshot{Id: f.Id(), Scope: f.Scope().Name(), Name: f.ShortName()}
+}
+
+func snapshotSpan(s *Span, now time.Time) *SpanSnapshot {
+	node := &SpanSnapshot{
+		Id:          s.Id(),
+		TraceId:     s.Trace().Id(),
+		Func:        snapshotFunc(s.Func()),
+		Args:        s.Args(),
+		Annotations: s.Annotations(),
+		Start:       s.Start(),
+		Orphaned:    s.Orphaned(),
+	}
+	node.ParentId, node.HasParent = s.ParentId()
+	if finish, ok := s.FinishTime(); ok {
+		node.Elapsed = finish.Sub(node.Start)
+	} else {
+		node.Elapsed = now.Sub(node.Start)
+	}
+	return node
+}
@@ -15,6 +15,7 @@
 package monkit
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"sort"
@@ -29,16 +30,38 @@ const (
 	spanKey ctxKey = iota
 )
 
-// Annotation represents an arbitrary name and value string pair
+// Annotation represents an arbitrary name and value string pair. Annotations
+// added with AnnotateValue additionally keep the original typed value in Raw.
 type Annotation struct {
 	Name  string
 	Value string
+
+	// Raw is the value passed to AnnotateValue, or nil if the annotation was
+	// added with Annotate. See Interface.
+	Raw interface{}
+}
+
+// Interface returns the typed value of the annotation, which is Raw if set and
+// the Value string otherwise.
+func (a Annotation) Interface() interface{} {
+	if a.Raw != nil {
+		return a.Raw
+	}
+	return a.Value
 }
 
 func (s *Span) addChild(child *Span) {
+	max := s.f.MaxChildren()
 	s.mtx.Lock()
-	s.children.Add(child)
 	done := s.done
+	if !done && max > 0 && s.childCount >= max {
+		child.untracked = true
+		s.dropped += 1
+		s.mtx.Unlock()
+		return
+	}
+	s.children.Add(child)
+	s.childCount += 1
 	s.mtx.Unlock()
 	if done {
 		child.orphan()
@@ -47,22 +70,39 @@ func (s *Span) addChild(child *Span) {
 
 func (s *Span) removeChild(child *Span) {
 	s.mtx.Lock()
-	s.children.Remove(child)
+	if !child.untracked {
+		s.children.Remove(child)
+		s.childCount -= 1
+	}
 	s.mtx.Unlock()
 }
 
+// DroppedChildren returns how many child Spans were not kept track of because
+// the limit set with Func.SetMaxChildren was reached.
+func (s *Span) DroppedChildren() (rv int64) {
+	s.mtx.Lock()
+	rv = s.dropped
+	s.mtx.Unlock()
+	return rv
+}
+
 func (s *Span) orphan() {
+	// the Registry's orphan lock comes before the Span's, so that
+	// Registry.Snapshot can walk the orphans' children while holding it.
+	r := s.f.scope.r
+	r.orphanMtx.Lock()
 	s.mtx.Lock()
 	if !s.done && !s.orphaned {
 		s.orphaned = true
-		s.f.scope.r.orphanedSpan(s)
+		r.orphanedSpanLocked(s)
 	}
 	s.mtx.Unlock()
+	r.orphanMtx.Unlock()
 }
 
 // Duration returns the current amount of time the Span has been running
 func (s *Span) Duration() time.Duration {
-	return time.Since(s.start)
+	return s.f.scope.r.now().Sub(s.start)
 }
 
 // Start returns the time the Span started.
@@ -70,6 +110,45 @@ func (s *Span) Start() time.Time {
 	return s.start
 }
 
+// StartTime returns the time the Span started. It is the same as Start, and
+// like Start is read from the Registry's monotonic clock. See WallStart.
+func (s *Span) StartTime() time.Time {
+	return s.start
+}
+
+// WallStart returns the wall-clock time the Span started, read once when the
+// Span was created.
+//
+// Spans keep two start times because neither serves both purposes. Start,
+// the finish time, and every duration come from the Registry's monotonic
+// clock, which never jumps, so durations stay accurate even if the system
+// clock is stepped by NTP or an administrator while the Span runs. That clock
+// is anchored to the wall clock only once, when the process starts, so it
+// drifts from the wall clock over time and its times can't be compared
+// across machines. WallStart is the time to use when exporting to systems
+// that correlate Spans from many processes; the rest of the Span's times can
+// be converted with WallTime, which keeps the monotonic duration math.
+func (s *Span) WallStart() time.Time {
+	return s.wallStart
+}
+
+// WallTime converts a time read from the Span's monotonic clock, such as its
+// finish time or the time of one of its Events, to wall-clock time, by
+// offsetting it from WallStart by its monotonic distance from Start.
+func (s *Span) WallTime(t time.Time) time.Time {
+	return s.wallStart.Add(t.Sub(s.start))
+}
+
+// Elapsed returns how long the Span has been running. For live Spans this is
+// measured against the current time, and for finished Spans it is the total
+// time the Span ran. It is safe to call concurrently with the Span finishing.
+func (s *Span) Elapsed() time.Duration {
+	if finish, ok := s.FinishTime(); ok {
+		return finish.Sub(s.start)
+	}
+	return s.f.scope.r.now().Sub(s.start)
+}
+
 // Value implements context.Context
 func (s *Span) Value(key interface{}) interface{} {
 	if key == spanKey {
@@ -103,26 +182,32 @@ func (s *Span) Children(cb func(s *Span)) {
 }
 
 // Args returns the list of strings associated with the args given to the
-// Task that created this Span.
+// Task that created this Span. See ArgOptions.
 func (s *Span) Args() (rv []string) {
 	rv = make([]string, 0, len(s.args))
 	for _, arg := range s.args {
-		switch arg := arg.(type) {
-		case string:
-			rv = append(rv, strconv.Quote(arg))
-		case []uint8:
-			rv = append(rv, "[]uint8(0x"+hex.EncodeToString(arg)+")")
-		case []interface{}:
-			rv = append(rv, interfacesToString(arg))
-		case time.Time:
-			rv = append(rv, "time.Time("+arg.Format(time.RFC3339Nano)+")")
-		default:
-			rv = append(rv, fmt.Sprintf("%#v", arg))
-		}
+		rv = append(rv, formatArg(arg))
 	}
 	return rv
 }
 
+func formatArg(arg interface{}) string {
+	switch arg := arg.(type) {
+	case formattedArg:
+		return string(arg)
+	case string:
+		return strconv.Quote(arg)
+	case []uint8:
+		return "[]uint8(0x" + hex.EncodeToString(arg) + ")"
+	case []interface{}:
+		return interfacesToString(arg)
+	case time.Time:
+		return "time.Time(" + arg.Format(time.RFC3339Nano) + ")"
+	default:
+		return fmt.Sprintf("%#v", arg)
+	}
+}
+
 func interfacesToString(args []interface{}) string {
 	var b strings.Builder
 	b.WriteString("{")
@@ -168,6 +253,215 @@ func (s *Span) Func() *Func { return s.f }
 // Trace returns the Trace this Span is associated with.
 func (s *Span) Trace() *Trace { return s.trace }
 
+// Parent returns the local parent of this Span, if any. Spans with a remote
+// parent have no local parent. See ParentId.
+func (s *Span) Parent() *Span { return s.parent }
+
+// FinishTime returns when this Span finished. ok is false if the Span has not
+// finished yet.
+func (s *Span) FinishTime() (finish time.Time, ok bool) {
+	s.mtx.Lock()
+	finish, ok = s.finish, s.done
+	s.mtx.Unlock()
+	return finish, ok
+}
+
+// Outcome returns the error this Span finished with and whether or not it
+// panicked. Both are zero values if the Span has not finished yet.
+func (s *Span) Outcome() (err error, panicked bool) {
+	s.mtx.Lock()
+	err, panicked = s.err, s.panicked
+	s.mtx.Unlock()
+	return err, panicked
+}
+
+// Link is a causal relationship between a Span and a Span other than its
+// parent, possibly in another Trace, such as the Spans that produced the
+// messages a batch consumer handles.
+type Link struct {
+	TraceId TraceId
+	SpanId  int64
+}
+
+// AddLink records a Link from the Span to the Span with the given ids. Links
+// don't change the Span's parent or children. Use TraceIdFromInt64 to link to
+// a Trace with a 64-bit id.
+func (s *Span) AddLink(traceId TraceId, spanId int64) {
+	s.mtx.Lock()
+	s.links = append(s.links, Link{TraceId: traceId, SpanId: spanId})
+	s.mtx.Unlock()
+}
+
+// Links returns the Links added with AddLink.
+func (s *Span) Links() []Link {
+	s.mtx.Lock()
+	links := s.links
+	s.mtx.Unlock()
+	return append([]Link(nil), links...)
+}
+
+// maxSpanEvents is the most Events a Span keeps.
+const maxSpanEvents = 128
+
+// Event is a named point in time within a Span, such as "acquired lock".
+// Unlike child Spans, Events have no duration and no children.
+type Event struct {
+	Name string
+	Time time.Time
+}
+
+// AddEvent records an Event with the given name at the current time. Each
+// Span keeps at most 128 Events, and further Events are dropped.
+func (s *Span) AddEvent(name string) {
+	now := s.f.scope.r.now()
+	s.mtx.Lock()
+	if len(s.events) < maxSpanEvents {
+		s.events = append(s.events, Event{Name: name, Time: now})
+	}
+	s.mtx.Unlock()
+}
+
+// Events returns the Events added with AddEvent, in the order they were
+// added.
+func (s *Span) Events() []Event {
+	s.mtx.Lock()
+	events := s.events
+	s.mtx.Unlock()
+	return append([]Event(nil), events...)
+}
+
+// Level is the severity of a Span, for finding the interesting parts of a
+// large trace. The zero value is LevelInfo.
+type Level int32
+
+// Levels, from least to most severe.
+const (
+	LevelDebug Level = -1
+	LevelInfo  Level = 0
+	LevelWarn  Level = 1
+	LevelError Level = 2
+)
+
+// String returns the lowercase name of the level, such as "warn".
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel returns the Level with the given name, as returned by
+// Level.String. "warning" is accepted for LevelWarn.
+func ParseLevel(name string) (Level, bool) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, true
+	case "info":
+		return LevelInfo, true
+	case "warn", "warning":
+		return LevelWarn, true
+	case "error":
+		return LevelError, true
+	}
+	return LevelInfo, false
+}
+
+// SetLevel sets the severity of the Span, which presenters show and can
+// filter on. Spans start at LevelInfo, and a Span's level doesn't affect the
+// level of its children.
+func (s *Span) SetLevel(level Level) {
+	s.mtx.Lock()
+	s.level = level
+	s.mtx.Unlock()
+}
+
+// Level returns the severity of the Span. See SetLevel.
+func (s *Span) Level() (rv Level) {
+	s.mtx.Lock()
+	rv = s.level
+	s.mtx.Unlock()
+	return rv
+}
+
+// StatusCode is the status of a Span as OpenTelemetry and similar systems
+// model it, independent of the error the Span's Task finished with. The zero
+// value is StatusUnset.
+type StatusCode int32
+
+// StatusCodes. StatusUnset means no status was set and the Span didn't fail.
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// String returns the lowercase name of the status code, such as "error".
+func (c StatusCode) String() string {
+	switch c {
+	case StatusUnset:
+		return "unset"
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	}
+	return "status(" + strconv.Itoa(int(c)) + ")"
+}
+
+// ParseStatusCode returns the StatusCode with the given name, as returned by
+// StatusCode.String.
+func ParseStatusCode(name string) (StatusCode, bool) {
+	switch strings.ToLower(name) {
+	case "unset":
+		return StatusUnset, true
+	case "ok":
+		return StatusOK, true
+	case "error":
+		return StatusError, true
+	}
+	return StatusUnset, false
+}
+
+// SetStatus sets the status of the Span, for marking a Span as failed without
+// returning an error, such as a handler that responded with an HTTP 500, or as
+// explicitly successful. Setting StatusUnset clears a previously set status.
+// SetStatus only changes what Status reports; it doesn't change the error the
+// Span finishes with or the Func's success and error stats.
+func (s *Span) SetStatus(code StatusCode, message string) {
+	s.mtx.Lock()
+	s.status, s.statusMessage = code, message
+	s.mtx.Unlock()
+}
+
+// Status returns the status of the Span. A status set with SetStatus always
+// wins, even over the error the Span finished with, so instrumentation can
+// mark an expected error as StatusOK. Otherwise a Span that finished with an
+// error is StatusError with the error's message, one that panicked is
+// StatusError with the message "panicked", and any other Span is
+// StatusUnset.
+func (s *Span) Status() (code StatusCode, message string) {
+	s.mtx.Lock()
+	code, message = s.status, s.statusMessage
+	err, panicked := s.err, s.panicked
+	s.mtx.Unlock()
+	switch {
+	case code != StatusUnset:
+		return code, message
+	case panicked:
+		return StatusError, "panicked"
+	case err != nil:
+		return StatusError, err.Error()
+	}
+	return StatusUnset, ""
+}
+
 // Annotations returns any added annotations created through the Span Annotate
 // method
 func (s *Span) Annotations() []Annotation {
@@ -179,11 +473,56 @@ func (s *Span) Annotations() []Annotation {
 
 // Annotate adds an annotation to the existing Span.
 func (s *Span) Annotate(name, val string) {
+	s.addAnnotation(Annotation{Name: name, Value: val})
+}
+
+// AnnotateValue adds an annotation with a typed value to the existing Span.
+// The value is stringified with fmt for the annotation's Value, but is also
+// kept as is so presenters such as JSON can output it with its proper type.
+func (s *Span) AnnotateValue(name string, val interface{}) {
+	if str, ok := val.(string); ok {
+		s.Annotate(name, str)
+		return
+	}
+	s.addAnnotation(Annotation{Name: name, Value: fmt.Sprint(val), Raw: val})
+}
+
+// addAnnotation adds a to the Span unless it doesn't fit in the Registry's
+// annotation budget. See Registry.SetAnnotationBudget.
+func (s *Span) addAnnotation(a Annotation) {
+	budget := loadAnnotationBudgetRef(&s.f.scope.r.annotationBudget)
 	s.mtx.Lock()
-	s.annotations = append(s.annotations, Annotation{Name: name, Value: val})
+	if budget != nil {
+		size := len(a.Name) + len(a.Value)
+		if s.annotationBytes+size > budget.bytes {
+			s.mtx.Unlock()
+			budget.dropped.Inc(1)
+			return
+		}
+		s.annotationBytes += size
+	}
+	s.annotations = append(s.annotations, a)
 	s.mtx.Unlock()
 }
 
+// checkCtx annotates this Span and updates its Func's stats if the Span's
+// context was cancelled or its deadline was exceeded.
+func (s *Span) checkCtx() {
+	cerr := s.Context.Err()
+	switch cerr {
+	case nil:
+		return
+	case context.Canceled:
+		s.Annotate("cancelled", "true")
+	case context.DeadlineExceeded:
+		s.Annotate("deadline_exceeded", "true")
+	}
+	if cause := contextCause(s.Context); cause != nil {
+		s.Annotate("cause", cause.Error())
+	}
+	s.f.ctxDone(cerr)
+}
+
 // Orphaned returns true if the Parent span ended before this Span did.
 func (s *Span) Orphaned() (rv bool) {
 	s.mtx.Lock()
@@ -0,0 +1,473 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpanElapsed(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+
+	var span *Span
+	func() {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+		time.Sleep(time.Millisecond)
+		if span.Elapsed() < time.Millisecond {
+			t.Fatalf("expected live elapsed time of at least 1ms")
+		}
+	}()
+
+	elapsed := span.Elapsed()
+	time.Sleep(time.Millisecond)
+	if span.Elapsed() != elapsed {
+		t.Fatalf("expected elapsed time to stop once the span finished")
+	}
+	if !span.StartTime().Equal(span.Start()) {
+		t.Fatalf("expected StartTime to match Start")
+	}
+}
+
+func TestSpanAnnotations(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+
+	ctx := context.Background()
+	exit := mon.Task()(&ctx)
+	span := SpanFromCtx(ctx)
+	span.Annotate("first", "1")
+	span.AnnotateValue("second", 2)
+	span.Annotate("third", "3")
+
+	annotations := span.Annotations()
+	annotations[0].Value = "modified"
+	span.Annotate("fourth", "4")
+	exit(nil)
+
+	got := span.Annotations()
+	if len(got) != 4 {
+		t.Fatalf("expected 4 annotations, got %d", len(got))
+	}
+	for i, name := range []string{"first", "second", "third", "fourth"} {
+		if got[i].Name != name {
+			t.Fatalf("expected %q at %d, got %q", name, i, got[i].Name)
+		}
+	}
+	if got[0].Value != "1" {
+		t.Fatalf("expected annotations to be a copy")
+	}
+	if got[1].Value != "2" || got[1].Interface() != 2 {
+		t.Fatalf("unexpected typed annotation: %#v", got[1])
+	}
+}
+
+func TestSpanAnnotationBudget(t *testing.T) {
+	r := NewRegistry()
+	r.SetAnnotationBudget(10)
+	mon := r.ScopeNamed("test")
+
+	ctx := context.Background()
+	exit := mon.Task()(&ctx)
+	span := SpanFromCtx(ctx)
+	span.Annotate("a", "1234")   // 5 bytes
+	span.Annotate("b", "123456") // 7 bytes, dropped
+	span.AnnotateValue("c", 123) // 4 bytes
+	span.Annotate("d", "1")      // 2 bytes, dropped
+	exit(nil)
+
+	got := span.Annotations()
+	if len(got) != 2 || got[0].Name != "a" || got[1].Name != "c" {
+		t.Fatalf("unexpected annotations: %v", got)
+	}
+	dropped := Collect(r.ScopeNamed(selfScope))["annotations_dropped,scope="+selfScope+" value"]
+	if dropped != 2 {
+		t.Fatalf("expected 2 dropped annotations, got %v", dropped)
+	}
+
+	r.SetAnnotationBudget(0)
+	ctx = context.Background()
+	exit = mon.Task()(&ctx)
+	SpanFromCtx(ctx).Annotate("big", strings.Repeat("x", 100))
+	exit(nil)
+	if n := len(SpanFromCtx(ctx).Annotations()); n != 1 {
+		t.Fatalf("expected budget to be removed, got %d annotations", n)
+	}
+}
+
+func TestSpanDeadline(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	// deadlines are checked against the wall clock, not the Registry's.
+	r.SetClock(func() time.Time { return time.Unix(0, 0) })
+
+	var span *Span
+	func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		defer mon.Task()(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+	}()
+
+	annotations := span.Annotations()
+	if len(annotations) != 2 ||
+		annotations[0].Name != "deadline.budget" ||
+		annotations[1].Name != "deadline.exceeded" {
+		t.Fatalf("unexpected annotations: %v", annotations)
+	}
+	if budget := annotations[0].Raw.(time.Duration); budget <= 0 || budget > time.Hour {
+		t.Fatalf("unexpected budget: %v", budget)
+	}
+	if annotations[1].Value != "false" {
+		t.Fatalf("expected deadline to not be exceeded")
+	}
+
+	func() {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		span = SpanFromCtx(ctx)
+	}()
+	if len(span.Annotations()) != 0 {
+		t.Fatalf("expected no annotations without a deadline")
+	}
+}
+
+func TestSpanArgOptions(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+
+	args := func(args ...interface{}) []string {
+		var span *Span
+		func() {
+			ctx := context.Background()
+			defer mon.Task()(&ctx, args...)(nil)
+			span = SpanFromCtx(ctx)
+		}()
+		return span.Args()
+	}
+
+	if got := args("user", []byte("hi")); len(got) != 2 ||
+		got[0] != `"user"` || got[1] != "[]uint8(0x6869)" {
+		t.Fatalf("unexpected default args: %q", got)
+	}
+
+	got := args(ArgOptions{MaxLength: 8, Redact: []int{1}},
+		"user", "hunter2", "a long argument", 12)
+	expected := []string{`"user"`, RedactedArg, `"a lo...`, "12"}
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected args: %q", got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+
+	if got := truncateArg("héllo", 5); got != "h..." {
+		t.Fatalf("expected truncation on a rune boundary, got %q", got)
+	}
+}
+
+func TestSpanFork(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+
+	type key struct{}
+	base := context.WithValue(context.Background(), key{}, "val")
+
+	var parent *Span
+	var forked context.Context
+	started := make(chan *Span)
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	func() {
+		ctx := context.Background()
+		defer mon.TaskNamed("parent")(&ctx)(nil)
+		parent = SpanFromCtx(ctx)
+		forked = parent.Fork(base)
+
+		go func() {
+			defer close(done)
+			ctx := forked
+			defer mon.TaskNamed("child")(&ctx)(nil)
+			started <- SpanFromCtx(ctx)
+			<-release
+		}()
+
+		child := <-started
+		found := false
+		r.AllSpans(func(s *Span) { found = found || s == child })
+		if !found || child.Parent() != parent || child.Orphaned() {
+			t.Fatalf("expected child to be linked to its running parent")
+		}
+		if child.Value(key{}) != "val" {
+			t.Fatalf("expected values of the forked context to be kept")
+		}
+	}()
+
+	if parent.Orphaned() {
+		t.Fatalf("expected parent not to be orphaned")
+	}
+	var roots []string
+	r.RootSpans(func(s *Span) {
+		roots = append(roots, s.Func().ShortName())
+		if !s.Orphaned() {
+			t.Fatalf("expected remaining root span to be orphaned")
+		}
+	})
+	if len(roots) != 1 || roots[0] != "child" {
+		t.Fatalf("expected the child to outlive its parent as an orphan: %v",
+			roots)
+	}
+	close(release)
+	<-done
+
+	// starting a child after the parent finished orphans it right away.
+	func() {
+		ctx := forked
+		defer mon.TaskNamed("late")(&ctx)(nil)
+		if s := SpanFromCtx(ctx); s.Parent() != parent || !s.Orphaned() {
+			t.Fatalf("expected late child to be an orphan of the parent")
+		}
+	}()
+}
+
+func TestSpanMaxChildren(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	parentFunc := mon.FuncNamed("parent")
+	parentFunc.SetMaxChildren(2)
+
+	ctx := context.Background()
+	parentDone := parentFunc.Task(&ctx)
+	parent := SpanFromCtx(ctx)
+
+	var exits []func(*error)
+	for i := 0; i < 5; i++ {
+		childCtx := ctx
+		exits = append(exits, mon.TaskNamed("child")(&childCtx))
+	}
+
+	children := 0
+	parent.Children(func(*Span) { children++ })
+	if children != 2 || parent.DroppedChildren() != 3 {
+		t.Fatalf("expected 2 children and 3 dropped, got %d and %d",
+			children, parent.DroppedChildren())
+	}
+
+	// finishing a tracked child makes room for the next one.
+	exits[0](nil)
+	childCtx := ctx
+	exits = append(exits[1:], mon.TaskNamed("child")(&childCtx))
+	if parent.DroppedChildren() != 3 {
+		t.Fatalf("expected a new child to be tracked")
+	}
+
+	for _, exit := range exits {
+		exit(nil)
+	}
+	parentDone(nil)
+	r.RootSpans(func(s *Span) {
+		t.Fatalf("unexpected root span %s", s.Func().ShortName())
+	})
+	if mon.FuncNamed("child").Success() != 6 {
+		t.Fatalf("expected untracked children to be monitored")
+	}
+}
+
+func TestMaxTraceDepth(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	r.SetMaxTraceDepth(3)
+
+	var spans []*Span
+	var recurse func(ctx context.Context, n int)
+	recurse = func(ctx context.Context, n int) {
+		defer mon.TaskNamed("recurse")(&ctx)(nil)
+		spans = append(spans, SpanFromCtx(ctx))
+		if n > 1 {
+			recurse(ctx, n-1)
+		} else {
+			var all []*Span
+			r.AllSpans(func(s *Span) { all = append(all, s) })
+			if len(all) != 6 {
+				t.Fatalf("expected 6 live spans, got %d", len(all))
+			}
+		}
+	}
+	recurse(context.Background(), 6)
+
+	for i, s := range spans {
+		var overflow interface{}
+		for _, a := range s.Annotations() {
+			if a.Name == "depth.overflow" {
+				overflow = a.Raw
+			}
+		}
+		if i < 3 {
+			if overflow != nil || (i > 0 && s.Parent() != spans[i-1]) {
+				t.Fatalf("expected span %d to be nested normally", i)
+			}
+			continue
+		}
+		if s.Parent() != spans[1] || overflow != i+1 {
+			t.Fatalf("expected span %d to be flattened, got overflow %v", i,
+				overflow)
+		}
+	}
+}
+
+func TestSpanLinks(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	ctx := context.Background()
+	defer mon.Task()(&ctx)(nil)
+	s := SpanFromCtx(ctx)
+
+	wide := NewId128()
+	s.AddLink(TraceIdFromInt64(1), 2)
+	s.AddLink(wide, 4)
+	links := s.Links()
+	if len(links) != 2 ||
+		links[0] != (Link{TraceId: TraceIdFromInt64(1), SpanId: 2}) ||
+		links[1] != (Link{TraceId: wide, SpanId: 4}) {
+		t.Fatalf("unexpected links: %v", links)
+	}
+	if _, ok := s.ParentId(); ok {
+		t.Fatal("expected links not to affect the parent")
+	}
+}
+
+func TestSpanLevel(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+
+	ctx := context.Background()
+	defer mon.Task()(&ctx)(nil)
+	parent := SpanFromCtx(ctx)
+	if parent.Level() != LevelInfo {
+		t.Fatalf("expected spans to start at info, got %v", parent.Level())
+	}
+	parent.SetLevel(LevelWarn)
+
+	child := ctx
+	defer mon.Task()(&child)(nil)
+	if level := SpanFromCtx(child).Level(); level != LevelInfo {
+		t.Fatalf("expected children not to inherit the level, got %v", level)
+	}
+	if parent.Level() != LevelWarn || parent.Level().String() != "warn" {
+		t.Fatalf("unexpected level: %v", parent.Level())
+	}
+
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if parsed, ok := ParseLevel(level.String()); !ok || parsed != level {
+			t.Fatalf("expected %v to round trip, got %v", level, parsed)
+		}
+	}
+	if _, ok := ParseLevel("loud"); ok {
+		t.Fatalf("expected unknown levels not to parse")
+	}
+}
+
+func TestSpanStatus(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+
+	run := func(status StatusCode, message string, err error) (span *Span) {
+		ctx := context.Background()
+		func() {
+			defer mon.Task()(&ctx)(&err)
+			span = SpanFromCtx(ctx)
+			if status != StatusUnset {
+				span.SetStatus(status, message)
+			}
+		}()
+		return span
+	}
+
+	for _, test := range []struct {
+		status  StatusCode
+		message string
+		err     error
+		code    StatusCode
+		msg     string
+	}{
+		{StatusUnset, "", nil, StatusUnset, ""},
+		{StatusUnset, "", errors.New("oops"), StatusError, "oops"},
+		{StatusError, "bad response", nil, StatusError, "bad response"},
+		// an explicit status wins over the error
+		{StatusOK, "", errors.New("not found"), StatusOK, ""},
+	} {
+		code, msg := run(test.status, test.message, test.err).Status()
+		if code != test.code || msg != test.msg {
+			t.Fatalf("expected %v %q, got %v %q", test.code, test.msg, code, msg)
+		}
+	}
+
+	for _, code := range []StatusCode{StatusUnset, StatusOK, StatusError} {
+		if parsed, ok := ParseStatusCode(code.String()); !ok || parsed != code {
+			t.Fatalf("expected %v to round trip, got %v", code, parsed)
+		}
+	}
+}
+
+func TestSpanEvents(t *testing.T) {
+	r := NewRegistry()
+	mon := r.ScopeNamed("test")
+	now := time.Unix(1000, 0)
+	r.SetClock(func() time.Time { return now })
+
+	ctx := context.Background()
+	exit := mon.Task()(&ctx)
+	span := SpanFromCtx(ctx)
+	span.AddEvent("acquired lock")
+	now = now.Add(time.Second)
+	span.AddEvent("sent query")
+	exit(nil)
+
+	events := span.Events()
+	if len(events) != 2 ||
+		events[0] != (Event{Name: "acquired lock", Time: time.Unix(1000, 0)}) ||
+		events[1] != (Event{Name: "sent query", Time: time.Unix(1001, 0)}) {
+		t.Fatalf("unexpected events: %v", events)
+	}
+
+	for i := 0; i < 2*maxSpanEvents; i++ {
+		span.AddEvent("spam")
+	}
+	if n := len(span.Events()); n != maxSpanEvents {
+		t.Fatalf("expected events to be capped at %d, got %d", maxSpanEvents, n)
+	}
+}
+
+func TestSpanWallStart(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+
+	before := time.Now()
+	ctx := context.Background()
+	mon.Task()(&ctx)(nil)
+	after := time.Now()
+
+	s := SpanFromCtx(ctx)
+	if s.WallStart().Before(before.Round(0)) || s.WallStart().After(after.Round(0)) {
+		t.Fatalf("unexpected wall start %v, expected between %v and %v",
+			s.WallStart(), before, after)
+	}
+	finish, _ := s.FinishTime()
+	if s.WallTime(finish).Sub(s.WallStart()) != finish.Sub(s.Start()) {
+		t.Fatalf("expected wall times to keep monotonic durations")
+	}
+}
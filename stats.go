@@ -66,6 +66,18 @@ type StatSource interface {
 	Stats(cb func(key SeriesKey, field string, val float64))
 }
 
+// DescribedStatSource is a StatSource that also knows human readable help
+// text and units for the stats it reports, such as those set with
+// Scope.Describe. Presenters that can report such metadata check for this
+// interface; others can ignore it.
+type DescribedStatSource interface {
+	StatSource
+
+	// StatDescription returns the help text and unit of the stats reported
+	// with the given series key. Either may be empty.
+	StatDescription(key SeriesKey) (help, unit string)
+}
+
 type StatSourceFunc func(cb func(key SeriesKey, field string, val float64))
 
 func (f StatSourceFunc) Stats(cb func(key SeriesKey, field string, val float64)) {
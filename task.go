@@ -70,5 +70,8 @@ func taskArgs(f *Func, args []interface{}) bool {
 //
 // You may also include any SeriesTags which should be included with the Task.
 func (s *Scope) TaskNamed(name string, tags ...SeriesTag) Task {
+	if s.r.noop {
+		return s.noopTaskNamed(name, tags)
+	}
 	return s.FuncNamed(name, tags...).Task
 }
@@ -29,14 +29,23 @@ import (
 //
 //   func MyFunc() {
 //     ...
-//     timer := mon.Timer("event")
+//     timer := mon.Timer("event").Start()
 //     // perform event
 //     timer.Stop()
 //     ...
 //   }
 //
-// Timers implement StatSource.
+// or, to time the rest of a function:
+//
+//   func MyFunc() {
+//     defer mon.Timer("event").Start().Stop()
+//     ...
+//   }
+//
+// Recorded durations come out of Stats with the same fields and percentiles
+// as Task durations. Timers implement StatSource.
 type Timer struct {
+	scopeGate
 	mtx   sync.Mutex
 	times *DurationDist
 }
@@ -70,7 +79,7 @@ func (r *RunningTimer) Elapsed() time.Duration {
 func (r *RunningTimer) Stop() time.Duration {
 	elapsed := r.Elapsed()
 	r.t.mtx.Lock()
-	if !r.stopped {
+	if !r.stopped && !r.t.off() {
 		r.t.times.Insert(elapsed)
 		r.stopped = true
 	}
@@ -86,6 +95,13 @@ func (t *Timer) Values() *DurationDist {
 	return rv
 }
 
+// Reset clears all observed durations.
+func (t *Timer) Reset() {
+	t.mtx.Lock()
+	t.times.Reset()
+	t.mtx.Unlock()
+}
+
 // Stats implements the StatSource interface
 func (t *Timer) Stats(cb func(key SeriesKey, field string, val float64)) {
 	t.mtx.Lock()
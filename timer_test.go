@@ -0,0 +1,44 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"testing"
+)
+
+func TestTimer(t *testing.T) {
+	s := NewRegistry().ScopeNamed("test")
+
+	func() {
+		defer s.Timer("block").Start().Stop()
+	}()
+
+	running := s.Timer("block").Start()
+	first := running.Stop()
+	if second := running.Stop(); second < first {
+		t.Fatalf("expected elapsed time to keep growing")
+	}
+
+	stats := Collect(s)
+	if got := stats["block,scope=test count"]; got != 2 {
+		t.Fatalf("expected stopping twice to record once, got %v: %v",
+			got, stats)
+	}
+	for _, field := range []string{"r50", "r99", "max", "recent", "sum"} {
+		if _, ok := stats["block,scope=test "+field]; !ok {
+			t.Fatalf("missing field %q: %v", field, stats)
+		}
+	}
+}
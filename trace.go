@@ -15,6 +15,9 @@
 package monkit
 
 import (
+	"encoding/binary"
+	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -38,19 +41,45 @@ type SpanObserver interface {
 type Trace struct {
 	// sync/atomic things
 	spanCount     int64
+	totalSpans    int64
+	unobserved    int64 // spans whose observers haven't seen them finish
+	droppedSpans  int64 // see DroppedSpans
+	firstStart    int64 // earliest span start in UnixNano, or noStart
+	lastFinish    int64 // latest span finish in UnixNano, or noFinish
 	spanObservers *spanObserverTuple
 
 	// immutable things from construction
-	id int64
+	id     int64
+	idHigh int64
 
 	// protected by mtx
-	mtx  sync.Mutex
-	vals map[interface{}]interface{}
+	mtx       sync.Mutex
+	vals      map[interface{}]interface{}
+	finished  []*Span
+	doneHooks []*doneHook
 }
 
+// doneHook is called once all of the spans of a Trace have finished and
+// were seen finishing by the Trace's SpanObservers. See onDone.
+type doneHook struct{ cb func() }
+
+// firstStart and lastFinish start out at these sentinels, which no real span
+// time can beat, so they can be updated with a compare-and-swap loop alone.
+const (
+	noStart  = math.MaxInt64
+	noFinish = math.MinInt64
+)
+
 // NewTrace creates a new Trace.
 func NewTrace(id int64) *Trace {
-	return &Trace{id: id}
+	return &Trace{id: id, firstStart: noStart, lastFinish: noFinish}
+}
+
+// NewTrace128 creates a new Trace with a 128-bit trace id. Id will return the
+// low 64 bits of the id, and Id128 the full id.
+func NewTrace128(id TraceId) *Trace {
+	return &Trace{id: id.Low(), idHigh: id.High(),
+		firstStart: noStart, lastFinish: noFinish}
 }
 
 func (t *Trace) getObserver() SpanCtxObserver {
@@ -108,6 +137,14 @@ func removeObserverFrom(parent **spanObserverTuple, ref *spanObserverTuple) (
 // Id returns the id of the Trace
 func (t *Trace) Id() int64 { return t.id }
 
+// Id128 returns the full width id of the Trace. For Traces created with
+// NewTrace, the high 64 bits are zero.
+func (t *Trace) Id128() (rv TraceId) {
+	binary.BigEndian.PutUint64(rv[:8], uint64(t.idHigh))
+	binary.BigEndian.PutUint64(rv[8:], uint64(t.id))
+	return rv
+}
+
 // GetAll returns values associated with a trace. See SetAll.
 func (t *Trace) GetAll() (val map[interface{}]interface{}) {
 	t.mtx.Lock()
@@ -148,8 +185,132 @@ func (t *Trace) copyFrom(s *Trace) {
 	t.vals = vals
 }
 
-func (t *Trace) incrementSpans() { atomic.AddInt64(&t.spanCount, 1) }
-func (t *Trace) decrementSpans() { atomic.AddInt64(&t.spanCount, -1) }
+func (t *Trace) incrementSpans(start time.Time) {
+	atomic.AddInt64(&t.spanCount, 1)
+	atomic.AddInt64(&t.totalSpans, 1)
+	atomic.AddInt64(&t.unobserved, 1)
+	nanos := start.UnixNano()
+	for {
+		first := atomic.LoadInt64(&t.firstStart)
+		if nanos >= first ||
+			atomic.CompareAndSwapInt64(&t.firstStart, first, nanos) {
+			return
+		}
+	}
+}
+
+func (t *Trace) decrementSpans(finish time.Time) (remaining int64) {
+	nanos := finish.UnixNano()
+	for {
+		last := atomic.LoadInt64(&t.lastFinish)
+		if nanos <= last ||
+			atomic.CompareAndSwapInt64(&t.lastFinish, last, nanos) {
+			break
+		}
+	}
+	return atomic.AddInt64(&t.spanCount, -1)
+}
+
+// spanObserved is called once the SpanObservers of the Trace have returned
+// from Finish for a span, after decrementSpans. Since every span is counted
+// until then, the done hooks only run once the observers of every span are
+// done with it, even if spans finish concurrently.
+func (t *Trace) spanObserved() {
+	if atomic.AddInt64(&t.unobserved, -1) != 0 {
+		return
+	}
+	t.mtx.Lock()
+	hooks := t.doneHooks
+	t.doneHooks = nil
+	t.mtx.Unlock()
+	for _, hook := range hooks {
+		hook.cb()
+	}
+}
+
+// onDone arranges for cb to be called once all of the spans of the Trace have
+// finished. The returned remove func unregisters cb.
+func (t *Trace) onDone(cb func()) (remove func()) {
+	hook := &doneHook{cb: cb}
+	t.mtx.Lock()
+	t.doneHooks = append(t.doneHooks, hook)
+	t.mtx.Unlock()
+	return func() {
+		t.mtx.Lock()
+		defer t.mtx.Unlock()
+		for i, existing := range t.doneHooks {
+			if existing == hook {
+				t.doneHooks = append(t.doneHooks[:i:i], t.doneHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (t *Trace) recordFinished(s *Span) {
+	r := s.f.scope.r
+	limit := r.traceSpanLimit()
+	t.mtx.Lock()
+	kept := len(t.finished) < limit
+	if kept {
+		t.finished = append(t.finished, s)
+	}
+	t.mtx.Unlock()
+	if !kept {
+		atomic.AddInt64(&t.droppedSpans, 1)
+		r.spanDropped()
+	}
+}
+
+func (t *Trace) hasFinished() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return len(t.finished) > 0
+}
+
+// FinishedSpans calls cb with every finished Span that was recorded on the
+// Trace, ordered by start time. Spans are only recorded while the Registry
+// they belong to is keeping recent traces. See
+// Registry.SetRecentTraceCapacity, and at most as many as the Registry's trace
+// span limit. See Registry.SetTraceSpanLimit and DroppedSpans. Span.Parent can
+// be used to reconstruct the tree of spans.
+func (t *Trace) FinishedSpans(cb func(s *Span)) {
+	t.mtx.Lock()
+	spans := append([]*Span(nil), t.finished...)
+	t.mtx.Unlock()
+	sort.Sort(spanStartSorter(spans))
+	for _, s := range spans {
+		cb(s)
+	}
+}
+
+// DroppedSpans returns how many finished Spans were left out of FinishedSpans
+// because the Trace already had as many as the Registry's trace span limit.
+// See Registry.SetTraceSpanLimit.
+func (t *Trace) DroppedSpans() int64 { return atomic.LoadInt64(&t.droppedSpans) }
 
 // Spans returns the number of spans currently associated with the Trace.
 func (t *Trace) Spans() int64 { return atomic.LoadInt64(&t.spanCount) }
+
+// SpanCount returns the total number of spans that have been started on the
+// Trace, including the ones that already finished. See Spans for the number
+// of spans still running. The count is kept up to date as spans start, since
+// a Trace doesn't keep its spans around to count them later, so SpanCount is
+// a single atomic load and never walks the spans.
+func (t *Trace) SpanCount() int { return int(atomic.LoadInt64(&t.totalSpans)) }
+
+// Duration returns the duration of the Trace, from the earliest span start to
+// the latest span finish, as timed by the Registry's clock (see SetClock).
+// Once all of the Trace's spans have finished, this is the duration of the
+// whole trace; before that, it only covers the spans that finished so far,
+// and it is 0 if none has. Like SpanCount, the start and finish times are
+// kept up to date atomically as spans start and finish, so Duration never
+// walks the spans or takes a lock.
+func (t *Trace) Duration() time.Duration {
+	first := atomic.LoadInt64(&t.firstStart)
+	last := atomic.LoadInt64(&t.lastFinish)
+	if first == noStart || last == noFinish || last < first {
+		return 0
+	}
+	return time.Duration(last - first)
+}
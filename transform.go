@@ -43,6 +43,79 @@ func TransformStatSource(s StatSource, transformers ...CallbackTransformer) Stat
 	})
 }
 
+// MergeStatSources returns a StatSource that reports the stats of all of the
+// given sources, in order. This can be used to present several independent
+// Registries together. To keep series from different sources apart, wrap the
+// sources with PrefixStatSource.
+func MergeStatSources(sources ...StatSource) StatSource {
+	sources = append([]StatSource(nil), sources...)
+	return StatSourceFunc(func(cb func(key SeriesKey, field string, val float64)) {
+		for _, source := range sources {
+			source.Stats(cb)
+		}
+	})
+}
+
+// PrefixStatSource returns a StatSource that reports the stats of s with
+// prefix prepended to every measurement name.
+func PrefixStatSource(prefix string, s StatSource) StatSource {
+	return TransformStatSource(s, CallbackTransformerFunc(
+		func(cb func(SeriesKey, string, float64)) func(SeriesKey, string, float64) {
+			return func(key SeriesKey, field string, val float64) {
+				key.Measurement = prefix + key.Measurement
+				cb(key, field, val)
+			}
+		}))
+}
+
+// FilterStatSource returns a StatSource that only reports the stats of s
+// whose names match. Names are formatted as by SeriesKey.WithField, such as
+// "function,name=MyFunc,scope=main successes". Excluded stats are dropped
+// during the walk, before they reach any callback further along.
+func FilterStatSource(s StatSource, match func(name string) bool) StatSource {
+	return TransformStatSource(s, CallbackTransformerFunc(
+		func(cb func(SeriesKey, string, float64)) func(SeriesKey, string, float64) {
+			return func(key SeriesKey, field string, val float64) {
+				if match(key.WithField(field)) {
+					cb(key, field, val)
+				}
+			}
+		}))
+}
+
+// FilterByGlob returns a matcher for FilterStatSource that matches names
+// against a glob pattern, where '*' matches any sequence of characters and
+// '?' matches any single character. Unlike path.Match, '*' also matches
+// slashes, which are common in scope names.
+func FilterByGlob(pattern string) func(name string) bool {
+	return func(name string) bool { return globMatch(pattern, name) }
+}
+
+// globMatch reports whether name matches pattern. See FilterByGlob.
+func globMatch(pattern, name string) bool {
+	// star and starName record where the last '*' was seen, to backtrack to.
+	p, n, star, starName := 0, 0, -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case p < len(pattern) && pattern[p] == '*':
+			star, starName = p, n
+			p++
+		case star >= 0:
+			starName++
+			p, n = star+1, starName
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
 // DeltaTransformer calculates deltas from any total fields. It keeps internal
 // state to keep track of the previous totals, so care should be taken to use
 // a different DeltaTransformer per output.
@@ -0,0 +1,78 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"testing"
+)
+
+func TestMergeStatSources(t *testing.T) {
+	storage, network := NewRegistry(), NewRegistry()
+	storage.ScopeNamed("sub").Counter("ops").Inc(1)
+	network.ScopeNamed("sub").Counter("ops").Inc(2)
+
+	stats := Collect(MergeStatSources(
+		PrefixStatSource("storage.", storage),
+		PrefixStatSource("network.", network)))
+
+	if len(stats) != 6 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if stats["storage.ops,scope=sub value"] != 1 ||
+		stats["network.ops,scope=sub value"] != 2 {
+		t.Fatalf("expected prefixes to keep sources apart: %v", stats)
+	}
+}
+
+func TestFilterStatSource(t *testing.T) {
+	storage, network := NewRegistry(), NewRegistry()
+	storage.ScopeNamed("sub").Counter("ops").Inc(1)
+	network.ScopeNamed("sub").Counter("ops").Inc(2)
+	network.ScopeNamed("sub").Counter("errors").Inc(3)
+
+	stats := Collect(FilterStatSource(MergeStatSources(
+		PrefixStatSource("storage.", storage),
+		PrefixStatSource("network.", network)),
+		FilterByGlob("*.ops,* value")))
+
+	if len(stats) != 2 ||
+		stats["storage.ops,scope=sub value"] != 1 ||
+		stats["network.ops,scope=sub value"] != 2 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "a/b,c=d e", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*,scope=x/y *", "f,scope=x/y value", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b", "aXbYc", false},
+	} {
+		if got := globMatch(test.pattern, test.name); got != test.match {
+			t.Errorf("globMatch(%q, %q) = %v, expected %v",
+				test.pattern, test.name, got, test.match)
+		}
+	}
+}
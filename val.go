@@ -15,6 +15,7 @@
 package monkit
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,6 +33,7 @@ import (
 //   }
 //
 type IntVal struct {
+	scopeGate
 	mtx  sync.Mutex
 	dist IntDist
 }
@@ -45,11 +47,39 @@ func NewIntVal(key SeriesKey) (v *IntVal) {
 
 // Observe observes an integer value
 func (v *IntVal) Observe(val int64) {
+	if v.off() {
+		return
+	}
 	v.mtx.Lock()
 	v.dist.Insert(val)
 	v.mtx.Unlock()
 }
 
+// ObserveN observes an integer value n times, such as when importing counts
+// that were already aggregated elsewhere. It has the same effect as calling
+// Observe n times, but its cost is bounded by the size of the reservoir
+// rather than growing with n.
+func (v *IntVal) ObserveN(val int64, n int64) {
+	if v.off() {
+		return
+	}
+	v.mtx.Lock()
+	v.dist.InsertN(val, n)
+	v.mtx.Unlock()
+}
+
+// ObserveWeighted observes an integer value with a weight, such as the
+// inverse of the rate it was sampled at. See IntDist.InsertWeighted for how
+// fractional weights are counted.
+func (v *IntVal) ObserveWeighted(val int64, weight float64) {
+	if v.off() {
+		return
+	}
+	v.mtx.Lock()
+	v.dist.InsertWeighted(val, weight)
+	v.mtx.Unlock()
+}
+
 // Stats implements the StatSource interface.
 func (v *IntVal) Stats(cb func(key SeriesKey, field string, val float64)) {
 	v.mtx.Lock()
@@ -59,6 +89,25 @@ func (v *IntVal) Stats(cb func(key SeriesKey, field string, val float64)) {
 	vd.Stats(cb)
 }
 
+// Reset clears all observed values.
+func (v *IntVal) Reset() {
+	v.mtx.Lock()
+	v.dist.Reset()
+	v.mtx.Unlock()
+}
+
+// Last returns the most recently observed value, which is reported as the
+// recent field alongside the distribution, or 0 if nothing has been observed
+// since construction or the last reset.
+func (v *IntVal) Last() (rv int64) {
+	v.mtx.Lock()
+	if v.dist.Count > 0 {
+		rv = v.dist.Recent
+	}
+	v.mtx.Unlock()
+	return rv
+}
+
 // Quantile returns an estimate of the requested quantile of observed values.
 // 0 <= quantile <= 1
 func (v *IntVal) Quantile(quantile float64) (rv int64) {
@@ -68,8 +117,10 @@ func (v *IntVal) Quantile(quantile float64) (rv int64) {
 	return rv
 }
 
-// FloatVal is a convenience wrapper around an FloatDist. Constructed using
-// NewFloatVal, though its expected usage is like:
+// FloatVal is a convenience wrapper around an FloatDist. Unlike durations,
+// observed values may be negative or of mixed sign, such as temperature
+// deltas or balance changes, so a FloatVal works as a general purpose gauge.
+// Constructed using NewFloatVal, though its expected usage is like:
 //
 //   var mon = monkit.Package()
 //
@@ -80,8 +131,10 @@ func (v *IntVal) Quantile(quantile float64) (rv int64) {
 //   }
 //
 type FloatVal struct {
-	mtx  sync.Mutex
-	dist FloatDist
+	scopeGate
+	mtx      sync.Mutex
+	dist     FloatDist
+	exemplar exemplar
 }
 
 // NewFloatVal creates a FloatVal
@@ -91,20 +144,117 @@ func NewFloatVal(key SeriesKey) (v *FloatVal) {
 	return v
 }
 
+// NewFloatValWithPercentiles creates a FloatVal that reports the given
+// reservoir percentiles instead of the default set. See
+// FloatDist.SetPercentiles.
+func NewFloatValWithPercentiles(key SeriesKey, percentiles []float64) (
+	v *FloatVal) {
+	v = NewFloatVal(key)
+	v.dist.SetPercentiles(percentiles)
+	return v
+}
+
+// NewFloatValSized creates a FloatVal that keeps reservoir samples for
+// percentile estimation instead of the default of ReservoirSize. Reservoirs
+// smaller than 1 use the default.
+func NewFloatValSized(key SeriesKey, reservoir int) (v *FloatVal) {
+	v = NewFloatVal(key)
+	v.dist.setReservoirSize(reservoir)
+	return v
+}
+
 // Observe observes an floating point value
 func (v *FloatVal) Observe(val float64) {
+	v.observe(exemplar{}, val)
+}
+
+// ObserveCtx is like Observe, but if ctx has a Span, the id of its Trace is
+// kept as an exemplar whenever val exceeds the maximum so far. See Exemplar.
+func (v *FloatVal) ObserveCtx(ctx context.Context, val float64) {
+	v.observe(exemplarFromCtx(ctx), val)
+}
+
+// ObserveN observes a floating point value n times. See IntVal.ObserveN.
+func (v *FloatVal) ObserveN(val float64, n int64) {
+	if v.off() {
+		return
+	}
+	v.mtx.Lock()
+	newHigh := v.dist.Count == 0 || val > v.dist.High
+	v.dist.InsertN(val, n)
+	if newHigh && v.dist.High == val {
+		v.exemplar = exemplar{}
+	}
+	v.mtx.Unlock()
+}
+
+// ObserveWeighted observes a floating point value with a weight. See
+// IntVal.ObserveWeighted.
+func (v *FloatVal) ObserveWeighted(val float64, weight float64) {
+	if v.off() {
+		return
+	}
+	v.mtx.Lock()
+	newHigh := v.dist.Count == 0 || val > v.dist.High
+	v.dist.InsertWeighted(val, weight)
+	if newHigh && v.dist.High == val {
+		v.exemplar = exemplar{}
+	}
+	v.mtx.Unlock()
+}
+
+func (v *FloatVal) observe(ex exemplar, val float64) {
+	if v.off() {
+		return
+	}
 	v.mtx.Lock()
+	newHigh := v.dist.Count == 0 || val > v.dist.High
 	v.dist.Insert(val)
+	if newHigh && v.dist.High == val {
+		v.exemplar = ex
+	}
 	v.mtx.Unlock()
 }
 
-// Stats implements the StatSource interface.
+// Exemplar returns the id of the Trace that observed the current maximum
+// value, if the maximum was observed with ObserveCtx inside a Span.
+func (v *FloatVal) Exemplar() (traceId int64, ok bool) {
+	v.mtx.Lock()
+	ex := v.exemplar
+	v.mtx.Unlock()
+	return ex.traceId, ex.ok
+}
+
+// Stats implements the StatSource interface. If there is an exemplar for the
+// maximum, it is reported too. See exemplar.stats.
 func (v *FloatVal) Stats(cb func(key SeriesKey, field string, val float64)) {
 	v.mtx.Lock()
 	vd := v.dist.Copy()
+	ex := v.exemplar
 	v.mtx.Unlock()
 
 	vd.Stats(cb)
+	ex.stats(vd.key, cb)
+}
+
+// Reset clears all observed values.
+func (v *FloatVal) Reset() {
+	v.mtx.Lock()
+	v.dist.Reset()
+	v.exemplar = exemplar{}
+	v.mtx.Unlock()
+}
+
+// Last returns the most recently observed value, which is reported as the
+// recent field alongside the distribution, or 0 if nothing has been observed
+// since construction or the last reset.
+func (v *FloatVal) Last() (rv float64) {
+	v.mtx.Lock()
+	if v.dist.Count > 0 {
+		rv = v.dist.Recent
+	}
+	v.mtx.Unlock()
+	return rv
 }
 
 // Quantile returns an estimate of the requested quantile of observed values.
@@ -133,6 +283,7 @@ type BoolVal struct {
 	falses int64
 	recent int32
 	key    SeriesKey
+	scopeGate
 }
 
 // NewBoolVal creates a BoolVal
@@ -142,6 +293,9 @@ func NewBoolVal(key SeriesKey) *BoolVal {
 
 // Observe observes a boolean value
 func (v *BoolVal) Observe(val bool) {
+	if v.off() {
+		return
+	}
 	if val {
 		atomic.AddInt64(&v.trues, 1)
 		atomic.StoreInt32(&v.recent, 1)
@@ -151,6 +305,13 @@ func (v *BoolVal) Observe(val bool) {
 	}
 }
 
+// Reset clears all observed values.
+func (v *BoolVal) Reset() {
+	atomic.StoreInt64(&v.trues, 0)
+	atomic.StoreInt64(&v.falses, 0)
+	atomic.StoreInt32(&v.recent, 0)
+}
+
 // Stats implements the StatSource interface.
 func (v *BoolVal) Stats(cb func(key SeriesKey, field string, val float64)) {
 	trues := atomic.LoadInt64(&v.trues)
@@ -174,6 +335,7 @@ func (v *BoolVal) Stats(cb func(key SeriesKey, field string, val float64)) {
 //   }
 //
 type StructVal struct {
+	scopeGate
 	mtx    sync.Mutex
 	recent interface{}
 	key    SeriesKey
@@ -188,6 +350,9 @@ func NewStructVal(key SeriesKey) *StructVal {
 // be monitored. A reference to the most recently called Observe value is kept
 // for reading when Stats is called.
 func (v *StructVal) Observe(val interface{}) {
+	if v.off() {
+		return
+	}
 	v.mtx.Lock()
 	v.recent = val
 	v.mtx.Unlock()
@@ -216,8 +381,10 @@ func (v *StructVal) Stats(cb func(key SeriesKey, field string, val float64)) {
 //   }
 //
 type DurationVal struct {
-	mtx  sync.Mutex
-	dist DurationDist
+	scopeGate
+	mtx      sync.Mutex
+	dist     DurationDist
+	exemplar exemplar
 }
 
 // NewDurationVal creates an DurationVal
@@ -227,20 +394,126 @@ func NewDurationVal(key SeriesKey) (v *DurationVal) {
 	return v
 }
 
-// Observe observes an integer value
+// NewDurationValWithPercentiles creates a DurationVal that reports the given
+// reservoir percentiles instead of the default set. See
+// DurationDist.SetPercentiles.
+func NewDurationValWithPercentiles(key SeriesKey, percentiles []float64) (
+	v *DurationVal) {
+	v = NewDurationVal(key)
+	v.dist.SetPercentiles(percentiles)
+	return v
+}
+
+// NewDurationValSized creates a DurationVal that keeps reservoir samples for
+// percentile estimation instead of the default of ReservoirSize. Reservoirs
+// smaller than 1 use the default.
+func NewDurationValSized(key SeriesKey, reservoir int) (v *DurationVal) {
+	v = NewDurationVal(key)
+	v.dist.setReservoirSize(reservoir)
+	return v
+}
+
+// NewDurationValUnit creates a DurationVal that reports durations in the
+// given unit instead of seconds. See DurationDist.SetUnit.
+func NewDurationValUnit(key SeriesKey, unit time.Duration) (v *DurationVal) {
+	v = NewDurationVal(key)
+	v.dist.SetUnit(unit)
+	return v
+}
+
+// Observe records a duration, such as one the caller measured itself, into
+// the same distribution machinery that times Tasks.
 func (v *DurationVal) Observe(val time.Duration) {
+	v.observe(exemplar{}, val)
+}
+
+// ObserveCtx is like Observe, but if ctx has a Span, the id of its Trace is
+// kept as an exemplar whenever val exceeds the maximum so far. See Exemplar.
+func (v *DurationVal) ObserveCtx(ctx context.Context, val time.Duration) {
+	v.observe(exemplarFromCtx(ctx), val)
+}
+
+// ObserveN observes a duration n times. See IntVal.ObserveN.
+func (v *DurationVal) ObserveN(val time.Duration, n int64) {
+	if v.off() {
+		return
+	}
+	v.mtx.Lock()
+	newHigh := v.dist.Count == 0 || val > v.dist.High
+	v.dist.InsertN(val, n)
+	if newHigh && v.dist.High == val {
+		v.exemplar = exemplar{}
+	}
+	v.mtx.Unlock()
+}
+
+// ObserveWeighted observes a duration with a weight. See
+// IntVal.ObserveWeighted.
+func (v *DurationVal) ObserveWeighted(val time.Duration, weight float64) {
+	if v.off() {
+		return
+	}
+	v.mtx.Lock()
+	newHigh := v.dist.Count == 0 || val > v.dist.High
+	v.dist.InsertWeighted(val, weight)
+	if newHigh && v.dist.High == val {
+		v.exemplar = exemplar{}
+	}
+	v.mtx.Unlock()
+}
+
+func (v *DurationVal) observe(ex exemplar, val time.Duration) {
+	if v.off() {
+		return
+	}
 	v.mtx.Lock()
+	newHigh := v.dist.Count == 0 || val > v.dist.High
 	v.dist.Insert(val)
+	if newHigh && v.dist.High == val {
+		v.exemplar = ex
+	}
 	v.mtx.Unlock()
 }
 
-// Stats implements the StatSource interface.
+// Exemplar returns the id of the Trace that observed the current maximum
+// value, if the maximum was observed with ObserveCtx inside a Span.
+func (v *DurationVal) Exemplar() (traceId int64, ok bool) {
+	v.mtx.Lock()
+	ex := v.exemplar
+	v.mtx.Unlock()
+	return ex.traceId, ex.ok
+}
+
+// Stats implements the StatSource interface. If there is an exemplar for the
+// maximum, it is reported too. See exemplar.stats.
 func (v *DurationVal) Stats(cb func(key SeriesKey, field string, val float64)) {
 	v.mtx.Lock()
 	vd := v.dist.Copy()
+	ex := v.exemplar
 	v.mtx.Unlock()
 
 	vd.Stats(cb)
+	ex.stats(vd.key, cb)
+}
+
+// Reset clears all observed values.
+func (v *DurationVal) Reset() {
+	v.mtx.Lock()
+	v.dist.Reset()
+	v.exemplar = exemplar{}
+	v.mtx.Unlock()
+}
+
+// Last returns the most recently observed value, which is reported as the
+// recent field alongside the distribution, or 0 if nothing has been observed
+// since construction or the last reset.
+func (v *DurationVal) Last() (rv time.Duration) {
+	v.mtx.Lock()
+	if v.dist.Count > 0 {
+		rv = v.dist.Recent
+	}
+	v.mtx.Unlock()
+	return rv
 }
 
 // Quantile returns an estimate of the requested quantile of observed values.
@@ -251,3 +524,30 @@ func (v *DurationVal) Quantile(quantile float64) (rv time.Duration) {
 	v.mtx.Unlock()
 	return rv
 }
+
+// exemplar links the maximum observed value of a Val to the Trace that
+// observed it.
+type exemplar struct {
+	traceId int64
+	ok      bool
+}
+
+func exemplarFromCtx(ctx context.Context) exemplar {
+	if s := SpanFromCtx(ctx); s != nil {
+		return exemplar{traceId: s.Trace().Id(), ok: true}
+	}
+	return exemplar{}
+}
+
+// stats reports the exemplar under the Val's own series key, so that a new
+// exemplar doesn't start a new series. A float64 can't hold a 64-bit trace id
+// exactly, so the id is split into its high and low 32 bits, reported as the
+// max_trace_id_high and max_trace_id_low fields.
+func (ex exemplar) stats(key SeriesKey,
+	cb func(key SeriesKey, field string, val float64)) {
+	if !ex.ok {
+		return
+	}
+	cb(key, "max_trace_id_high", float64(uint64(ex.traceId)>>32))
+	cb(key, "max_trace_id_low", float64(uint32(ex.traceId)))
+}
@@ -0,0 +1,480 @@
+// Copyright (C) 2015 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFloatValPercentiles(t *testing.T) {
+	r := NewRegistry()
+	s := r.ScopeNamed("test")
+	v := s.FloatValWithPercentiles("latency", []float64{50, 95, 99.9})
+	for i := 0; i <= 10; i++ {
+		v.Observe(float64(i))
+	}
+
+	stats := Collect(s)
+	for _, field := range []string{"r50", "r95", "r99_9", "rmin", "rmax"} {
+		if _, ok := stats["latency,scope=test "+field]; !ok {
+			t.Fatalf("missing field %q: %v", field, stats)
+		}
+	}
+	for _, field := range []string{"r10", "r90", "r99"} {
+		if _, ok := stats["latency,scope=test "+field]; ok {
+			t.Fatalf("unexpected field %q: %v", field, stats)
+		}
+	}
+	if got := stats["latency,scope=test r50"]; got != 5 {
+		t.Fatalf("expected r50 of 5, got %v", got)
+	}
+
+	d := s.DurationVal("default")
+	d.Observe(1)
+	stats = Collect(s)
+	for _, field := range []string{"r10", "r50", "r90", "r99"} {
+		if _, ok := stats["default,scope=test "+field]; !ok {
+			t.Fatalf("missing default field %q: %v", field, stats)
+		}
+	}
+}
+
+func TestFloatValSigned(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		low      int
+		expected map[string]float64
+	}{
+		{name: "negative", low: -10, expected: map[string]float64{
+			"min": -10, "max": 0, "avg": -5, "sum": -55, "rmin": -10,
+			"r10": -9, "r50": -5, "r90": -1, "rmax": 0, "recent": -1,
+		}},
+		{name: "mixed", low: -5, expected: map[string]float64{
+			"min": -5, "max": 5, "avg": 0, "sum": 0, "rmin": -5,
+			"r10": -4, "r50": 0, "r90": 4, "rmax": 5, "recent": 4,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewRegistry().ScopeNamed("test")
+			v := s.FloatVal("delta")
+			// observe out of order, so the reservoir has to be sorted.
+			for i := tc.low + 10; i >= tc.low; i -= 2 {
+				v.Observe(float64(i))
+			}
+			for i := tc.low + 1; i < tc.low+10; i += 2 {
+				v.Observe(float64(i))
+			}
+
+			stats := Collect(s)
+			for field, expected := range tc.expected {
+				got := stats["delta,scope=test "+field]
+				if diff := got - expected; diff > 1e-9 || diff < -1e-9 {
+					t.Fatalf("expected %s of %v, got %v", field, expected, got)
+				}
+			}
+		})
+	}
+
+	// past the reservoir size, percentiles are estimates, but they must still
+	// be ordered and have the right signs.
+	v := NewFloatVal(NewSeriesKey("delta"))
+	for i := 0; i < 20000; i++ {
+		v.Observe(float64(i*7919%2001 - 1000))
+	}
+	var quantiles []float64
+	for _, q := range []float64{0, .1, .5, .9, 1} {
+		quantiles = append(quantiles, v.Quantile(q))
+	}
+	for i := 1; i < len(quantiles); i++ {
+		if quantiles[i] < quantiles[i-1] {
+			t.Fatalf("expected ordered quantiles, got %v", quantiles)
+		}
+	}
+	if quantiles[0] < -1000 || quantiles[1] >= 0 || quantiles[3] <= 0 ||
+		quantiles[4] > 1000 {
+		t.Fatalf("unexpected quantiles %v", quantiles)
+	}
+}
+
+func TestScopeReset(t *testing.T) {
+	r := NewRegistry()
+	s := r.ScopeNamed("test")
+	counter := s.Counter("counter")
+	meter := s.Meter("meter")
+	val := s.IntVal("val")
+	boolVal := s.BoolVal("bool")
+	f := s.FuncNamed("func")
+
+	counter.Inc(3)
+	meter.Mark(5)
+	val.Observe(7)
+	boolVal.Observe(true)
+	f.end(nil, false, 1)
+
+	r.Reset()
+
+	stats := Collect(s)
+	for _, key := range []string{
+		"counter,scope=test value",
+		"meter,scope=test total",
+		"val,scope=test count",
+		"bool,scope=test true",
+		"function,name=func,scope=test total",
+	} {
+		if stats[key] != 0 {
+			t.Fatalf("expected %q to be reset, got %v", key, stats[key])
+		}
+	}
+
+	counter.Inc(1)
+	if s.Counter("counter") != counter || counter.Current() != 1 {
+		t.Fatalf("expected registrations to survive a reset")
+	}
+}
+
+func TestDurationValUnit(t *testing.T) {
+	s := NewRegistry().ScopeNamed("test")
+	s.DurationValUnit("ms", time.Millisecond).Observe(1500 * time.Millisecond)
+	s.DurationVal("sec").Observe(1500 * time.Millisecond)
+
+	stats := Collect(s)
+	if got := stats["ms,scope=test max"]; got != 1500 {
+		t.Fatalf("expected 1500 milliseconds, got %v", got)
+	}
+	if got := stats["ms,scope=test count"]; got != 1 {
+		t.Fatalf("expected count to be unscaled, got %v", got)
+	}
+	if got := stats["sec,scope=test max"]; got != 1.5 {
+		t.Fatalf("expected 1.5 seconds, got %v", got)
+	}
+}
+
+func TestDurationValObserve(t *testing.T) {
+	s := NewRegistry().ScopeNamed("test")
+	v := s.DurationVal("latency")
+	if s.DurationVal("latency") != v {
+		t.Fatalf("expected the same DurationVal for the same name")
+	}
+	for i := 1; i <= 100; i++ {
+		v.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := Collect(s)
+	if stats["latency,scope=test count"] != 100 ||
+		stats["latency,scope=test min"] != 0.001 ||
+		stats["latency,scope=test max"] != 0.1 ||
+		stats["latency,scope=test recent"] != 0.1 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if p50 := v.Quantile(.5); p50 < 25*time.Millisecond || p50 > 75*time.Millisecond {
+		t.Fatalf("unexpected median: %v", p50)
+	}
+}
+
+func TestValExemplar(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	v := mon.DurationVal("latency")
+
+	var traceId int64
+	func() {
+		ctx := context.Background()
+		defer mon.Task()(&ctx)(nil)
+		traceId = SpanFromCtx(ctx).Trace().Id()
+		v.ObserveCtx(ctx, 2*time.Second)
+		v.ObserveCtx(ctx, time.Second)
+	}()
+	v.Observe(time.Millisecond)
+
+	if id, ok := v.Exemplar(); !ok || id != traceId {
+		t.Fatalf("unexpected exemplar: %d %v", id, ok)
+	}
+	stats := Collect(v)
+	high, low := stats["latency max_trace_id_high"],
+		stats["latency max_trace_id_low"]
+	if int64(uint64(high)<<32|uint64(low)) != traceId {
+		t.Fatalf("expected exemplar for the max: %v", stats)
+	}
+	for key := range stats {
+		if !strings.HasPrefix(key, "latency ") {
+			t.Fatalf("unexpected series for the exemplar: %v", key)
+		}
+	}
+
+	// observing the max again, in bulk or not, keeps the exemplar.
+	v.ObserveN(2*time.Second, 10)
+	v.Observe(2 * time.Second)
+	if id, ok := v.Exemplar(); !ok || id != traceId {
+		t.Fatalf("expected the exemplar to be kept: %d %v", id, ok)
+	}
+
+	// a new max without a span drops the exemplar.
+	v.Observe(3 * time.Second)
+	if _, ok := v.Exemplar(); ok {
+		t.Fatal("expected no exemplar")
+	}
+}
+
+func TestBoolVal(t *testing.T) {
+	mon := NewRegistry().ScopeNamed("test")
+	hits := mon.BoolVal("cache_hit")
+	for _, hit := range []bool{true, true, false, true, false} {
+		hits.Observe(hit)
+	}
+
+	stats := Collect(mon)
+	for field, expected := range map[string]float64{
+		"true":        3,
+		"false":       2,
+		"disposition": 1,
+		"recent":      0,
+	} {
+		if got := stats["cache_hit,scope=test "+field]; got != expected {
+			t.Fatalf("expected %s to be %v, got %v", field, expected, got)
+		}
+	}
+	if mon.BoolVal("cache_hit") != hits {
+		t.Fatal("expected the same BoolVal to be returned")
+	}
+}
+
+func TestEventCounter(t *testing.T) {
+	s := NewRegistry().ScopeNamed("test")
+
+	deploys := s.EventCounter("deploy")
+	stats := Collect(s)
+	if _, ok := stats["deploy,scope=test seconds_since_last"]; ok {
+		t.Fatalf("unexpected seconds_since_last before any event: %v", stats)
+	}
+
+	deploys.Mark()
+	s.EventCounter("deploy").Mark()
+	stats = Collect(s)
+	if got := stats["deploy,scope=test total"]; got != 2 {
+		t.Fatalf("expected total of 2, got %v", got)
+	}
+	since, ok := stats["deploy,scope=test seconds_since_last"]
+	if !ok || since < 0 || since > 60 {
+		t.Fatalf("unexpected seconds_since_last: %v", stats)
+	}
+
+	if allocs := testing.AllocsPerRun(100, deploys.Mark); allocs != 0 {
+		t.Fatalf("expected Mark not to allocate, got %v allocations", allocs)
+	}
+
+	s.Event("hit")
+	stats = Collect(s)
+	if _, ok := stats["hit,scope=test seconds_since_last"]; ok {
+		t.Fatalf("unexpected seconds_since_last on a Meter: %v", stats)
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	s := NewRegistry().ScopeNamed("test")
+
+	queued := 3
+	s.GaugeFunc("queue", func() float64 {
+		// gauges may use monkit while the stats are being walked.
+		s.Counter("gauge_reads").Inc(1)
+		return float64(queued)
+	}, NewSeriesTag("name", "work"))
+
+	stats := Collect(s)
+	if got := stats["queue,name=work,scope=test value"]; got != 3 {
+		t.Fatalf("expected 3, got %v: %v", got, stats)
+	}
+
+	queued = 5
+	stats = Collect(s)
+	if got := stats["queue,name=work,scope=test value"]; got != 5 {
+		t.Fatalf("expected 5, got %v", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	s := NewRegistry().ScopeNamed("test")
+	h := s.Histogram("sizes", []float64{10, 1, 10, 100})
+	for _, val := range []float64{0, 1, 5, 50, 500} {
+		h.Observe(val)
+	}
+
+	bounds, counts := h.Buckets()
+	if len(bounds) != 3 || bounds[0] != 1 || bounds[2] != 100 {
+		t.Fatalf("expected sorted, deduplicated bounds: %v", bounds)
+	}
+	expected := []int64{2, 3, 4, 5}
+	for i := range expected {
+		if counts[i] != expected[i] {
+			t.Fatalf("expected cumulative counts %v, got %v", expected, counts)
+		}
+	}
+
+	stats := Collect(s)
+	if stats["sizes,le=+Inf,scope=test bucket"] != 5 ||
+		stats["sizes,le=10,scope=test bucket"] != 3 ||
+		stats["sizes,scope=test sum"] != 556 ||
+		stats["sizes,scope=test count"] != 5 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+func TestFloatValSized(t *testing.T) {
+	r := NewRegistry()
+	s := r.ScopeNamed("test")
+	v := s.FloatValSized("size", 1000)
+	for i := 0; i < 1000; i++ {
+		v.Observe(float64(i))
+	}
+	// every value fits in the reservoir, so quantiles are exact
+	if q := v.Quantile(.99); q < 989 || q > 990 {
+		t.Fatalf("unexpected r99: %v", q)
+	}
+
+	small := s.DurationValSized("time", 4)
+	for i := 0; i < 1000; i++ {
+		small.Observe(time.Duration(i))
+	}
+	if n := len(small.dist.reservoir); n != 4 {
+		t.Fatalf("unexpected reservoir size: %d", n)
+	}
+	if q := small.Quantile(1); q < 0 || q >= 1000 {
+		t.Fatalf("unexpected max: %v", q)
+	}
+}
+
+func TestDurationValObserveN(t *testing.T) {
+	r := NewRegistry()
+	s := r.ScopeNamed("test")
+	v := s.DurationVal("time")
+	v.ObserveN(10*time.Millisecond, 100)
+	v.ObserveN(time.Second, 1)
+	v.ObserveN(time.Hour, 0)
+
+	stats := Collect(s)
+	if count := stats["time,scope=test count"]; count != 101 {
+		t.Fatalf("unexpected count: %v", count)
+	}
+	if sum := stats["time,scope=test sum"]; sum < 1.99 || sum > 2.01 {
+		t.Fatalf("unexpected sum: %v", sum)
+	}
+	if max := stats["time,scope=test max"]; max != 1 {
+		t.Fatalf("unexpected max: %v", max)
+	}
+	if median := v.Quantile(.5); median != 10*time.Millisecond {
+		t.Fatalf("unexpected median: %v", median)
+	}
+
+	// a huge weight takes over the reservoir without sampling every insert
+	iv := s.IntVal("size")
+	iv.ObserveN(1, 1000)
+	iv.ObserveN(5, 1e12)
+	if count := iv.dist.Count; count != 1e12+1000 {
+		t.Fatalf("unexpected count: %v", count)
+	}
+	if min := iv.Quantile(0); min != 5 {
+		t.Fatalf("unexpected reservoir min: %v", min)
+	}
+}
+
+func TestValObserveNBounded(t *testing.T) {
+	defer func(window int64) { Window = window }(Window)
+
+	s := NewRegistry().ScopeNamed("test")
+	for _, window := range []int64{0, 1024} {
+		Window = window
+		v := s.FloatValSized(fmt.Sprintf("big%d", window), 65536)
+		v.Observe(1)
+		start := time.Now()
+		v.ObserveN(2, 1<<40)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("ObserveN took %v with window %d", elapsed, window)
+		}
+		if v.dist.Count != 1<<40+1 {
+			t.Fatalf("unexpected count: %v", v.dist.Count)
+		}
+		if median := v.Quantile(.5); median != 2 {
+			t.Fatalf("unexpected median with window %d: %v", window, median)
+		}
+	}
+}
+
+func TestValObserveNReservoir(t *testing.T) {
+	defer func(window int64) { Window = window }(Window)
+	Window = 0
+
+	// with a growing window, half of a reservoir filled by 1000 inserts of
+	// one value survives 1000 inserts of another, the same as inserting them
+	// one by one.
+	var replaced int
+	for i := 0; i < 100; i++ {
+		d := NewIntDist(NewSeriesKey("test"))
+		d.InsertN(1, 1000)
+		d.InsertN(2, 1000)
+		for _, sample := range d.reservoir {
+			if sample == 2 {
+				replaced++
+			}
+		}
+	}
+	if frac := float64(replaced) / (100 * ReservoirSize); frac < .45 || frac > .55 {
+		t.Fatalf("expected about half of the reservoir replaced, got %v", frac)
+	}
+}
+
+func TestValObserveWeighted(t *testing.T) {
+	s := NewRegistry().ScopeNamed("test")
+	v := s.IntVal("sampled")
+	for i := 0; i < 1000; i++ {
+		v.ObserveWeighted(3, 2.5)
+	}
+	v.ObserveWeighted(4, 0)
+	v.ObserveWeighted(4, -1)
+	if count := v.dist.Count; count < 2300 || count > 2700 {
+		t.Fatalf("expected a count of about 2500, got %d", count)
+	}
+	if v.dist.Sum != 3*v.dist.Count || v.dist.High != 3 {
+		t.Fatalf("unexpected sum or max: %d %d", v.dist.Sum, v.dist.High)
+	}
+
+	dv := s.DurationVal("latency")
+	dv.ObserveWeighted(time.Second, 4)
+	if dv.dist.Count != 4 {
+		t.Fatalf("expected whole weights to count exactly: %d", dv.dist.Count)
+	}
+}
+
+func TestIntValLast(t *testing.T) {
+	r := NewRegistry()
+	s := r.ScopeNamed("test")
+	v := s.IntVal("queue")
+	if last := v.Last(); last != 0 {
+		t.Fatalf("unexpected last: %d", last)
+	}
+	v.Observe(5)
+	v.Observe(3)
+	if last := v.Last(); last != 3 {
+		t.Fatalf("unexpected last: %d", last)
+	}
+	if recent := Collect(s)["queue,scope=test recent"]; recent != 3 {
+		t.Fatalf("unexpected recent: %v", recent)
+	}
+	v.Reset()
+	if last := v.Last(); last != 0 {
+		t.Fatalf("unexpected last after reset: %d", last)
+	}
+}